@@ -0,0 +1,158 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/internal/openai"
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/charmbracelet/log"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// apikeyCmd represents the apikey command.
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage the API keys of the OpenAI-compatible endpoint of a machine",
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create [machine name]",
+	Short: "Create an API key",
+	Long: `Create an API key for the OpenAI-compatible endpoint of a machine.
+
+The key is displayed once: only its hash is stored.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return err
+		}
+
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		token, key, err := apikey.Generate(name)
+		if err != nil {
+			return err
+		}
+
+		m.APIKeys = append(m.APIKeys, key)
+
+		err = saveAPIKeys(m)
+		if err != nil {
+			return err
+		}
+
+		log.Info("API key created, store it now as it can't be displayed again", "id", key.ID)
+		fmt.Println(token)
+
+		return nil
+	},
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:     "list [machine name]",
+	Aliases: []string{"ls"},
+	Short:   "List API keys",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		table := uitable.New()
+		table.MaxColWidth = 50
+
+		table.AddRow("ID", "NAME", "CREATED")
+		for _, key := range m.APIKeys {
+			table.AddRow(key.ID, key.Name, key.CreatedAt.Local().Format(time.DateTime))
+		}
+		fmt.Println(table)
+
+		return nil
+	},
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke [machine name] [key id]",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		count := len(m.APIKeys)
+		m.APIKeys = slices.DeleteFunc(m.APIKeys, func(key apikey.Key) bool { return key.ID == args[1] })
+
+		if len(m.APIKeys) == count {
+			return fmt.Errorf("api key %s not found", args[1])
+		}
+
+		err = saveAPIKeys(m)
+		if err != nil {
+			return err
+		}
+
+		log.Info("API key revoked", "id", args[1])
+
+		return nil
+	},
+}
+
+// saveAPIKeys saves the API keys of the machine, and syncs them to the machine when it runs the OpenAI-compatible server.
+func saveAPIKeys(m *machine.Machine) error {
+	err := machine.Save(m)
+	if err != nil {
+		return fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	if m.OpenAI == nil {
+		return nil
+	}
+
+	err = withSSHClient(m.Name, func(client *gossh.Client) error {
+		return openai.SyncKeys(client, m.APIKeys)
+	})
+	if err != nil {
+		return errors.Join(err, errors.New("api keys are saved locally, but the machine still uses the previous ones"))
+	}
+
+	return nil
+}
+
+func init() {
+	apikeyCreateCmd.Flags().String("name", "", "A name describing what the key is used for")
+	_ = apikeyCreateCmd.MarkFlagRequired("name")
+
+	apikeyCmd.AddCommand(apikeyCreateCmd)
+	apikeyCmd.AddCommand(apikeyListCmd)
+	apikeyCmd.AddCommand(apikeyRevokeCmd)
+}
@@ -0,0 +1,128 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the Ollama server configuration of a machine",
+	Long: `Manage the environment variables of the Ollama server of a machine,
+such as OLLAMA_KEEP_ALIVE, OLLAMA_NUM_PARALLEL, OLLAMA_MAX_LOADED_MODELS, OLLAMA_FLASH_ATTENTION or OLLAMA_ORIGINS.
+
+OLLAMA_HOST is managed by the machine connectivity and can't be changed.`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [machine name] [key]",
+	Short: "Show the Ollama server environment variables of a machine",
+	Args:  cobra.RangeArgs(1, 2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		variables, err := provisioner.GetOllamaEnv(args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 2 { //nolint:mnd
+			value, ok := lookupVariable(variables, args[1])
+			if !ok {
+				return fmt.Errorf("variable %s is not set", args[1])
+			}
+
+			fmt.Println(value)
+
+			return nil
+		}
+
+		table := uitable.New()
+		table.MaxColWidth = 80
+
+		table.AddRow("KEY", "VALUE")
+		for _, variable := range variables {
+			table.AddRow(variable.Key, variable.Value)
+		}
+		fmt.Println(table)
+
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set [machine name] [KEY=VALUE]...",
+	Short: "Set Ollama server environment variables on a machine and restart Ollama",
+	Args:  cobra.MinimumNArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		variables, err := parseAssignments(args[1:])
+		if err != nil {
+			return err
+		}
+
+		return provisioner.SetOllamaEnv(cmd.Context(), args[0], variables)
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset [machine name] [key]...",
+	Short: "Unset Ollama server environment variables on a machine and restart Ollama",
+	Args:  cobra.MinimumNArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return provisioner.UnsetOllamaEnv(cmd.Context(), args[0], args[1:])
+	},
+}
+
+// parseAssignments parses KEY=VALUE assignments.
+func parseAssignments(assignments []string) ([]envfile.Variable, error) {
+	result := make([]envfile.Variable, 0, len(assignments))
+
+	for _, assignment := range assignments {
+		variable, err := envfile.ParseAssignment(assignment)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, variable)
+	}
+
+	return result, nil
+}
+
+func lookupVariable(variables []envfile.Variable, key string) (string, bool) {
+	value, found := "", false
+
+	for _, variable := range variables {
+		if variable.Key == key {
+			value, found = variable.Value, true
+		}
+	}
+
+	return value, found
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+}
@@ -0,0 +1,69 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/spf13/cobra"
+)
+
+var connectivitySetSelector = connectivity.NewSelector()
+
+// connectivityCmd represents the connectivity command.
+var connectivityCmd = &cobra.Command{
+	Use:   "connectivity",
+	Short: "Manage the connectivity of machines",
+}
+
+var connectivitySetCmd = &cobra.Command{
+	Use:   "set [machine name] [connectivity]",
+	Short: "Change the connectivity of a running machine",
+	Long: fmt.Sprintf(`Change the connectivity of a running machine over SSH, without rebuilding it.
+
+The software of the current connectivity is removed from the machine and the new one is installed,
+the firewall rules are updated when the cloud provider supports it, then Ollama is restarted.
+Resources of the current connectivity created outside of the machine, such as Cloudflare tunnels, are removed once the new one works.
+
+The connectivity is one of %s, and takes the same flags as the create command.`, strings.Join(connectivity.Names(), ", ")),
+	Args: cobra.ExactArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		connectivitySetSelector.Name = args[1]
+
+		connectivityProvider, err := connectivitySetSelector.Provider()
+		if err != nil {
+			return err
+		}
+
+		prov, err := provisioner.NewProvisionerForMachine(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create provisioner: %w", err)
+		}
+
+		return prov.SetConnectivity(cmd.Context(), args[0], connectivityProvider)
+	},
+}
+
+func init() {
+	connectivitySetSelector.RegisterProviderFlags(connectivitySetCmd.Flags())
+
+	connectivityCmd.AddCommand(connectivitySetCmd)
+}
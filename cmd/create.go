@@ -18,17 +18,21 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
 	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider"
 	"github.com/spf13/cobra"
 )
 
 var (
-	createRequest    = &provider.CreateMachineRequest{}
-	connectivityOpts = &connectivity.Options{}
+	createRequest        = &provider.CreateMachineRequest{}
+	connectivitySelector = connectivity.NewSelector()
+	createOpts           = &provisioner.CreateMachineOptions{}
 )
 
 // createCmd represents the create command.
@@ -42,6 +46,11 @@ such as provider, credentials, instance type, image, region and zone.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		createRequest.Name = args[0]
 
+		err := validateTunnelMachineName(createRequest.Name)
+		if err != nil {
+			return err
+		}
+
 		providerName, err := cmd.Flags().GetString("provider")
 		if err != nil {
 			return err
@@ -57,12 +66,59 @@ such as provider, credentials, instance type, image, region and zone.`,
 			return err
 		}
 
+		modelCacheCredentials, err := cmd.Flags().GetString("model-cache")
+		if err != nil {
+			return err
+		}
+
+		if modelCacheCredentials != "" {
+			modelCacheBucket, err := cmd.Flags().GetString("model-cache-bucket")
+			if err != nil {
+				return err
+			}
+
+			if modelCacheBucket == "" {
+				return errors.New("--model-cache-bucket is required when using a model cache")
+			}
+
+			modelCachePrefix, err := cmd.Flags().GetString("model-cache-prefix")
+			if err != nil {
+				return err
+			}
+
+			createOpts.ModelCache = &machine.ModelCacheConfig{
+				CredentialsName: modelCacheCredentials,
+				Bucket:          modelCacheBucket,
+				Prefix:          modelCachePrefix,
+			}
+		}
+
+		createOpts.ExpiresAt, err = expiryFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		ollamaEnv, err := cmd.Flags().GetStringArray("ollama-env")
+		if err != nil {
+			return err
+		}
+
+		createOpts.OllamaEnv, err = parseAssignments(ollamaEnv)
+		if err != nil {
+			return err
+		}
+
+		connectivityProvider, err := connectivitySelector.Provider()
+		if err != nil {
+			return err
+		}
+
 		prov, err := provisioner.NewProvisioner(providerName, credentialsName, region)
 		if err != nil {
 			return fmt.Errorf("failed to create provisioner: %w", err)
 		}
 
-		err = prov.CreateMachine(cmd.Context(), createRequest, connectivityOpts)
+		err = prov.CreateMachine(cmd.Context(), createRequest, connectivityProvider, createOpts)
 		if err != nil {
 			return err
 		}
@@ -71,6 +127,35 @@ such as provider, credentials, instance type, image, region and zone.`,
 	},
 }
 
+// expiryFromFlags returns the expiry date of the machine set by the --ttl or --expires-at flags, if any.
+func expiryFromFlags(cmd *cobra.Command) (*time.Time, error) {
+	ttl, err := cmd.Flags().GetDuration("ttl")
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := cmd.Flags().GetString("expires-at")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ttl != 0:
+		result := time.Now().Add(ttl)
+
+		return &result, nil
+	case expiresAt != "":
+		result, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --expires-at value, expected a RFC 3339 date such as 2025-01-26T20:00:00Z: %w", err)
+		}
+
+		return &result, nil
+	default:
+		return nil, nil //nolint:nilnil
+	}
+}
+
 func init() {
 	createCmd.Flags().StringP("credentials", "c", "", "The cloud provider credentials to use")
 	_ = createCmd.MarkFlagRequired("credentials")
@@ -84,7 +169,20 @@ func init() {
 	createCmd.Flags().StringVarP(&createRequest.Image, "image", "i", "", "The image to use for the instance")
 	createCmd.Flags().StringVarP(&createRequest.Zone, "zone", "z", "", "The zone in the region where the instance will be spawned")
 
+	// Ollama specific flags
+	createCmd.Flags().StringArrayVar(&createOpts.Models, "model", nil, "A model to pull once Ollama is ready, can be repeated")
+	createCmd.Flags().BoolVar(&createOpts.WarmModels, "warm-models", false, "Load the pulled models into memory once they are pulled")
+	createCmd.Flags().StringVar(&createOpts.OllamaVersion, "ollama-version", "", "The Ollama version to install, such as 0.5.7 (defaults to the latest version)")
+	createCmd.Flags().StringArray("ollama-env", []string{}, "An environment variable of the Ollama server as KEY=VALUE, such as OLLAMA_KEEP_ALIVE=1h (can be repeated)")
+	createCmd.Flags().DurationVar(&createOpts.IdleTimeout, "idle-timeout", 0, "Shut the machine down after this duration without Ollama activity, such as 30m (disabled by default)")
+	createCmd.Flags().Duration("ttl", 0, "The duration after which the machine expires and is stopped or deleted by the reap command, such as 8h")
+	createCmd.Flags().String("expires-at", "", "The date after which the machine expires and is stopped or deleted by the reap command, in RFC 3339 format")
+	createCmd.MarkFlagsMutuallyExclusive("ttl", "expires-at")
+	createCmd.Flags().BoolVar(&createOpts.AllowCPU, "allow-cpu", false, "Allow Ollama to run on CPU, instead of failing when no GPU is detected")
+	createCmd.Flags().String("model-cache", "", "The name of the s3 credentials of the object storage used as a model cache")
+	createCmd.Flags().String("model-cache-bucket", "", "The bucket used as a model cache")
+	createCmd.Flags().String("model-cache-prefix", "", "The path prefix of models in the model cache bucket")
+
 	// Networking customization flags
-	createCmd.Flags().BoolVar(&connectivityOpts.Public, "public", false, "Defines if the Ollama instance should be publicly exposed or not (not recommended), if set false you can use SSH tunnel or tailscale to connect to your Ollama instance.")
-	createCmd.Flags().StringVar(&connectivityOpts.TailscaleAuthKey, "tailscale-auth-key", "", "The Tailscale authentication key to use for the instance")
+	connectivitySelector.RegisterFlags(createCmd.Flags())
 }
@@ -70,13 +70,11 @@ var credentialsCreateCmd = &cobra.Command{
 			return err
 		}
 
-		provider, found := registry.Providers[providerName]
+		providerCredentials, found := registry.GetCredentials(providerName)
 		if !found {
 			return fmt.Errorf("provider %q not found", providerName)
 		}
 
-		providerCredentials := provider.Credentials()
-
 		err = providerCredentials.Complete()
 		if err != nil {
 			return err
@@ -130,7 +128,7 @@ var credentialsRemoveCmd = &cobra.Command{
 }
 
 func init() {
-	credentialsCmd.PersistentFlags().StringP("provider", "p", "", "The provider to use for the credential")
+	credentialsCmd.PersistentFlags().StringP("provider", "p", "", "The provider (or service, such as s3) to use for the credential")
 
 	// Register flags for each provider.
 	for providerName, provider := range registry.Providers {
@@ -142,6 +140,16 @@ func init() {
 		credentialsCreateCmd.Flags().AddFlagSet(sub)
 	}
 
+	// Register flags for each service.
+	for serviceName, credentials := range registry.ServiceCredentials {
+		sub := pflag.NewFlagSet(serviceName, pflag.ContinueOnError)
+		sub.SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+			return pflag.NormalizedName(serviceName + "-" + name)
+		})
+		credentials.RegisterFlags(sub)
+		credentialsCreateCmd.Flags().AddFlagSet(sub)
+	}
+
 	_ = credentialsCreateCmd.MarkFlagRequired("provider")
 	_ = credentialsRemoveCmd.MarkFlagRequired("provider")
 
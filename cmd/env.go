@@ -18,23 +18,29 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"text/template"
 
+	"github.com/alexandrevilain/ollama-machine/pkg/config"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/tunnel"
 	"github.com/docker/machine/libmachine/shell"
 	"github.com/spf13/cobra"
 )
 
 const (
-	envTmpl = `{{ .Prefix }}OLLAMA_HOST{{ .Delimiter }}{{ .OllamaHost }}{{ .Suffix }}`
+	envTmpl = `{{ range .Variables }}{{ $.Prefix }}{{ .Key }}{{ $.Delimiter }}{{ .Value }}{{ $.Suffix }}{{ end }}`
 )
 
 type ShellConfig struct {
-	Prefix     string
-	Delimiter  string
-	Suffix     string
-	OllamaHost string
+	Prefix    string
+	Delimiter string
+	Suffix    string
+	Variables []envfile.Variable
 }
 
 // envCmd represents the env command.
@@ -56,7 +62,45 @@ var envCmd = &cobra.Command{
 		}
 
 		shellCfg := ShellConfig{
-			OllamaHost: m.OllamaConfig.Address(),
+			Variables: []envfile.Variable{{Key: "OLLAMA_HOST", Value: m.OllamaConfig.Address()}},
+		}
+
+		if m.PublicTLS != nil {
+			shellCfg.Variables = []envfile.Variable{
+				{Key: "OLLAMA_HOST", Value: m.OllamaConfig.URL().String()},
+				{Key: "OLLAMA_MACHINE_TOKEN", Value: m.PublicTLS.Token},
+			}
+
+			if m.PublicTLS.CertificateFingerprint != "" {
+				shellCfg.Variables = append(shellCfg.Variables, envfile.Variable{Key: "OLLAMA_MACHINE_CERT_FINGERPRINT", Value: m.PublicTLS.CertificateFingerprint})
+			}
+		}
+
+		if m.Cloudflare != nil {
+			shellCfg.Variables = []envfile.Variable{{Key: "OLLAMA_HOST", Value: m.OllamaConfig.URL().String()}}
+
+			if m.Cloudflare.AccessClientID != "" {
+				shellCfg.Variables = append(shellCfg.Variables,
+					envfile.Variable{Key: "OLLAMA_MACHINE_ACCESS_CLIENT_ID", Value: m.Cloudflare.AccessClientID},
+					envfile.Variable{Key: "OLLAMA_MACHINE_ACCESS_CLIENT_SECRET", Value: m.Cloudflare.AccessClientSecret},
+				)
+			}
+		}
+
+		// Tunnels serve Ollama locally, so the active one is preferred over the machine address.
+		// The embedded Tailscale node only lives in the CLI process, so it is only reachable through a tunnel.
+		state, err := tunnel.NewStore(config.GetTunnelDir()).Get(m.Name)
+		switch {
+		case err == nil:
+			shellCfg.Variables = []envfile.Variable{{Key: "OLLAMA_HOST", Value: fmt.Sprintf("localhost:%d", state.LocalPort)}}
+		case !errors.Is(err, tunnel.ErrNotRunning):
+			return err
+		default:
+			if _, ok := m.EmbeddedTailscaleNode(); ok {
+				shellCfg.Variables = []envfile.Variable{{Key: "OLLAMA_HOST", Value: fmt.Sprintf("localhost:%d", ollama.DefaultPort)}}
+
+				fmt.Fprintf(os.Stderr, "# Run \"ollama-machine tunnel --detach %s\" to reach the machine through the embedded Tailscale node.\n", m.Name)
+			}
 		}
 
 		switch shell {
@@ -0,0 +1,162 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/internal/gateway"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/tunnel"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+// gatewayCmd represents the gateway command.
+var gatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "Serve a single Ollama endpoint load-balancing requests across machines",
+	Long: `Serve a single Ollama endpoint load-balancing requests across machines.
+
+Requests are routed to the machines which already loaded the requested model, then to the least busy ones.
+Machines are health checked periodically, and requests failing to reach a machine are retried on another one.
+SSH connections to machines are restored when lost.
+Listing models returns the models of all machines.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		machineNames, err := cmd.Flags().GetStringSlice("machines")
+		if err != nil {
+			return err
+		}
+
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+
+		healthCheckInterval, err := cmd.Flags().GetDuration("health-check-interval")
+		if err != nil {
+			return err
+		}
+
+		backends := []gateway.Backend{}
+		closers := []func() error{}
+
+		defer func() {
+			for _, closeFn := range closers {
+				_ = closeFn()
+			}
+		}()
+
+		var forwarders sync.WaitGroup
+		defer forwarders.Wait()
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		for _, name := range machineNames {
+			m, err := machine.GetByName(name)
+			if err != nil {
+				return err
+			}
+
+			if m.OllamaThroughSSH() {
+				baseURL, err := forwardOllama(ctx, &forwarders, m)
+				if err != nil {
+					return fmt.Errorf("failed to connect to machine %s: %w", name, err)
+				}
+
+				backends = append(backends, gateway.Backend{Name: name, BaseURL: baseURL, HTTPClient: &http.Client{}})
+
+				continue
+			}
+
+			baseURL, httpClient, closeFn, err := m.OllamaHTTPClient()
+			if err != nil {
+				return fmt.Errorf("failed to connect to machine %s: %w", name, err)
+			}
+
+			closers = append(closers, closeFn)
+			backends = append(backends, gateway.Backend{Name: name, BaseURL: baseURL, HTTPClient: httpClient})
+		}
+
+		if len(backends) == 0 {
+			return errors.New("at least one machine is required")
+		}
+
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+
+		log.Info("Gateway listening", "address", listener.Addr().String(), "machines", machineNames)
+
+		return gateway.New(backends).Serve(ctx, listener, healthCheckInterval)
+	},
+}
+
+// forwardOllama forwards a local port to the Ollama API of the machine through SSH until the context is done,
+// and returns its base URL. The SSH connection is restored when lost, so the machine recovers once reachable again.
+func forwardOllama(ctx context.Context, forwarders *sync.WaitGroup, m *machine.Machine) (*url.URL, error) {
+	forwarder := &tunnel.Forwarder{
+		RemoteAddr: m.OllamaConfig.Address(),
+		Connect:    sshConnect(m),
+	}
+
+	err := forwarder.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = forwarder.Close()
+
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	forwarders.Add(1)
+
+	go func() {
+		defer forwarders.Done()
+
+		err := forwarder.Serve(ctx, listener)
+		if err != nil {
+			log.Error("Failed to forward connections to the machine", "machine", m.Name, "err", err)
+		}
+	}()
+
+	return &url.URL{Scheme: "http", Host: listener.Addr().String()}, nil
+}
+
+func init() {
+	gatewayCmd.Flags().StringSlice("machines", nil, "The machines to route requests to, separated by commas")
+	_ = gatewayCmd.MarkFlagRequired("machines")
+	gatewayCmd.Flags().String("listen", "localhost:11434", "The address the gateway listens on")
+	gatewayCmd.Flags().Duration("health-check-interval", 10*time.Second, "The interval between machines health checks") //nolint:mnd
+}
@@ -0,0 +1,96 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/gpu"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const clearScreen = "\x1b[H\x1b[2J"
+
+// gpuCmd represents the gpu command.
+var gpuCmd = &cobra.Command{
+	Use:   "gpu [machine name]",
+	Short: "Show the GPUs of a machine with their utilisation and memory",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			return err
+		}
+
+		interval, err := cmd.Flags().GetDuration("interval")
+		if err != nil {
+			return err
+		}
+
+		return withSSHClient(args[0], func(client *gossh.Client) error {
+			for {
+				devices, err := gpu.Query(client)
+				if err != nil {
+					return err
+				}
+
+				if watch {
+					fmt.Print(clearScreen)
+				}
+
+				printGPUs(devices)
+
+				if !watch {
+					return nil
+				}
+
+				select {
+				case <-cmd.Context().Done():
+					return nil
+				case <-time.After(interval):
+				}
+			}
+		})
+	},
+}
+
+func printGPUs(devices []gpu.Device) {
+	table := uitable.New()
+	table.MaxColWidth = 50
+
+	table.AddRow("INDEX", "NAME", "UTILISATION", "MEMORY", "DRIVER")
+	for _, device := range devices {
+		table.AddRow(
+			device.Index,
+			device.Name,
+			fmt.Sprintf("%d%%", device.Utilization),
+			fmt.Sprintf("%d MiB / %d MiB", device.MemoryUsed, device.MemoryTotal),
+			device.DriverVersion,
+		)
+	}
+
+	fmt.Println(table)
+}
+
+func init() {
+	gpuCmd.Flags().BoolP("watch", "w", false, "Refresh the report until interrupted")
+	gpuCmd.Flags().Duration("interval", 2*time.Second, "The refresh interval when watching") //nolint:mnd
+}
@@ -19,6 +19,7 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
 	"github.com/gosuri/uitable"
@@ -39,9 +40,11 @@ var lsCmd = &cobra.Command{
 		table := uitable.New()
 		table.MaxColWidth = 50
 
-		table.AddRow("NAME", "STATE", "PROVIDER", "REGION", "IP", "OLLAMA HOST", "OLLAMA PORT")
+		now := time.Now()
+
+		table.AddRow("NAME", "STATE", "PROVIDER", "REGION", "IP", "OLLAMA HOST", "OLLAMA PORT", "OLLAMA VERSION", "GPU", "EXPIRES IN")
 		for _, machine := range machines {
-			table.AddRow(machine.Name, machine.State, machine.ProviderName, machine.Region, machine.IP, machine.OllamaConfig.Host, machine.OllamaConfig.Port)
+			table.AddRow(machine.Name, machine.State, machine.ProviderName, machine.Region, machine.IP, machine.OllamaConfig.Host, machine.OllamaConfig.Port, machine.OllamaVersion, machine.GPU, machine.RemainingTime(now))
 		}
 
 		fmt.Println(table)
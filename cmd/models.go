@@ -0,0 +1,335 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/internal/progress"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/modelcache"
+	"github.com/alexandrevilain/ollama-machine/pkg/modelstore"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/charmbracelet/log"
+	"github.com/gosuri/uitable"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// modelsCmd represents the models command.
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "Manage models on a machine",
+	Long: `Manage the models of the Ollama instance running on a machine.
+
+Commands talk to the remote Ollama API through the machine connectivity.
+Machines with private connectivity are reached through SSH, so no tunnel nor local ollama binary is required.`,
+}
+
+var modelsListCmd = &cobra.Command{
+	Use:     "list [machine name]",
+	Aliases: []string{"ls"},
+	Short:   "List models available on a machine",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withOllamaClient(args[0], func(client *ollama.Client) error {
+			models, err := client.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			table := uitable.New()
+			table.MaxColWidth = 50
+
+			table.AddRow("NAME", "ID", "SIZE", "MODIFIED")
+			for _, model := range models {
+				table.AddRow(model.Name, shortDigest(model.Digest), progress.FormatBytes(model.Size), model.ModifiedAt.Format(time.DateTime))
+			}
+			fmt.Println(table)
+
+			return nil
+		})
+	},
+}
+
+var modelsPullCmd = &cobra.Command{
+	Use:   "pull [machine name] [model]...",
+	Short: "Pull models on a machine",
+	Args:  cobra.MinimumNArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		if m.ModelCache != nil {
+			log.Info("Restoring models from model cache")
+
+			err = withSSHClient(args[0], func(client *gossh.Client) error {
+				return modelcache.Restore(client, args[1:])
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err = withOllamaClient(args[0], func(client *ollama.Client) error {
+			for _, model := range args[1:] {
+				log.Info("Pulling model", "model", model)
+
+				bar := progress.NewBar(os.Stderr)
+				err := client.Pull(cmd.Context(), model, func(resp ollama.ProgressResponse) {
+					bar.Update(resp.Status, resp.Completed, resp.Total)
+				})
+				bar.Done()
+
+				if err != nil {
+					return fmt.Errorf("failed to pull model %s: %w", model, err)
+				}
+			}
+
+			return nil
+		})
+		if err != nil || m.ModelCache == nil {
+			return err
+		}
+
+		log.Info("Uploading models to model cache")
+
+		return withSSHClient(args[0], modelcache.Save)
+	},
+}
+
+var modelsRemoveCmd = &cobra.Command{
+	Use:     "remove [machine name] [model]...",
+	Aliases: []string{"rm"},
+	Short:   "Remove models from a machine",
+	Args:    cobra.MinimumNArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withOllamaClient(args[0], func(client *ollama.Client) error {
+			for _, model := range args[1:] {
+				err := client.Delete(cmd.Context(), model)
+				if err != nil {
+					return fmt.Errorf("failed to remove model %s: %w", model, err)
+				}
+
+				log.Info("Model removed", "model", model)
+			}
+
+			return nil
+		})
+	},
+}
+
+var modelsShowCmd = &cobra.Command{
+	Use:   "show [machine name] [model]",
+	Short: "Show information about a model on a machine",
+	Args:  cobra.ExactArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showModelfile, err := cmd.Flags().GetBool("modelfile")
+		if err != nil {
+			return err
+		}
+
+		return withOllamaClient(args[0], func(client *ollama.Client) error {
+			resp, err := client.Show(cmd.Context(), args[1])
+			if err != nil {
+				return err
+			}
+
+			if showModelfile {
+				fmt.Println(resp.Modelfile)
+
+				return nil
+			}
+
+			table := uitable.New()
+			table.MaxColWidth = 80
+
+			table.AddRow("Family", resp.Details.Family)
+			table.AddRow("Parameters", resp.Details.ParameterSize)
+			table.AddRow("Quantization", resp.Details.QuantizationLevel)
+			table.AddRow("Format", resp.Details.Format)
+			if contextLength, ok := resp.ModelInfo[resp.Details.Family+".context_length"]; ok {
+				table.AddRow("Context length", contextLength)
+			}
+			if len(resp.Capabilities) > 0 {
+				table.AddRow("Capabilities", strings.Join(resp.Capabilities, ", "))
+			}
+			if resp.Parameters != "" {
+				table.AddRow("Model parameters", resp.Parameters)
+			}
+			fmt.Println(table)
+
+			return nil
+		})
+	},
+}
+
+var modelsPsCmd = &cobra.Command{
+	Use:   "ps [machine name]",
+	Short: "List models loaded in memory on a machine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withOllamaClient(args[0], func(client *ollama.Client) error {
+			models, err := client.ListRunning(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			table := uitable.New()
+			table.MaxColWidth = 50
+
+			table.AddRow("NAME", "ID", "SIZE", "PROCESSOR", "UNTIL")
+			for _, model := range models {
+				table.AddRow(model.Name, shortDigest(model.Digest), progress.FormatBytes(model.Size), model.Processor(), model.ExpiresAt.Format(time.DateTime))
+			}
+			fmt.Println(table)
+
+			return nil
+		})
+	},
+}
+
+var modelsPushCmd = &cobra.Command{
+	Use:   "push [machine name] [model]...",
+	Short: "Push models from the local Ollama store to a machine",
+	Long: `Push models from the local Ollama store to a machine.
+
+Models are read from the local Ollama store (~/.ollama/models, or $OLLAMA_MODELS when set) and copied over SSH.
+Blobs already present on the machine are skipped.`,
+	Args: cobra.MinimumNArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		localRoot, err := modelstore.DefaultPath()
+		if err != nil {
+			return err
+		}
+
+		return withSSHClient(args[0], func(client *gossh.Client) error {
+			for _, model := range args[1:] {
+				name, err := modelstore.ParseName(model)
+				if err != nil {
+					return err
+				}
+
+				log.Info("Pushing model", "model", name)
+
+				bar := progress.NewBar(os.Stderr)
+				err = modelstore.Push(client, localRoot, name, bar.Update)
+				bar.Done()
+
+				if err != nil {
+					return fmt.Errorf("failed to push model %s: %w", name, err)
+				}
+			}
+
+			return nil
+		})
+	},
+}
+
+var modelsCreateCmd = &cobra.Command{
+	Use:   "create [machine name] [model]",
+	Short: "Create a model on a machine from a Modelfile",
+	Long: `Create a model on a machine from a local Modelfile.
+
+Local files referenced by the FROM and ADAPTER instructions (GGUF files, Safetensors directories, adapters) are uploaded along with the Modelfile.`,
+	Args: cobra.ExactArgs(2), //nolint:mnd
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modelfilePath, err := cmd.Flags().GetString("file")
+		if err != nil {
+			return err
+		}
+
+		return withSSHClient(args[0], func(client *gossh.Client) error {
+			log.Info("Creating model", "model", args[1])
+
+			return modelstore.Create(client, modelfilePath, args[1], os.Stderr)
+		})
+	},
+}
+
+// withOllamaClient calls fn with an Ollama API client reaching the given machine.
+func withOllamaClient(machineName string, fn func(client *ollama.Client) error) error {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return err
+	}
+
+	client, closeClient, err := m.OllamaClient()
+	if err != nil {
+		return fmt.Errorf("failed to create ollama client: %w", err)
+	}
+
+	defer func() {
+		if closeErr := closeClient(); closeErr != nil {
+			log.Error("failed to close ollama client", "err", closeErr)
+		}
+	}()
+
+	return fn(client)
+}
+
+// withSSHClient calls fn with an SSH client connected to the given machine.
+func withSSHClient(machineName string, fn func(client *gossh.Client) error) error {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		if closeErr := client.Close(); closeErr != nil {
+			log.Error("failed to close ssh connection", "err", closeErr)
+		}
+	}()
+
+	return fn(client)
+}
+
+// shortDigest returns the digest without its algorithm, truncated as the ollama CLI does.
+func shortDigest(digest string) string {
+	const length = 12
+
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > length {
+		return digest[:length]
+	}
+
+	return digest
+}
+
+func init() {
+	modelsShowCmd.Flags().Bool("modelfile", false, "Show the Modelfile of the model")
+	modelsCreateCmd.Flags().StringP("file", "f", "Modelfile", "The path of the Modelfile")
+
+	modelsCmd.AddCommand(modelsListCmd)
+	modelsCmd.AddCommand(modelsPullCmd)
+	modelsCmd.AddCommand(modelsRemoveCmd)
+	modelsCmd.AddCommand(modelsShowCmd)
+	modelsCmd.AddCommand(modelsPsCmd)
+	modelsCmd.AddCommand(modelsPushCmd)
+	modelsCmd.AddCommand(modelsCreateCmd)
+}
@@ -0,0 +1,301 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"github.com/alexandrevilain/ollama-machine/internal/openai"
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const defaultOpenAIPort = 8080
+
+// openaiCmd represents the openai command.
+var openaiCmd = &cobra.Command{
+	Use:   "openai",
+	Short: "Serve an OpenAI-compatible endpoint of a machine protected by API keys",
+	Long: `Serve the /v1/chat/completions, /v1/embeddings and /v1/models endpoints of a machine, protected by API keys.
+
+API keys are managed using the apikey command. The endpoint can either run locally, next to the tunnel,
+or on the machine itself.`,
+}
+
+var openaiStartCmd = &cobra.Command{
+	Use:   "start [machine name]",
+	Short: "Serve the OpenAI-compatible endpoint of a machine locally",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		baseURL, httpClient, closeFn, err := m.OllamaHTTPClient()
+		if err != nil {
+			return fmt.Errorf("failed to connect to machine: %w", err)
+		}
+
+		defer func() {
+			_ = closeFn()
+		}()
+
+		server := openai.NewServer(baseURL, httpClient, func() ([]apikey.Key, error) {
+			// Reload the machine, so keys created or revoked meanwhile are taken into account.
+			m, err := machine.GetByName(args[0])
+			if err != nil {
+				return nil, err
+			}
+
+			return m.APIKeys, nil
+		})
+
+		return serveOpenAI(cmd, server, listen)
+	},
+}
+
+var openaiInstallCmd = &cobra.Command{
+	Use:   "install [machine name]",
+	Short: "Run the OpenAI-compatible endpoint on the machine itself",
+	Long: `Run the OpenAI-compatible endpoint on the machine itself.
+
+The ollama-machine binary is copied to the machine and runs as a systemd service, listening where Ollama does.
+With the public-tls connectivity, it is served over HTTPS by the reverse proxy, under /v1/.
+The public connectivity is refused, as API keys would be sent in clear text.
+When the machine architecture differs from the local one, provide a Linux build of ollama-machine using the --binary flag.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			return err
+		}
+
+		binaryPath, err := cmd.Flags().GetString("binary")
+		if err != nil {
+			return err
+		}
+
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		connectivityProvider := connectivity.ForMachine(m)
+
+		// API keys would be sent in clear text over the Internet.
+		if connectivity.ExposesOllama(connectivityProvider) {
+			return fmt.Errorf("the %s connectivity doesn't use TLS, switch to the public-tls connectivity using the connectivity set command first", connectivityProvider.Name())
+		}
+
+		// The endpoint listens where Ollama does: only the connectivity, or its reverse proxy, can reach it.
+		upstream := connectivity.LocalOllamaURL(connectivityProvider, m)
+		listen := net.JoinHostPort(upstream.Hostname(), strconv.Itoa(port))
+
+		err = withSSHClient(m.Name, func(client *gossh.Client) error {
+			binaryPath, err = resolveRemoteBinary(client, binaryPath)
+			if err != nil {
+				return err
+			}
+
+			binary, err := os.Open(binaryPath)
+			if err != nil {
+				return fmt.Errorf("failed to open ollama-machine binary: %w", err)
+			}
+
+			defer func() {
+				_ = binary.Close()
+			}()
+
+			log.Info("Installing OpenAI-compatible endpoint", "listen", listen)
+
+			return openai.Install(client, binary, m.APIKeys, listen, upstream.String())
+		})
+		if err != nil {
+			return err
+		}
+
+		m.OpenAI = &machine.OpenAIConfig{Port: port}
+
+		err = saveOpenAIExposure(cmd, m)
+		if err != nil {
+			return err
+		}
+
+		if len(m.APIKeys) == 0 {
+			log.Warn("The machine has no API key yet, create one using the apikey create command")
+		}
+
+		endpointURL := "http://" + listen + "/v1"
+		if _, ok := connectivityProvider.(connectivity.OpenAIRouter); ok {
+			endpointURL = m.OllamaConfig.URL().JoinPath("v1").String()
+		}
+
+		log.Info("OpenAI-compatible endpoint ready", "url", endpointURL)
+
+		return nil
+	},
+}
+
+var openaiUninstallCmd = &cobra.Command{
+	Use:   "uninstall [machine name]",
+	Short: "Remove the OpenAI-compatible endpoint from the machine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := machine.GetByName(args[0])
+		if err != nil {
+			return err
+		}
+
+		err = withSSHClient(m.Name, openai.Uninstall)
+		if err != nil {
+			return err
+		}
+
+		m.OpenAI = nil
+
+		err = saveOpenAIExposure(cmd, m)
+		if err != nil {
+			return err
+		}
+
+		log.Info("OpenAI-compatible endpoint removed")
+
+		return nil
+	},
+}
+
+// openaiServeCmd runs the OpenAI-compatible endpoint on machines.
+var openaiServeCmd = &cobra.Command{
+	Use:    "serve",
+	Short:  "Serve the OpenAI-compatible endpoint of an Ollama server",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		upstream, err := cmd.Flags().GetString("upstream")
+		if err != nil {
+			return err
+		}
+
+		keysFile, err := cmd.Flags().GetString("keys-file")
+		if err != nil {
+			return err
+		}
+
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+
+		upstreamURL, err := url.Parse(upstream)
+		if err != nil {
+			return fmt.Errorf("invalid upstream: %w", err)
+		}
+
+		server := openai.NewServer(upstreamURL, nil, func() ([]apikey.Key, error) {
+			return apikey.ReadFile(keysFile)
+		})
+
+		return serveOpenAI(cmd, server, listen)
+	},
+}
+
+func serveOpenAI(cmd *cobra.Command, server *openai.Server, listen string) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Info("OpenAI-compatible endpoint listening", "url", "http://"+listener.Addr().String()+"/v1")
+
+	return server.Serve(ctx, listener)
+}
+
+// resolveRemoteBinary returns the path of the ollama-machine binary to copy to the machine.
+// The current executable is used when it can run on the machine.
+func resolveRemoteBinary(client *gossh.Client, binaryPath string) (string, error) {
+	if binaryPath != "" {
+		return binaryPath, nil
+	}
+
+	arch, err := openai.RemoteArch(client)
+	if err != nil {
+		return "", err
+	}
+
+	if runtime.GOOS != "linux" || runtime.GOARCH != arch {
+		return "", fmt.Errorf("the local ollama-machine binary can't run on the machine (linux/%s), provide one using the --binary flag", arch)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return "", errors.Join(err, errors.New("failed to find the ollama-machine binary, provide one using the --binary flag"))
+	}
+
+	return executable, nil
+}
+
+// saveOpenAIExposure saves the machine, then updates how Ollama and the endpoint are exposed by the machine.
+func saveOpenAIExposure(cmd *cobra.Command, m *machine.Machine) error {
+	err := machine.Save(m)
+	if err != nil {
+		return fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	p, err := provisioner.NewProvisionerForMachine(m.Name)
+	if err != nil {
+		return err
+	}
+
+	return p.UpdateOpenAIExposure(cmd.Context(), m.Name)
+}
+
+func init() {
+	openaiStartCmd.Flags().String("listen", "localhost:"+strconv.Itoa(defaultOpenAIPort), "The address the endpoint listens on")
+	openaiInstallCmd.Flags().Int("port", defaultOpenAIPort, "The port the endpoint listens on, on the machine")
+	openaiInstallCmd.Flags().String("binary", "", "The path of a Linux ollama-machine binary matching the machine architecture (defaults to the current one)")
+	openaiServeCmd.Flags().String("upstream", "http://127.0.0.1:11434", "The URL of the Ollama API")
+	openaiServeCmd.Flags().String("keys-file", openai.RemoteKeysPath, "The path of the API keys file")
+	openaiServeCmd.Flags().String("listen", ":"+strconv.Itoa(defaultOpenAIPort), "The address the endpoint listens on")
+
+	openaiCmd.AddCommand(openaiStartCmd)
+	openaiCmd.AddCommand(openaiInstallCmd)
+	openaiCmd.AddCommand(openaiUninstallCmd)
+	openaiCmd.AddCommand(openaiServeCmd)
+}
@@ -0,0 +1,82 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/internal/proxy"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+// proxyCmd represents the proxy command.
+var proxyCmd = &cobra.Command{
+	Use:   "proxy [machine name]",
+	Short: "Serve the Ollama API of a machine locally, starting and stopping it on demand",
+	Long: `Serve the Ollama API of a machine locally, starting and stopping it on demand.
+
+Requests received while the machine is stopped start it, and are held until Ollama is ready.
+Requests fail with a 503 status when the machine isn't ready within the start timeout.
+The machine is stopped once no request was received for the idle timeout.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return err
+		}
+
+		idleTimeout, err := cmd.Flags().GetDuration("idle-timeout")
+		if err != nil {
+			return err
+		}
+
+		startTimeout, err := cmd.Flags().GetDuration("start-timeout")
+		if err != nil {
+			return err
+		}
+
+		backend, err := proxy.NewMachineBackend(args[0])
+		if err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		log.Info("Proxy listening", "address", listener.Addr().String(), "machine", args[0], "idleTimeout", idleTimeout)
+
+		return proxy.New(backend, idleTimeout, startTimeout).Serve(ctx, listener)
+	},
+}
+
+func init() {
+	proxyCmd.Flags().String("listen", "localhost:11434", "The address the proxy listens on")
+	proxyCmd.Flags().Duration("idle-timeout", 15*time.Minute, "The duration without requests after which the machine is stopped") //nolint:mnd
+	proxyCmd.Flags().Duration("start-timeout", proxy.DefaultStartTimeout, "The maximum duration to wait for the machine to start and Ollama to be ready")
+}
@@ -0,0 +1,97 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+// reapCmd represents the reap command.
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Stop or delete expired machines",
+	Long: `Stop or delete the machines whose expiry date, set using the --ttl or --expires-at flags of the create command, is over.
+
+Machines are stopped by default, use the --delete flag to delete them instead.
+Machines of all providers are reaped using their stored credentials, so this command can be run periodically using cron.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deleteMachines, err := cmd.Flags().GetBool("delete")
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+
+		machines, err := machine.List()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		var errs []error
+		for _, m := range machines {
+			if !m.Expired(now) || (!deleteMachines && m.State == provider.MachineStateStopped) {
+				continue
+			}
+
+			log.Info("Machine expired", "machine", m.Name, "expiresAt", m.ExpiresAt.Format(time.RFC3339))
+
+			if dryRun {
+				continue
+			}
+
+			err := reapMachine(cmd, m.Name, deleteMachines)
+			if err != nil {
+				log.Error("Failed to reap machine", "machine", m.Name, "err", err)
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	},
+}
+
+func reapMachine(cmd *cobra.Command, machineName string, deleteMachine bool) error {
+	prov, err := provisioner.NewProvisionerForMachine(machineName)
+	if err != nil {
+		return err
+	}
+
+	if deleteMachine {
+		return prov.DeleteMachine(cmd.Context(), machineName)
+	}
+
+	return prov.StopMachine(cmd.Context(), machineName)
+}
+
+func init() {
+	reapCmd.Flags().Bool("delete", false, "Delete expired machines instead of stopping them")
+	reapCmd.Flags().Bool("dry-run", false, "Only list expired machines")
+}
@@ -0,0 +1,66 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+// reconcileCmd represents the reconcile command.
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile [machine name]...",
+	Short: "Sync machines state with their cloud provider",
+	Long: `Sync machines state with their cloud provider.
+
+Machines which shut themselves down, for instance after being idle, are stopped through their cloud provider,
+as shutting an instance down from the inside doesn't stop billing on all clouds.
+When no machine name is given, all machines are reconciled.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := args
+		if len(names) == 0 {
+			machines, err := machine.List()
+			if err != nil {
+				return err
+			}
+
+			for _, m := range machines {
+				names = append(names, m.Name)
+			}
+		}
+
+		var errs []error
+		for _, name := range names {
+			prov, err := provisioner.NewProvisionerForMachine(name)
+			if err == nil {
+				err = prov.ReconcileMachine(cmd.Context(), name)
+			}
+
+			if err != nil {
+				log.Error("Failed to reconcile machine", "machine", name, "err", err)
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	},
+}
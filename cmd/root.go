@@ -21,6 +21,7 @@ import (
 	"os"
 
 	"github.com/alexandrevilain/ollama-machine/pkg/config"
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
 )
@@ -47,8 +48,25 @@ func Execute() {
 	rootCmd.AddCommand(tunnelCmd)
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(modelsCmd)
+	rootCmd.AddCommand(gpuCmd)
+	rootCmd.AddCommand(upgradeCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(reconcileCmd)
+	rootCmd.AddCommand(reapCmd)
+	rootCmd.AddCommand(proxyCmd)
+	rootCmd.AddCommand(gatewayCmd)
+	rootCmd.AddCommand(apikeyCmd)
+	rootCmd.AddCommand(openaiCmd)
+	rootCmd.AddCommand(connectivityCmd)
 
 	err = rootCmd.Execute()
+
+	closeErr := tailscale.CloseEmbeddedNodes()
+	if closeErr != nil {
+		log.Error("Failed to close embedded Tailscale node", "err", closeErr)
+	}
+
 	if err != nil {
 		os.Exit(1)
 	}
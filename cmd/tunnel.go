@@ -18,21 +18,32 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/alexandrevilain/ollama-machine/pkg/config"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
 	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
+	"github.com/alexandrevilain/ollama-machine/pkg/tunnel"
 	"github.com/charmbracelet/log"
+	"github.com/gosuri/uitable"
 	"github.com/spf13/cobra"
-	gossh "golang.org/x/crypto/ssh"
 )
 
-var (
-	localPort  int = ollama.DefaultPort
-	remotePort int = ollama.DefaultPort
+var localPort int = ollama.DefaultPort
+
+const (
+	tunnelStartTimeout  = 30 * time.Second
+	tunnelStartInterval = 200 * time.Millisecond
+	tunnelStopTimeout   = 10 * time.Second
 )
 
 // tunnelCmd represents the tunnel command.
@@ -47,29 +58,77 @@ The tunnel command requires exactly one argument:
   - machine name: The name of the machine to establish the tunnel with.
 
 Prerequisites:
-  - The target machine must be configured with private connectivity
-  - The machine must be running and accessible via SSH on port 22
+  - The target machine must be configured with private connectivity, and be accessible via SSH on port 22,
+    or with Tailscale connectivity, when the ` + tailscale.EmbeddedAuthKeyEnv + ` environment variable holds an auth key:
+    the tunnel then joins the tailnet by itself, using an embedded Tailscale node
+  - The machine must be running
 
-The tunnel remains active until the process is interrupted (Ctrl+C).`,
+The SSH connection is kept alive, and restored when it is lost. A connection failing to reach Ollama doesn't affect the others.
+The tunnel remains active until the process is interrupted (Ctrl+C), or runs in the background with --detach.
+Open connections are given a few seconds to complete when the tunnel stops.
+Tunnels to different machines can run at the same time on different local ports.
+Running tunnels are listed by "tunnel ls" and stopped by "tunnel stop".`,
 	Args: cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error { //nolint:funlen,cyclop
 		m, err := machine.GetByName(args[0])
 		if err != nil {
 			return err
 		}
 
-		if m.Connectivity != "private" && m.Connectivity != "" {
-			return errors.New("tunneling is only available for machine with private connectivity")
+		store := tunnel.NewStore(config.GetTunnelDir())
+
+		states, err := store.List()
+		if err != nil {
+			return err
+		}
+
+		for _, state := range states {
+			if state.Machine == m.Name {
+				return fmt.Errorf("a tunnel to %s is already running on port %d", m.Name, state.LocalPort)
+			}
+
+			if state.LocalPort == localPort {
+				return fmt.Errorf("port %d is already used by the tunnel to %s, use --local-port to choose another one", localPort, state.Machine)
+			}
 		}
 
-		sshConn, _, err := m.SSHClient()
+		detach, err := cmd.Flags().GetBool("detach")
 		if err != nil {
-			return fmt.Errorf("failed to create ssh client: %w", err)
+			return err
+		}
+
+		if detach {
+			return startDetachedTunnel(cmd.Context(), store, m.Name)
+		}
+
+		var connect tunnel.ConnectFunc
+
+		if node, ok := m.EmbeddedTailscaleNode(); ok {
+			// The embedded node reconnects by itself, so it is never replaced.
+			connect = func(_ context.Context) (tunnel.Dialer, error) {
+				return embeddedDialer{node}, nil
+			}
+		} else {
+			if m.Connectivity != "private" && m.Connectivity != "" && !m.OllamaConfig.Loopback() {
+				return errors.New("tunneling is only available for machine with private connectivity, Ollama listening on the loopback interface, or Tailscale connectivity with an embedded Tailscale node")
+			}
+
+			connect = sshConnect(m)
+		}
+
+		forwarder := &tunnel.Forwarder{
+			RemoteAddr: m.OllamaConfig.Address(),
+			Connect:    connect,
+		}
+
+		err = forwarder.Open(cmd.Context())
+		if err != nil {
+			return err
 		}
 
 		defer func() {
-			if closeErr := sshConn.Close(); err != nil {
-				log.Error("failed to close ssh connection", "err", closeErr)
+			if closeErr := forwarder.Close(); closeErr != nil {
+				log.Error("failed to close tunnel connection", "err", closeErr)
 			}
 		}()
 
@@ -78,41 +137,174 @@ The tunnel remains active until the process is interrupted (Ctrl+C).`,
 			return err
 		}
 
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// The state lets env and other commands find the tunnel, it is removed once the tunnel stops.
+		err = store.Save(&tunnel.State{
+			Machine:   m.Name,
+			PID:       os.Getpid(),
+			LocalPort: localPort,
+			StartedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
 		defer func() {
-			if closeErr := listener.Close(); err != nil {
-				log.Error("failed to close listener connection", "err", closeErr)
+			if removeErr := store.Remove(m.Name, os.Getpid()); removeErr != nil {
+				log.Error("failed to remove tunnel state", "err", removeErr)
 			}
 		}()
 
-		log.Info("Tunnel available", "localPort", localPort, "remotePort", remotePort)
+		log.Info("Tunnel available", "localPort", localPort, "remoteAddr", forwarder.RemoteAddr)
+
+		err = forwarder.Serve(ctx, listener)
+		if err != nil {
+			return err
+		}
+
+		stats := forwarder.Stats()
+		log.Info("Tunnel stopped", "connections", stats.Total, "failed", stats.Failed, "reconnects", stats.Reconnects)
+
+		return nil
+	},
+}
+
+var tunnelLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List running tunnels",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		states, err := tunnel.NewStore(config.GetTunnelDir()).List()
+		if err != nil {
+			return err
+		}
+
+		table := uitable.New()
+		table.MaxColWidth = 50
+
+		now := time.Now()
 
-		for {
-			localConn, err := listener.Accept()
-			if err != nil {
-				log.Fatalf("listen.Accept failed: %v", err)
+		table.AddRow("MACHINE", "LOCAL PORT", "PID", "UPTIME")
+		for _, state := range states {
+			table.AddRow(state.Machine, state.LocalPort, state.PID, now.Sub(state.StartedAt).Round(time.Second))
+		}
+
+		fmt.Println(table)
+
+		return nil
+	},
+}
+
+var tunnelStopCmd = &cobra.Command{
+	Use:   "stop [machine name]",
+	Short: "Stop the tunnel to a machine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), tunnelStopTimeout)
+		defer cancel()
+
+		err := tunnel.NewStore(config.GetTunnelDir()).Stop(ctx, args[0])
+		if err != nil {
+			if errors.Is(err, tunnel.ErrNotRunning) {
+				return fmt.Errorf("no tunnel to %s is running", args[0])
 			}
-			go forward(sshConn, localConn, m)
+
+			return err
 		}
+
+		log.Info("Tunnel stopped", "machine", args[0])
+
+		return nil
 	},
 }
 
-func forward(sshClientConn *gossh.Client, localConn net.Conn, m *machine.Machine) {
-	sshConn, err := sshClientConn.Dial("tcp", m.OllamaConfig.Address())
+// startDetachedTunnel runs the tunnel to the given machine in a background process,
+// and waits for it to be available.
+func startDetachedTunnel(ctx context.Context, store *tunnel.Store, machineName string) error {
+	child, err := store.StartDetached(machineName, []string{"tunnel", machineName, "--local-port", strconv.Itoa(localPort)})
 	if err != nil {
-		log.Fatal("failed to dial ollama", "err", err)
+		return err
 	}
 
+	exited := make(chan error, 1)
 	go func() {
-		_, err = io.Copy(sshConn, localConn)
-		if err != nil {
-			log.Fatal("remote to local data forward failed", "err", err)
-		}
+		exited <- child.Wait()
 	}()
 
-	go func() {
-		_, err = io.Copy(localConn, sshConn)
+	ctx, cancel := context.WithTimeout(ctx, tunnelStartTimeout)
+	defer cancel()
+
+	for {
+		state, err := store.Get(machineName)
+		if err == nil && state.PID == child.Process.Pid {
+			log.Info("Tunnel running in the background", "localPort", state.LocalPort, "pid", state.PID, "logs", store.LogPath(machineName))
+
+			return nil
+		}
+
+		select {
+		case err := <-exited:
+			return fmt.Errorf("tunnel exited, see %s: %w", store.LogPath(machineName), err)
+		case <-ctx.Done():
+			_ = child.Process.Kill()
+
+			return fmt.Errorf("tunnel didn't start in time, see %s: %w", store.LogPath(machineName), ctx.Err())
+		case <-time.After(tunnelStartInterval):
+		}
+	}
+}
+
+// sshConnect returns a function connecting to the machine network through SSH, with keepalives.
+func sshConnect(m *machine.Machine) tunnel.ConnectFunc {
+	return func(_ context.Context) (tunnel.Dialer, error) {
+		sshClient, err := m.SSHDial()
 		if err != nil {
-			log.Fatal("local to remote data forward failed", "err", err)
+			return nil, fmt.Errorf("failed to create ssh client: %w", err)
 		}
-	}()
+
+		return tunnel.NewSSHDialer(sshClient, tunnel.DefaultKeepaliveInterval), nil
+	}
+}
+
+// validateTunnelMachineName returns an error if the given machine name is the name of a tunnel subcommand,
+// so the tunnel to the machine can't be created.
+func validateTunnelMachineName(name string) error {
+	for _, subcommand := range tunnelCmd.Commands() {
+		if subcommand.Name() == name || subcommand.HasAlias(name) {
+			return fmt.Errorf("machine name %q is reserved by the tunnel %s command", name, subcommand.Name())
+		}
+	}
+
+	return nil
+}
+
+// embeddedDialer dials addresses of the tailnet through an embedded Tailscale node.
+type embeddedDialer struct {
+	*tailscale.EmbeddedNode
+}
+
+// DialContext dials the given address through the embedded node.
+func (d embeddedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.Dial(ctx, network, addr)
+}
+
+// Done returns a nil channel, as the embedded node reconnects by itself.
+func (d embeddedDialer) Done() <-chan struct{} {
+	return nil
+}
+
+// Close does nothing, the embedded node is shared by the process and closed once the command ends.
+func (d embeddedDialer) Close() error {
+	return nil
+}
+
+func init() {
+	tunnelCmd.Flags().IntVarP(&localPort, "local-port", "l", ollama.DefaultPort, "The local port the tunnel listens on")
+	tunnelCmd.Flags().BoolP("detach", "d", false, "Run the tunnel in the background")
+
+	tunnelCmd.AddCommand(tunnelLsCmd)
+	tunnelCmd.AddCommand(tunnelStopCmd)
 }
@@ -0,0 +1,46 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/spf13/cobra"
+)
+
+// upgradeCmd represents the upgrade command.
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [machine name]",
+	Short: "Upgrade Ollama on a machine",
+	Long: `Upgrade Ollama on a machine.
+
+Ollama is installed over SSH using the official install script, then restarted.
+The command returns once Ollama is ready again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version, err := cmd.Flags().GetString("version")
+		if err != nil {
+			return err
+		}
+
+		return provisioner.UpgradeOllama(cmd.Context(), args[0], version)
+	},
+}
+
+func init() {
+	upgradeCmd.Flags().String("version", "", "The Ollama version to install, such as 0.5.7 (defaults to the latest version)")
+}
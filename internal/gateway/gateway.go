@@ -0,0 +1,498 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package gateway exposes a single Ollama-compatible endpoint load-balancing requests across several machines.
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/charmbracelet/log"
+)
+
+// MachineHeader is the response header holding the name of the machine which served the request.
+const MachineHeader = "X-Ollama-Machine"
+
+const (
+	copyBufferSize = 32 * 1024
+	// maxErrorBodySize is the maximum size of the error responses kept, in case no other backend can serve the request.
+	maxErrorBodySize = 64 * 1024
+	// MaxRequestBodySize is the maximum size of the requests, kept in memory to be retried on another backend.
+	MaxRequestBodySize = 64 * 1024 * 1024
+)
+
+// hopHeaders are the headers which must not be forwarded by proxies.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Backend is an Ollama server requests can be routed to.
+type Backend struct {
+	// Name is the name of the machine running the Ollama server.
+	Name string
+	// BaseURL is the base URL of the Ollama API.
+	BaseURL *url.URL
+	// HTTPClient is the client reaching the Ollama API.
+	HTTPClient *http.Client
+}
+
+type backendState struct {
+	Backend
+
+	client    *ollama.Client
+	healthy   bool
+	available []string
+	loaded    []string
+	inflight  int
+}
+
+// statusError is returned when a backend answers with a status another backend may not return,
+// such as a model not found or a server error. It holds the response, to be written if no other backend can serve the request.
+type statusError struct {
+	backend *backendState
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("machine answered with status %d", e.status)
+}
+
+// retryableStatus returns true if the request may succeed on another backend after receiving the given status.
+func retryableStatus(status int) bool {
+	return status == http.StatusNotFound || status >= http.StatusInternalServerError
+}
+
+// Gateway routes Ollama API requests across backends, preferring the ones which already loaded the requested model.
+type Gateway struct {
+	backends []*backendState
+
+	// mu guards the state of backends and next.
+	mu sync.Mutex
+	// next is the index of the backend to try first, so backends are used in turn.
+	next int
+}
+
+// New creates a new gateway routing requests across the given backends.
+// Backends are considered unhealthy until CheckHealth is called.
+func New(backends []Backend) *Gateway {
+	g := &Gateway{}
+	for _, backend := range backends {
+		g.backends = append(g.backends, &backendState{
+			Backend: backend,
+			client:  ollama.NewClient(backend.BaseURL, backend.HTTPClient),
+		})
+	}
+
+	return g
+}
+
+// Serve checks the health of backends, then accepts requests on the listener until the context is done.
+// The health of backends is checked again at the given interval.
+func (g *Gateway) Serve(ctx context.Context, listener net.Listener, healthCheckInterval time.Duration) error {
+	g.CheckHealth(ctx)
+
+	server := &http.Server{
+		Handler:           g,
+		ReadHeaderTimeout: healthCheckInterval,
+	}
+
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				_ = server.Shutdown(context.WithoutCancel(ctx))
+
+				return
+			case <-ticker.C:
+				g.CheckHealth(ctx)
+			}
+		}
+	}()
+
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// CheckHealth checks the health of all backends and refreshes the lists of models they have and loaded.
+func (g *Gateway) CheckHealth(ctx context.Context) {
+	wg := sync.WaitGroup{}
+
+	for _, backend := range g.backends {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			available, err := backend.client.List(ctx)
+
+			var running []ollama.RunningModel
+			if err == nil {
+				running, err = backend.client.ListRunning(ctx)
+			}
+
+			g.mu.Lock()
+			defer g.mu.Unlock()
+
+			if err != nil {
+				if backend.healthy {
+					log.Warn("Machine unhealthy", "machine", backend.Name, "err", err)
+				}
+
+				backend.healthy = false
+
+				return
+			}
+
+			if !backend.healthy {
+				log.Info("Machine healthy", "machine", backend.Name)
+			}
+
+			backend.healthy = true
+			backend.available = backend.available[:0]
+			backend.loaded = backend.loaded[:0]
+
+			for _, model := range available {
+				backend.available = append(backend.available, ollama.NormalizeModelName(model.Name))
+			}
+
+			for _, model := range running {
+				backend.loaded = append(backend.loaded, ollama.NormalizeModelName(model.Name))
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// ServeHTTP routes the request to a backend.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		switch r.URL.Path {
+		case "/api/tags":
+			g.serveTags(w, r)
+
+			return
+		case "/api/ps":
+			g.servePs(w, r)
+
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRequestBodySize))
+	if err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, "failed to read request: "+err.Error(), status)
+
+		return
+	}
+
+	model := requestedModel(body)
+	tried := map[*backendState]bool{}
+
+	var lastStatusErr *statusError
+
+	for {
+		backend := g.pick(model, tried)
+		if backend == nil {
+			if lastStatusErr != nil {
+				writeStatusError(w, lastStatusErr)
+
+				return
+			}
+
+			http.Error(w, "no healthy machine available", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		tried[backend] = true
+
+		err = g.forward(w, r, body, backend)
+		g.release(backend)
+
+		if err == nil || r.Context().Err() != nil {
+			return
+		}
+
+		log.Warn("Failed to forward request, trying another machine", "machine", backend.Name, "path", r.URL.Path, "err", err)
+
+		// The backend answered, it is still healthy.
+		if errors.As(err, &lastStatusErr) {
+			continue
+		}
+
+		g.mu.Lock()
+		backend.healthy = false
+		g.mu.Unlock()
+	}
+}
+
+// writeStatusError writes the response of the backend which returned the error.
+func writeStatusError(w http.ResponseWriter, err *statusError) {
+	for key, values := range err.header {
+		if !slices.Contains(hopHeaders, key) && key != "Content-Length" {
+			w.Header()[key] = values
+		}
+	}
+
+	w.Header().Set(MachineHeader, err.backend.Name)
+	w.WriteHeader(err.status)
+
+	_, _ = w.Write(err.body)
+}
+
+// pick returns the backend the request for the given model should be routed to, among the healthy ones
+// which were not tried yet. Backends which already loaded the model are preferred, then the ones having it,
+// then the least busy ones. Backends not having the model are only picked when none has it, as when pulling it.
+func (g *Gateway) pick(model string, tried map[*backendState]bool) *backendState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var (
+		best      *backendState
+		bestRank  int
+		bestIndex int
+	)
+
+	for i := range g.backends {
+		index := (g.next + i) % len(g.backends)
+		backend := g.backends[index]
+
+		if !backend.healthy || tried[backend] {
+			continue
+		}
+
+		rank := backend.rank(model)
+		if best == nil || rank > bestRank || (rank == bestRank && backend.inflight < best.inflight) {
+			best, bestRank, bestIndex = backend, rank, index
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	g.next = (bestIndex + 1) % len(g.backends)
+	best.inflight++
+
+	return best
+}
+
+// rank returns 2 if the backend loaded the given model, 1 if it has it, and 0 otherwise.
+// The caller must hold g.mu.
+func (b *backendState) rank(model string) int {
+	switch {
+	case model == "":
+		return 0
+	case slices.Contains(b.loaded, model):
+		return 2 //nolint:mnd
+	case slices.Contains(b.available, model):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (g *Gateway) release(backend *backendState) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	backend.inflight--
+}
+
+// forward sends the request to the backend and streams the response back.
+// An error is returned only when nothing was written to the response writer, so the request can be retried.
+// Responses with a status another backend may not return, such as a model not found, are returned as a *statusError.
+func (g *Gateway) forward(w http.ResponseWriter, r *http.Request, body []byte, backend *backendState) error {
+	target := backend.BaseURL.JoinPath(r.URL.Path)
+	target.RawQuery = r.URL.RawQuery
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header = r.Header.Clone()
+	for _, header := range hopHeaders {
+		req.Header.Del(header)
+	}
+
+	resp, err := backend.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if retryableStatus(resp.StatusCode) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+		return &statusError{backend: backend, status: resp.StatusCode, header: resp.Header, body: body}
+	}
+
+	for key, values := range resp.Header {
+		if !slices.Contains(hopHeaders, key) {
+			w.Header()[key] = values
+		}
+	}
+
+	w.Header().Set(MachineHeader, backend.Name)
+	w.WriteHeader(resp.StatusCode)
+
+	// Flush every chunk, so streamed responses reach the client as they are generated.
+	controller := http.NewResponseController(w)
+	buf := make([]byte, copyBufferSize)
+
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			_, err = w.Write(buf[:n])
+			if err != nil {
+				log.Debug("Client went away", "machine", backend.Name, "err", err)
+
+				return nil
+			}
+
+			_ = controller.Flush()
+		}
+
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				log.Warn("Response interrupted", "machine", backend.Name, "err", readErr)
+			}
+
+			return nil
+		}
+	}
+}
+
+// serveTags lists the models available on healthy backends.
+func (g *Gateway) serveTags(w http.ResponseWriter, r *http.Request) {
+	result := &ollama.ListResponse{Models: []ollama.Model{}}
+
+	for _, models := range collect(g, func(client *ollama.Client) ([]ollama.Model, error) { return client.List(r.Context()) }) {
+		for _, model := range models {
+			if !slices.ContainsFunc(result.Models, func(m ollama.Model) bool { return m.Name == model.Name }) {
+				result.Models = append(result.Models, model)
+			}
+		}
+	}
+
+	writeJSON(w, result)
+}
+
+// servePs lists the models loaded on healthy backends.
+func (g *Gateway) servePs(w http.ResponseWriter, r *http.Request) {
+	result := &ollama.ListRunningResponse{Models: []ollama.RunningModel{}}
+
+	for _, models := range collect(g, func(client *ollama.Client) ([]ollama.RunningModel, error) { return client.ListRunning(r.Context()) }) {
+		result.Models = append(result.Models, models...)
+	}
+
+	writeJSON(w, result)
+}
+
+// collect calls fn on all healthy backends, in order, skipping the ones returning an error.
+func collect[T any](g *Gateway, fn func(client *ollama.Client) (T, error)) []T {
+	g.mu.Lock()
+	backends := slices.DeleteFunc(slices.Clone(g.backends), func(b *backendState) bool { return !b.healthy })
+	g.mu.Unlock()
+
+	result := []T{}
+	for _, backend := range backends {
+		value, err := fn(backend.client)
+		if err != nil {
+			log.Warn("Failed to query machine", "machine", backend.Name, "err", err)
+
+			continue
+		}
+
+		result = append(result, value)
+	}
+
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Error("Failed to write response", "err", err)
+	}
+}
+
+// requestedModel returns the normalized name of the model targeted by the request body, if any.
+func requestedModel(body []byte) string {
+	request := struct {
+		Model string `json:"model"`
+		Name  string `json:"name"`
+	}{}
+
+	if json.Unmarshal(body, &request) != nil {
+		return ""
+	}
+
+	model := request.Model
+	if model == "" {
+		model = request.Name
+	}
+
+	if model == "" {
+		return ""
+	}
+
+	return ollama.NormalizeModelName(model)
+}
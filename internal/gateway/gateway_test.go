@@ -0,0 +1,309 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gateway_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/internal/gateway"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	. "github.com/onsi/gomega"
+)
+
+// newFakeOllama starts a fake Ollama server having llama3.2, a model named after the server, and the given models loaded.
+// Generate requests are answered with a stream of two chunks, or a 404 status when the server doesn't have the model.
+func newFakeOllama(t *testing.T, name string, loaded ...string) *httptest.Server {
+	t.Helper()
+
+	available := append([]string{"llama3.2:latest", name + ":latest"}, loaded...)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/ps", func(w http.ResponseWriter, _ *http.Request) {
+		resp := ollama.ListRunningResponse{Models: []ollama.RunningModel{}}
+		for _, model := range loaded {
+			resp.Models = append(resp.Models, ollama.RunningModel{Name: model})
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("GET /api/tags", func(w http.ResponseWriter, _ *http.Request) {
+		resp := ollama.ListResponse{Models: []ollama.Model{}}
+		for _, model := range available {
+			resp.Models = append(resp.Models, ollama.Model{Name: model})
+		}
+
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("POST /api/generate", func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Model string `json:"model"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+
+		if !slices.Contains(available, ollama.NormalizeModelName(request.Model)) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, "{\"error\":\"model '%s' not found\"}", request.Model)
+
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "{\"response\":\"hello from %s\"}\n", name)
+		w.(http.Flusher).Flush()
+		_, _ = fmt.Fprintln(w, `{"done":true}`)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newGateway(t *testing.T, servers map[string]*httptest.Server, names ...string) *httptest.Server {
+	t.Helper()
+
+	backends := []gateway.Backend{}
+	for _, name := range names {
+		baseURL, err := url.Parse(servers[name].URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		backends = append(backends, gateway.Backend{Name: name, BaseURL: baseURL, HTTPClient: servers[name].Client()})
+	}
+
+	g := gateway.New(backends)
+	g.CheckHealth(t.Context())
+
+	server := httptest.NewServer(g)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func generate(t *testing.T, gatewayURL, model string) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := http.Post(gatewayURL+"/api/generate", "application/json", strings.NewReader(fmt.Sprintf(`{"model":%q}`, model))) //nolint:noctx
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, string(body)
+}
+
+func TestGatewayPrefersMachineWithModelLoaded(t *testing.T) {
+	g := NewWithT(t)
+
+	servers := map[string]*httptest.Server{
+		"a": newFakeOllama(t, "a"),
+		"b": newFakeOllama(t, "b", "mistral:latest"),
+		"c": newFakeOllama(t, "c"),
+	}
+	gatewayServer := newGateway(t, servers, "a", "b", "c")
+
+	for range 3 {
+		resp, body := generate(t, gatewayServer.URL, "mistral")
+		g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(resp.Header.Get(gateway.MachineHeader)).To(Equal("b"))
+		g.Expect(body).To(Equal("{\"response\":\"hello from b\"}\n{\"done\":true}\n"))
+	}
+}
+
+func TestGatewayBalancesRequests(t *testing.T) {
+	g := NewWithT(t)
+
+	servers := map[string]*httptest.Server{
+		"a": newFakeOllama(t, "a"),
+		"b": newFakeOllama(t, "b"),
+	}
+	gatewayServer := newGateway(t, servers, "a", "b")
+
+	machines := []string{}
+	for range 4 {
+		resp, _ := generate(t, gatewayServer.URL, "llama3.2")
+		machines = append(machines, resp.Header.Get(gateway.MachineHeader))
+	}
+
+	g.Expect(machines).To(Equal([]string{"a", "b", "a", "b"}))
+}
+
+func TestGatewayFailover(t *testing.T) {
+	g := NewWithT(t)
+
+	servers := map[string]*httptest.Server{
+		"a": newFakeOllama(t, "a", "llama3.2:latest"),
+		"b": newFakeOllama(t, "b"),
+	}
+	gatewayServer := newGateway(t, servers, "a", "b")
+
+	// The machine having the model loaded goes down after the last health check.
+	servers["a"].Close()
+
+	resp, body := generate(t, gatewayServer.URL, "llama3.2")
+	g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	g.Expect(resp.Header.Get(gateway.MachineHeader)).To(Equal("b"))
+	g.Expect(body).To(ContainSubstring("hello from b"))
+
+	servers["b"].Close()
+
+	resp, _ = generate(t, gatewayServer.URL, "llama3.2")
+	g.Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+}
+
+func TestGatewayRoutesToMachineHavingModel(t *testing.T) {
+	g := NewWithT(t)
+
+	servers := map[string]*httptest.Server{
+		"a": newFakeOllama(t, "a"),
+		"b": newFakeOllama(t, "b"),
+		"c": newFakeOllama(t, "c"),
+	}
+	gatewayServer := newGateway(t, servers, "a", "b", "c")
+
+	for range 3 {
+		resp, body := generate(t, gatewayServer.URL, "b")
+		g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		g.Expect(resp.Header.Get(gateway.MachineHeader)).To(Equal("b"))
+		g.Expect(body).To(ContainSubstring("hello from b"))
+	}
+
+	// No machine has the model, the error of the last one tried is returned.
+	resp, body := generate(t, gatewayServer.URL, "mistral")
+	g.Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	g.Expect(body).To(Equal(`{"error":"model 'mistral' not found"}`))
+}
+
+func TestGatewayRetriesErrorStatus(t *testing.T) {
+	tests := map[string]struct {
+		status int
+	}{
+		"model not found": {
+			status: http.StatusNotFound,
+		},
+		"server error": {
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			// The machine having the model loaded fails to serve it, as when the model was removed after the last health check.
+			healthy := newFakeOllama(t, "a", "mistral:latest")
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/generate" {
+					http.Error(w, "failure", tt.status)
+
+					return
+				}
+
+				healthy.Config.Handler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(failing.Close)
+
+			servers := map[string]*httptest.Server{
+				"a": failing,
+				"b": newFakeOllama(t, "b", "mistral:latest"),
+			}
+			gatewayServer := newGateway(t, servers, "a", "b")
+
+			for range 2 {
+				resp, body := generate(t, gatewayServer.URL, "mistral")
+				g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				g.Expect(resp.Header.Get(gateway.MachineHeader)).To(Equal("b"))
+				g.Expect(body).To(ContainSubstring("hello from b"))
+			}
+
+			servers["b"].Close()
+
+			resp, body := generate(t, gatewayServer.URL, "mistral")
+			g.Expect(resp.StatusCode).To(Equal(tt.status))
+			g.Expect(resp.Header.Get(gateway.MachineHeader)).To(Equal("a"))
+			g.Expect(body).To(Equal("failure\n"))
+		})
+	}
+}
+
+func TestGatewayRejectsLargeRequests(t *testing.T) {
+	g := NewWithT(t)
+
+	servers := map[string]*httptest.Server{
+		"a": newFakeOllama(t, "a"),
+	}
+	gatewayServer := newGateway(t, servers, "a")
+
+	body := strings.NewReader(`{"model":"llama3.2","prompt":"` + strings.Repeat("a", gateway.MaxRequestBodySize) + `"}`)
+	resp, err := http.Post(gatewayServer.URL+"/api/generate", "application/json", body) //nolint:noctx
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resp.Body.Close()).To(Succeed())
+	g.Expect(resp.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+}
+
+func TestGatewayMergesModels(t *testing.T) {
+	g := NewWithT(t)
+
+	servers := map[string]*httptest.Server{
+		"a": newFakeOllama(t, "a", "llama3.2:latest"),
+		"b": newFakeOllama(t, "b", "mistral:latest"),
+	}
+	gatewayServer := newGateway(t, servers, "a", "b")
+
+	client := ollama.NewClient(mustParseURL(t, gatewayServer.URL), nil)
+
+	models, err := client.List(t.Context())
+	g.Expect(err).NotTo(HaveOccurred())
+	names := []string{}
+	for _, model := range models {
+		names = append(names, model.Name)
+	}
+	g.Expect(names).To(ConsistOf("llama3.2:latest", "a:latest", "b:latest", "mistral:latest"))
+
+	running, err := client.ListRunning(t.Context())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(running).To(HaveLen(2))
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	result, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
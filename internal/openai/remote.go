@@ -0,0 +1,129 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// RemoteBinaryPath is the path of the ollama-machine binary on machines.
+	RemoteBinaryPath = "/usr/local/bin/ollama-machine"
+	// RemoteKeysPath is the path of the API keys file on machines.
+	RemoteKeysPath = "/etc/ollama-machine/apikeys.json"
+
+	serviceName = "ollama-machine-openai"
+	servicePath = "/etc/systemd/system/" + serviceName + ".service"
+)
+
+// RemoteArch returns the Go architecture of the machine the client is connected to.
+func RemoteArch(client *gossh.Client) (string, error) {
+	output, err := ssh.Run(client, "uname -m")
+	if err != nil {
+		return "", fmt.Errorf("failed to get machine architecture: %w", err)
+	}
+
+	switch arch := strings.TrimSpace(string(output)); arch {
+	case "x86_64":
+		return "amd64", nil
+	case "aarch64", "arm64":
+		return "arm64", nil
+	default:
+		return "", fmt.Errorf("unsupported machine architecture %s", arch)
+	}
+}
+
+// Install installs the given ollama-machine binary on the machine and runs the OpenAI-compatible server
+// as a systemd service listening on the given address, forwarding requests to the Ollama API at upstream.
+func Install(client *gossh.Client, binary io.Reader, keys []apikey.Key, listen, upstream string) error {
+	script := fmt.Sprintf("cat > %[1]s.partial && chmod 0755 %[1]s.partial && mv %[1]s.partial %[1]s", RemoteBinaryPath)
+
+	_, err := ssh.RunWithStdin(client, "sudo sh -c "+ssh.Quote(script), binary)
+	if err != nil {
+		return fmt.Errorf("failed to copy ollama-machine binary: %w", err)
+	}
+
+	err = SyncKeys(client, keys)
+	if err != nil {
+		return err
+	}
+
+	unit := fmt.Sprintf(`[Unit]
+Description=OpenAI-compatible endpoint of Ollama with API key authentication
+After=network-online.target ollama.service
+
+[Service]
+ExecStart=%s openai serve --upstream %s --keys-file %s --listen %s
+User=ollama
+Group=ollama
+Restart=always
+RestartSec=3
+
+[Install]
+WantedBy=multi-user.target
+`, RemoteBinaryPath, upstream, RemoteKeysPath, listen)
+
+	_, err = ssh.RunWithStdin(client, "sudo tee "+servicePath+" > /dev/null", strings.NewReader(unit))
+	if err != nil {
+		return fmt.Errorf("failed to write service: %w", err)
+	}
+
+	_, err = ssh.Run(client, "sudo systemctl daemon-reload && sudo systemctl enable "+serviceName+" && sudo systemctl restart "+serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+
+	return nil
+}
+
+// SyncKeys writes the given API keys on the machine. The server reads them for every request.
+func SyncKeys(client *gossh.Client, keys []apikey.Key) error {
+	content, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	script := fmt.Sprintf("umask 027 && mkdir -p /etc/ollama-machine && cat > %[1]s.partial && chgrp ollama %[1]s.partial && mv %[1]s.partial %[1]s", RemoteKeysPath)
+
+	_, err = ssh.RunWithStdin(client, "sudo sh -c "+ssh.Quote(script), bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("failed to write api keys: %w", err)
+	}
+
+	return nil
+}
+
+// Uninstall stops the OpenAI-compatible server on the machine and removes it.
+func Uninstall(client *gossh.Client) error {
+	script := fmt.Sprintf("systemctl disable --now %s; rm -f %s %s && systemctl daemon-reload", serviceName, servicePath, RemoteKeysPath)
+
+	_, err := ssh.Run(client, "sudo sh -c "+ssh.Quote(script))
+	if err != nil {
+		return fmt.Errorf("failed to remove service: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package openai serves the OpenAI-compatible API of an Ollama server, protected by API keys.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	"github.com/charmbracelet/log"
+)
+
+const readHeaderTimeout = 30 * time.Second
+
+// KeysFunc returns the API keys allowed to use the server.
+// It is called for every request, so revoked keys are rejected immediately.
+type KeysFunc func() ([]apikey.Key, error)
+
+// Server serves the OpenAI-compatible endpoints of an Ollama server.
+type Server struct {
+	keys    KeysFunc
+	handler http.Handler
+}
+
+// NewServer creates a new server forwarding authenticated requests to the Ollama API at upstream.
+// If httpClient is nil, http.DefaultClient is used.
+func NewServer(upstream *url.URL, httpClient *http.Client, keys KeysFunc) *Server {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream)
+			r.Out.Header.Del("Authorization")
+		},
+		Transport: httpClient.Transport,
+		// Flush immediately, so streamed completions reach the client as they are generated.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Error("Failed to forward request", "path", r.URL.Path, "err", err)
+			writeError(w, http.StatusBadGateway, "server_error", "failed to reach the model server")
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/chat/completions", proxy)
+	mux.Handle("POST /v1/embeddings", proxy)
+	mux.Handle("GET /v1/models", proxy)
+	mux.Handle("GET /v1/models/{model...}", proxy)
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		writeError(w, http.StatusNotFound, "invalid_request_error", "unknown endpoint")
+	})
+
+	return &Server{
+		keys:    keys,
+		handler: mux,
+	}
+}
+
+// ServeHTTP authenticates the request and forwards it to Ollama.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "missing api key, provide it using the Authorization: Bearer header")
+
+		return
+	}
+
+	keys, err := s.keys()
+	if err != nil {
+		log.Error("Failed to read api keys", "err", err)
+		writeError(w, http.StatusInternalServerError, "server_error", "failed to read api keys")
+
+		return
+	}
+
+	key, ok := apikey.Verify(keys, token)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid api key")
+
+		return
+	}
+
+	log.Debug("Request authenticated", "key", key.Name, "path", r.URL.Path)
+
+	s.handler.ServeHTTP(w, r)
+}
+
+// Serve accepts requests on the listener until the context is done.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.WithoutCancel(ctx))
+	}()
+
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// errorResponse is an error in the format of the OpenAI API.
+type errorResponse struct {
+	Error errorDetails `json:"error"`
+}
+
+type errorDetails struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: errorDetails{Message: message, Type: errorType}})
+}
@@ -0,0 +1,156 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package openai_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/internal/openai"
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	. "github.com/onsi/gomega"
+)
+
+func TestServer(t *testing.T) {
+	token, key, err := apikey.Generate("ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s auth=%q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	upstreamURL, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(openai.NewServer(upstreamURL, upstream.Client(), func() ([]apikey.Key, error) {
+		return []apikey.Key{key}, nil
+	}))
+	t.Cleanup(server.Close)
+
+	tests := map[string]struct {
+		method string
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		"chat completion": {
+			method: http.MethodPost,
+			path:   "/v1/chat/completions",
+			token:  token,
+			status: http.StatusOK,
+			body:   `POST /v1/chat/completions auth=""`,
+		},
+		"embeddings": {
+			method: http.MethodPost,
+			path:   "/v1/embeddings",
+			token:  token,
+			status: http.StatusOK,
+			body:   `POST /v1/embeddings auth=""`,
+		},
+		"models": {
+			method: http.MethodGet,
+			path:   "/v1/models",
+			token:  token,
+			status: http.StatusOK,
+			body:   `GET /v1/models auth=""`,
+		},
+		"model": {
+			method: http.MethodGet,
+			path:   "/v1/models/llama3.2:latest",
+			token:  token,
+			status: http.StatusOK,
+			body:   `GET /v1/models/llama3.2:latest auth=""`,
+		},
+		"missing key": {
+			method: http.MethodGet,
+			path:   "/v1/models",
+			status: http.StatusUnauthorized,
+			body:   "missing api key",
+		},
+		"invalid key": {
+			method: http.MethodGet,
+			path:   "/v1/models",
+			token:  "om-invalid",
+			status: http.StatusUnauthorized,
+			body:   "invalid api key",
+		},
+		"native ollama api": {
+			method: http.MethodPost,
+			path:   "/api/pull",
+			token:  token,
+			status: http.StatusNotFound,
+			body:   "unknown endpoint",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			req, err := http.NewRequestWithContext(t.Context(), tt.method, server.URL+tt.path, strings.NewReader("{}"))
+			g.Expect(err).NotTo(HaveOccurred())
+
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			body, err := io.ReadAll(resp.Body)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(resp.StatusCode).To(Equal(tt.status))
+			g.Expect(string(body)).To(ContainSubstring(tt.body))
+		})
+	}
+}
+
+func TestServerKeysError(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(openai.NewServer(&url.URL{Scheme: "http", Host: "localhost"}, nil, func() ([]apikey.Key, error) {
+		return nil, errors.New("permission denied")
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/v1/models", nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Authorization", "Bearer om-key")
+
+	resp, err := http.DefaultClient.Do(req)
+	g.Expect(err).NotTo(HaveOccurred())
+	_ = resp.Body.Close()
+	g.Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+}
@@ -0,0 +1,100 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package progress renders progress bars on a terminal.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	barWidth  = 30
+	clearLine = "\x1b[K"
+)
+
+// Bar renders a progress bar per status on a single terminal line.
+// When the status changes, the current line is kept and a new one is started.
+type Bar struct {
+	w      io.Writer
+	status string
+}
+
+// NewBar creates a new progress bar writing to w.
+func NewBar(w io.Writer) *Bar {
+	return &Bar{w: w}
+}
+
+// Update renders the given status and progress.
+// When total is not positive, only the status is rendered.
+func (b *Bar) Update(status string, completed, total int64) {
+	if b.status != "" && b.status != status {
+		_, _ = fmt.Fprintln(b.w)
+	}
+
+	b.status = status
+
+	_, _ = fmt.Fprint(b.w, "\r"+Render(status, completed, total)+clearLine)
+}
+
+// Done terminates the current line.
+func (b *Bar) Done() {
+	if b.status == "" {
+		return
+	}
+
+	b.status = ""
+	_, _ = fmt.Fprintln(b.w)
+}
+
+// Render returns the textual representation of a progress bar.
+func Render(status string, completed, total int64) string {
+	if total <= 0 {
+		return status
+	}
+
+	completed = min(max(completed, 0), total)
+	filled := int(completed * barWidth / total)
+
+	return fmt.Sprintf("%s [%s%s] %3d%% %s/%s",
+		status,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", barWidth-filled),
+		completed*100/total, //nolint:mnd
+		FormatBytes(completed),
+		FormatBytes(total),
+	)
+}
+
+// FormatBytes returns a human readable representation of the given number of bytes.
+func FormatBytes(n int64) string {
+	const unit = 1000
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for i := n / unit; i >= unit; i /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,101 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package progress_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/internal/progress"
+	. "github.com/onsi/gomega"
+)
+
+func TestRender(t *testing.T) {
+	tests := map[string]struct {
+		status    string
+		completed int64
+		total     int64
+		result    string
+	}{
+		"status only": {
+			status: "pulling manifest",
+			result: "pulling manifest",
+		},
+		"half done": {
+			status:    "pulling 6a0746a1ec1a",
+			completed: 1_000_000_000,
+			total:     2_000_000_000,
+			result:    "pulling 6a0746a1ec1a [===============               ]  50% 1.0 GB/2.0 GB",
+		},
+		"completed over total": {
+			status:    "pulling 6a0746a1ec1a",
+			completed: 3_000,
+			total:     2_000,
+			result:    "pulling 6a0746a1ec1a [==============================] 100% 2.0 kB/2.0 kB",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(progress.Render(tt.status, tt.completed, tt.total)).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[string]struct {
+		input  int64
+		result string
+	}{
+		"bytes": {
+			input:  999,
+			result: "999 B",
+		},
+		"kilobytes": {
+			input:  1_500,
+			result: "1.5 kB",
+		},
+		"gigabytes": {
+			input:  4_700_000_000,
+			result: "4.7 GB",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(progress.FormatBytes(tt.input)).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestBarStartsNewLineOnStatusChange(t *testing.T) {
+	g := NewWithT(t)
+
+	buf := &bytes.Buffer{}
+	bar := progress.NewBar(buf)
+	bar.Update("pulling manifest", 0, 0)
+	bar.Update("pulling 6a0746a1ec1a", 1, 2)
+	bar.Update("pulling 6a0746a1ec1a", 2, 2)
+	bar.Done()
+
+	g.Expect(bytes.Count(buf.Bytes(), []byte("\n"))).To(Equal(2))
+}
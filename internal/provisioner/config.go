@@ -0,0 +1,175 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/charmbracelet/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ollamaHostEnv is the variable managed by the connectivity of the machine.
+const ollamaHostEnv = "OLLAMA_HOST"
+
+// ErrReservedVariable is returned when trying to change a variable managed by ollama-machine.
+var ErrReservedVariable = errors.New("variable is managed by the machine connectivity")
+
+func validateOllamaEnvKey(key string) error {
+	err := envfile.ValidateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if key == ollamaHostEnv {
+		return fmt.Errorf("%w: %s", ErrReservedVariable, key)
+	}
+
+	return nil
+}
+
+// GetOllamaEnv returns the environment of the Ollama server of the machine.
+func GetOllamaEnv(machineName string) ([]envfile.Variable, error) {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	content, err := readOllamaEnv(sshClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return envfile.Parse(content), nil
+}
+
+// SetOllamaEnv sets the given variables in the environment of the Ollama server of the machine,
+// then restarts Ollama and waits for it to be ready.
+func SetOllamaEnv(ctx context.Context, machineName string, variables []envfile.Variable) error {
+	for _, variable := range variables {
+		err := validateOllamaEnvKey(variable.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateOllamaEnv(ctx, machineName, func(content string) string {
+		for _, variable := range variables {
+			content = envfile.Set(content, variable.Key, variable.Value)
+		}
+
+		return content
+	})
+}
+
+// UnsetOllamaEnv removes the given variables from the environment of the Ollama server of the machine,
+// then restarts Ollama and waits for it to be ready.
+func UnsetOllamaEnv(ctx context.Context, machineName string, keys []string) error {
+	for _, key := range keys {
+		err := validateOllamaEnvKey(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateOllamaEnv(ctx, machineName, func(content string) string {
+		for _, key := range keys {
+			content = envfile.Unset(content, key)
+		}
+
+		return content
+	})
+}
+
+func updateOllamaEnv(ctx context.Context, machineName string, edit func(content string) string) error {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	content, err := readOllamaEnv(sshClient)
+	if err != nil {
+		return err
+	}
+
+	updated := edit(content)
+	if updated == content {
+		log.Info("Ollama configuration unchanged")
+
+		return nil
+	}
+
+	log.Info("Updating Ollama configuration")
+
+	_, err = ssh.RunWithStdin(sshClient, fmt.Sprintf("sudo tee %s > /dev/null", ssh.Quote(machine.OllamaEnvFilePath)), strings.NewReader(updated))
+	if err != nil {
+		return fmt.Errorf("failed to write ollama configuration: %w", err)
+	}
+
+	log.Info("Restarting Ollama")
+
+	_, err = ssh.Run(sshClient, "sudo systemctl restart ollama")
+	if err != nil {
+		return fmt.Errorf("failed to restart ollama: %w", err)
+	}
+
+	log.Info("Waiting for Ollama to be ready")
+
+	_, err = WaitForOllama(ctx, m, ollama.ReadinessOptions{})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Ollama configuration updated")
+
+	return nil
+}
+
+func readOllamaEnv(sshClient *gossh.Client) (string, error) {
+	content, err := ssh.Run(sshClient, "cat "+ssh.Quote(machine.OllamaEnvFilePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to read ollama configuration: %w", err)
+	}
+
+	return string(content), nil
+}
@@ -0,0 +1,340 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/charmbracelet/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// SetConnectivity replaces the connectivity of a running machine over SSH.
+// The software of the current connectivity is removed, the new one is installed as it would be by cloud-init,
+// the firewall rules are updated when the cloud provider supports it, and Ollama is restarted.
+// The resources of the current connectivity created outside of the machine are removed once the new one works.
+// When the new connectivity fails to be set up, its resources are removed, and the machine falls back to the private
+// connectivity if the current one was already removed.
+func (p *Provisioner) SetConnectivity(ctx context.Context, machineName string, connectivityProvider connectivity.Provider) error {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	previous := *m
+	previousProvider := connectivity.ForMachine(&previous)
+
+	// Resources of both connectivities may clash, such as Cloudflare DNS records or WireGuard configurations.
+	if previousProvider.Name() == connectivityProvider.Name() {
+		return fmt.Errorf("machine %s already uses the %s connectivity", m.Name, previousProvider.Name())
+	}
+
+	// The endpoint listens on an address of the current connectivity, and may be served by its reverse proxy.
+	if m.OpenAI != nil {
+		return fmt.Errorf("machine %s serves the OpenAI-compatible endpoint, remove it using the openai uninstall command first", m.Name)
+	}
+
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	if preparer, ok := connectivityProvider.(connectivity.Preparer); ok {
+		log.Info("Preparing connectivity", "connectivity", connectivityProvider.Name())
+
+		err = preparer.Prepare(ctx, m.Name)
+		if err != nil {
+			return fmt.Errorf("failed to prepare connectivity: %w", err)
+		}
+	}
+
+	m.Connectivity = connectivityProvider.Name()
+	m.OllamaConfig = machine.OllamaConfig{Port: ollama.DefaultPort}
+	m.PublicTLS = nil
+	m.Cloudflare = nil
+	m.WireGuard = nil
+	m.Tailscale = nil
+
+	if configurer, ok := connectivityProvider.(connectivity.MachineConfigurer); ok {
+		configurer.ConfigureMachine(m)
+	}
+
+	uninstalled, err := p.installConnectivity(ctx, sshClient, m, previousProvider, connectivityProvider)
+	if err != nil {
+		log.Error("Failed to set connectivity, rolling back", "connectivity", connectivityProvider.Name(), "err", err)
+
+		return errors.Join(err, p.rollbackConnectivity(ctx, sshClient, m, &previous, previousProvider, connectivityProvider, uninstalled))
+	}
+
+	log.Info("Removing previous connectivity resources", "connectivity", previousProvider.Name())
+
+	err = previousProvider.Teardown(ctx, &previous)
+	if err != nil {
+		log.Error("Failed to remove previous connectivity resources, they must be removed manually", "err", err)
+
+		return fmt.Errorf("failed to remove previous connectivity resources: %w", err)
+	}
+
+	log.Info("Connectivity updated", "connectivity", m.Connectivity)
+
+	return nil
+}
+
+// installConnectivity replaces the connectivity software of the machine, saves the machine and waits for Ollama.
+// It returns whether the software of the previous connectivity was removed from the machine, even partially.
+func (p *Provisioner) installConnectivity(ctx context.Context, sshClient *gossh.Client, m *machine.Machine, previousProvider, connectivityProvider connectivity.Provider) (bool, error) { //nolint:funlen,cyclop
+	uninstalled := false
+
+	if uninstaller, ok := previousProvider.(connectivity.Uninstaller); ok {
+		log.Info("Removing connectivity", "connectivity", previousProvider.Name())
+
+		uninstalled = true
+
+		for _, command := range uninstaller.UninstallCommands() {
+			_, err := ssh.RunWithStdin(sshClient, "sudo sh -s", strings.NewReader(command))
+			if err != nil {
+				return uninstalled, fmt.Errorf("failed to remove %s connectivity: %w", previousProvider.Name(), err)
+			}
+		}
+	}
+
+	log.Info("Installing connectivity", "connectivity", connectivityProvider.Name())
+
+	cloudInit := cloudinit.NewConfig()
+	connectivityProvider.InstallViaCloudInit(cloudInit)
+
+	err := applyCloudInit(sshClient, cloudInit)
+	if err != nil {
+		return uninstalled, fmt.Errorf("failed to install %s connectivity: %w", connectivityProvider.Name(), err)
+	}
+
+	err = installConnectivitySecrets(sshClient, connectivityProvider)
+	if err != nil {
+		return uninstalled, err
+	}
+
+	m.ExposedPorts = []provider.Port{}
+	if portExposer, ok := connectivityProvider.(connectivity.PortExposer); ok {
+		m.ExposedPorts = portExposer.ExposedPorts()
+	}
+
+	err = p.setExposedPorts(ctx, m)
+	if err != nil {
+		return uninstalled, err
+	}
+
+	log.Info("Restarting Ollama")
+
+	_, err = ssh.Run(sshClient, "sudo systemctl daemon-reload && sudo systemctl restart ollama")
+	if err != nil {
+		return uninstalled, fmt.Errorf("failed to restart ollama: %w", err)
+	}
+
+	log.Info("Retrieving Ollama host")
+
+	m.OllamaConfig.Host, err = retrieveOllamaHost(ctx, connectivityProvider, m)
+	if err != nil {
+		return uninstalled, fmt.Errorf("failed to retrieve Ollama host IP from connectivity provider: %w", err)
+	}
+
+	if m.WireGuard != nil {
+		log.Info("WireGuard configuration written, bring the link up to reach Ollama", "command", "sudo wg-quick up "+m.WireGuard.ClientConfigPath)
+	}
+
+	err = machine.Save(m)
+	if err != nil {
+		return uninstalled, fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	log.Info("Waiting for Ollama to be ready")
+
+	_, err = WaitForOllama(ctx, m, ollama.ReadinessOptions{})
+	if err != nil {
+		return uninstalled, err
+	}
+
+	return uninstalled, nil
+}
+
+// rollbackConnectivity removes the resources of a connectivity which failed to be set up on the machine.
+// When the previous connectivity was already removed from the machine, it can't be trusted to work anymore:
+// the machine falls back to the private connectivity, staying reachable through SSH,
+// and the resources of the previous connectivity are removed too.
+func (p *Provisioner) rollbackConnectivity(ctx context.Context, sshClient *gossh.Client, m, previous *machine.Machine, previousProvider, connectivityProvider connectivity.Provider, uninstalled bool) error {
+	log.Info("Removing connectivity resources", "connectivity", connectivityProvider.Name())
+
+	var errs []error
+
+	err := connectivityProvider.Teardown(ctx, m)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove %s connectivity resources: %w", connectivityProvider.Name(), err))
+	}
+
+	if !uninstalled {
+		return errors.Join(errs...)
+	}
+
+	log.Warn("Previous connectivity removed from the machine, falling back to the private connectivity", "connectivity", previousProvider.Name())
+
+	err = p.installPrivateConnectivity(ctx, sshClient, m, connectivityProvider)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to fall back to the private connectivity: %w", err))
+	}
+
+	log.Info("Removing previous connectivity resources", "connectivity", previousProvider.Name())
+
+	err = previousProvider.Teardown(ctx, previous)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to remove %s connectivity resources: %w", previousProvider.Name(), err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// installPrivateConnectivity removes what was installed of the given connectivity, installs the private one
+// and saves the machine with it. The machine is saved even when a step fails, so it never refers to removed resources.
+func (p *Provisioner) installPrivateConnectivity(ctx context.Context, sshClient *gossh.Client, m *machine.Machine, connectivityProvider connectivity.Provider) error {
+	var errs []error
+
+	if uninstaller, ok := connectivityProvider.(connectivity.Uninstaller); ok {
+		for _, command := range uninstaller.UninstallCommands() {
+			_, err := ssh.RunWithStdin(sshClient, "sudo sh -s", strings.NewReader(command))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove %s connectivity: %w", connectivityProvider.Name(), err))
+			}
+		}
+	}
+
+	privateProvider := &connectivity.PrivateProvider{}
+
+	cloudInit := cloudinit.NewConfig()
+	privateProvider.InstallViaCloudInit(cloudInit)
+
+	err := applyCloudInit(sshClient, cloudInit)
+	if err == nil {
+		_, err = ssh.Run(sshClient, "sudo systemctl daemon-reload && sudo systemctl restart ollama")
+	}
+
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to install private connectivity: %w", err))
+	}
+
+	host, _ := privateProvider.RetrieveOllamaHost(m)
+
+	m.Connectivity = privateProvider.Name()
+	m.OllamaConfig = machine.OllamaConfig{Host: host, Port: ollama.DefaultPort}
+	m.PublicTLS = nil
+	m.Cloudflare = nil
+	m.WireGuard = nil
+	m.Tailscale = nil
+	m.ExposedPorts = []provider.Port{}
+
+	errs = append(errs, p.setExposedPorts(ctx, m))
+
+	err = machine.Save(m)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to save machine: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliverConnectivitySecrets delivers the secrets of the connectivity to the machine over SSH, if it needs any.
+func deliverConnectivitySecrets(m *machine.Machine, connectivityProvider connectivity.Provider) error {
+	if _, ok := connectivityProvider.(connectivity.SecretsInstaller); !ok {
+		return nil
+	}
+
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	return installConnectivitySecrets(sshClient, connectivityProvider)
+}
+
+// installConnectivitySecrets installs the secrets of the connectivity over SSH, if it needs any.
+func installConnectivitySecrets(sshClient *gossh.Client, connectivityProvider connectivity.Provider) error {
+	installer, ok := connectivityProvider.(connectivity.SecretsInstaller)
+	if !ok {
+		return nil
+	}
+
+	log.Info("Delivering connectivity secrets", "connectivity", connectivityProvider.Name())
+
+	secrets := cloudinit.NewConfig()
+	installer.InstallSecrets(secrets)
+
+	err := applyCloudInit(sshClient, secrets)
+	if err != nil {
+		return fmt.Errorf("failed to deliver %s connectivity secrets: %w", connectivityProvider.Name(), err)
+	}
+
+	return nil
+}
+
+// applyCloudInit writes the files and runs the commands of the given cloud-init configuration over SSH, as root.
+func applyCloudInit(sshClient *gossh.Client, cloudInit *cloudinit.Config) error {
+	for _, file := range cloudInit.WriteFiles {
+		permissions := file.Permissions
+		if permissions == "" {
+			permissions = "0644"
+		}
+
+		script := fmt.Sprintf("mkdir -p %s && (umask 077 && cat > %s) && chmod %s %s",
+			ssh.Quote(path.Dir(file.Path)), ssh.Quote(file.Path), permissions, ssh.Quote(file.Path))
+
+		_, err := ssh.RunWithStdin(sshClient, "sudo sh -c "+ssh.Quote(script), strings.NewReader(file.Content))
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+
+	for _, command := range cloudInit.RunCmd {
+		args := make([]string, 0, len(command))
+		for _, arg := range command {
+			args = append(args, ssh.Quote(arg))
+		}
+
+		// Commands are sent on stdin, so secrets they hold don't show up in errors.
+		_, err := ssh.RunWithStdin(sshClient, "sudo sh -s", strings.NewReader(strings.Join(args, " ")))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
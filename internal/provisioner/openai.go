@@ -0,0 +1,196 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/charmbracelet/log"
+)
+
+// UpdateOpenAIExposure updates a machine after the OpenAI-compatible endpoint was installed on it or removed from it.
+// When the connectivity serves Ollama over TLS, the endpoint is routed through it.
+// When the connectivity exposes Ollama to the outside world, which only machines whose endpoint was installed before
+// such connectivities were refused can do, Ollama only listens on the loopback interface while the endpoint is installed,
+// so API keys can't be bypassed, and its connectivity settings are restored once removed.
+// The firewall rules are updated when the cloud provider supports it.
+func (p *Provisioner) UpdateOpenAIExposure(ctx context.Context, machineName string) error {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	connectivityProvider := connectivity.ForMachine(m)
+
+	if connectivity.ExposesOllama(connectivityProvider) {
+		err = bindOllama(ctx, connectivityProvider, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	if router, ok := connectivityProvider.(connectivity.OpenAIRouter); ok {
+		err = routeOpenAI(m, router)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.setExposedPorts(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	err = machine.Save(m)
+	if err != nil {
+		return fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	return nil
+}
+
+// bindOllama binds Ollama to the loopback interface while the OpenAI-compatible endpoint is installed,
+// or to the address set by the connectivity otherwise, and restarts it.
+func bindOllama(ctx context.Context, connectivityProvider connectivity.Provider, m *machine.Machine) error {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	if m.OpenAI != nil {
+		log.Info("Binding Ollama to the loopback interface")
+
+		_, err = ssh.RunWithStdin(sshClient, "sudo sh -s", strings.NewReader(envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "127.0.0.1")))
+	} else {
+		log.Info("Restoring Ollama connectivity", "connectivity", connectivityProvider.Name())
+
+		cloudInit := cloudinit.NewConfig()
+		connectivityProvider.InstallViaCloudInit(cloudInit)
+
+		err = applyCloudInit(sshClient, cloudInit)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to set Ollama host: %w", err)
+	}
+
+	_, err = ssh.Run(sshClient, "sudo systemctl restart ollama")
+	if err != nil {
+		return fmt.Errorf("failed to restart ollama: %w", err)
+	}
+
+	if m.OpenAI != nil {
+		m.OllamaConfig.Host = "127.0.0.1"
+
+		return nil
+	}
+
+	m.OllamaConfig.Host, err = retrieveOllamaHost(ctx, connectivityProvider, m)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve Ollama host IP from connectivity provider: %w", err)
+	}
+
+	return nil
+}
+
+// routeOpenAI routes requests to the OpenAI-compatible endpoint through the connectivity while it is installed,
+// or removes the route once it is uninstalled.
+func routeOpenAI(m *machine.Machine, router connectivity.OpenAIRouter) error {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	log.Info("Updating OpenAI-compatible endpoint route")
+
+	config := cloudinit.NewConfig()
+	router.RouteOpenAI(m, config)
+
+	err = applyCloudInit(sshClient, config)
+	if err != nil {
+		return fmt.Errorf("failed to route the OpenAI-compatible endpoint: %w", err)
+	}
+
+	return nil
+}
+
+// setExposedPorts opens the ports exposed by the connectivity of the machine through the cloud provider, when it supports it.
+// While the OpenAI-compatible endpoint is installed, the Ollama port is closed, so API keys can't be bypassed.
+func (p *Provisioner) setExposedPorts(ctx context.Context, m *machine.Machine) error {
+	portManager, ok := p.machineManager.(provider.PortManager)
+	if !ok {
+		return nil
+	}
+
+	ports := []provider.Port{}
+	for _, port := range machineExposedPorts(m) {
+		if m.OpenAI != nil && port == (provider.Port{Protocol: "tcp", Number: ollama.DefaultPort}) {
+			continue
+		}
+
+		ports = append(ports, port)
+	}
+
+	log.Info("Updating firewall rules")
+
+	err := portManager.SetExposedPorts(ctx, m.ID, ports)
+	if err != nil {
+		return fmt.Errorf("failed to update firewall rules: %w", err)
+	}
+
+	return nil
+}
+
+// machineExposedPorts returns the ports exposed by the connectivity of the machine.
+// Machines created before the ports were recorded fall back to the default ports of their connectivity.
+func machineExposedPorts(m *machine.Machine) []provider.Port {
+	if m.ExposedPorts != nil {
+		return m.ExposedPorts
+	}
+
+	portExposer, ok := connectivity.ForMachine(m).(connectivity.PortExposer)
+	if !ok {
+		return nil
+	}
+
+	ports := []provider.Port{}
+	for _, port := range portExposer.ExposedPorts() {
+		if port.Number != 0 {
+			ports = append(ports, port)
+		}
+	}
+
+	return ports
+}
@@ -21,20 +21,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"os"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/alexandrevilain/ollama-machine/internal/progress"
 	"github.com/alexandrevilain/ollama-machine/pkg/cloudcredentials"
 	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
 	"github.com/alexandrevilain/ollama-machine/pkg/config"
 	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/gpu"
+	"github.com/alexandrevilain/ollama-machine/pkg/idle"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/modelcache"
 	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider"
 	"github.com/alexandrevilain/ollama-machine/pkg/registry"
 	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
 	"github.com/charmbracelet/log"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 var waitMachineStateInterval = 5 * time.Second
@@ -46,6 +54,27 @@ type Provisioner struct {
 	machineManager  provider.MachineManager
 }
 
+// CreateMachineOptions holds the machine options which are not related to the cloud provider.
+type CreateMachineOptions struct {
+	// Models is the list of models to pull once Ollama is ready.
+	Models []string
+	// WarmModels loads the pulled models into memory.
+	WarmModels bool
+	// ModelCache is the object storage bucket used as a model cache, if any.
+	ModelCache *machine.ModelCacheConfig
+	// AllowCPU allows Ollama to run without GPU instead of failing the machine creation.
+	AllowCPU bool
+	// OllamaVersion is the version of Ollama to install. The latest version is installed when empty.
+	OllamaVersion string
+	// OllamaEnv is the environment of the Ollama server, such as OLLAMA_KEEP_ALIVE.
+	OllamaEnv []envfile.Variable
+	// IdleTimeout is the duration without Ollama activity after which the machine shuts itself down.
+	// The machine never shuts itself down when zero.
+	IdleTimeout time.Duration
+	// ExpiresAt is the date after which the machine is stopped or deleted by the reap command, if any.
+	ExpiresAt *time.Time
+}
+
 // NewProvisioner creates a new instance of provisioner.
 func NewProvisioner(providerName, credentialsName, region string) (*Provisioner, error) {
 	provider, ok := registry.Providers[providerName]
@@ -109,8 +138,56 @@ func NewProvisionerForMachine(machineName string) (*Provisioner, error) {
 }
 
 // CreateMachine creates a new machine.
-func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMachineRequest, connectivityOpts *connectivity.Options) error { //nolint:funlen,cyclop
-	connectivityProvider := connectivity.GetProvider(connectivityOpts)
+func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMachineRequest, connectivityProvider connectivity.Provider, opts *CreateMachineOptions) error { //nolint:funlen,cyclop
+	if portExposer, ok := connectivityProvider.(connectivity.PortExposer); ok {
+		req.ExposedPorts = append(req.ExposedPorts, portExposer.ExposedPorts()...)
+	}
+
+	ollamaVersion, err := ollama.NormalizeVersion(opts.OllamaVersion)
+	if err != nil {
+		return err
+	}
+
+	opts.OllamaVersion = ollamaVersion
+
+	for _, variable := range opts.OllamaEnv {
+		err = validateOllamaEnvKey(variable.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.IdleTimeout != 0 {
+		err = idle.ValidateTimeout(opts.IdleTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.ExpiresAt != nil {
+		if !opts.ExpiresAt.After(time.Now()) {
+			return errors.New("machine expiry date must be in the future")
+		}
+
+		if req.Tags == nil {
+			req.Tags = map[string]string{}
+		}
+
+		req.Tags[machine.ExpiresAtTag] = opts.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	var modelCacheCredentials *modelcache.Credentials
+	if opts.ModelCache != nil {
+		modelCacheCredentials = &modelcache.Credentials{}
+
+		err := cloudcredentials.Get(cloudcredentials.Key{
+			Name:     opts.ModelCache.CredentialsName,
+			Provider: modelcache.CredentialsKind,
+		}, modelCacheCredentials)
+		if err != nil {
+			return fmt.Errorf("failed to get model cache credentials: %w", err)
+		}
+	}
 
 	log.Info("Generating SSH key pair")
 
@@ -119,10 +196,19 @@ func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMac
 		return err
 	}
 
+	if preparer, ok := connectivityProvider.(connectivity.Preparer); ok {
+		log.Info("Preparing connectivity", "connectivity", connectivityProvider.Name())
+
+		err = preparer.Prepare(ctx, req.Name)
+		if err != nil {
+			return fmt.Errorf("failed to prepare connectivity: %w", err)
+		}
+	}
+
 	log.Info("Generating machine config")
 
 	if p.machineManager.MachineKind() == provider.MachineKindVM {
-		cloudInit := p.generateCloudInit(connectivityProvider, keyPair) // TODO(alexandrevilain): this is a great v0 but it should be improved.
+		cloudInit := p.generateCloudInit(connectivityProvider, keyPair, gpu.DetectDistro(req.Image), opts) // TODO(alexandrevilain): this is a great v0 but it should be improved.
 
 		req.UserData, err = cloudInit.Render()
 		if err != nil {
@@ -133,6 +219,17 @@ func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMac
 	log.Info("Creating machine")
 	providerMachine, err := p.machineManager.Create(ctx, req)
 	if err != nil {
+		if _, ok := connectivityProvider.(connectivity.Preparer); ok {
+			log.Info("Removing connectivity resources")
+
+			m := &machine.Machine{Machine: &provider.Machine{Name: req.Name}}
+			if configurer, ok := connectivityProvider.(connectivity.MachineConfigurer); ok {
+				configurer.ConfigureMachine(m)
+			}
+
+			err = errors.Join(err, connectivityProvider.Teardown(ctx, m))
+		}
+
 		return fmt.Errorf("failed to create machine: %w", err)
 	}
 
@@ -142,6 +239,15 @@ func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMac
 		CredentialsName: p.credentialsName,
 		KeyPair:         keyPairFiles,
 		Connectivity:    connectivityProvider.Name(),
+		Models:          opts.Models,
+		ModelCache:      opts.ModelCache,
+		IdleTimeout:     opts.IdleTimeout,
+		ExpiresAt:       opts.ExpiresAt,
+		ExposedPorts:    req.ExposedPorts,
+	}
+
+	if configurer, ok := connectivityProvider.(connectivity.MachineConfigurer); ok {
+		configurer.ConfigureMachine(m)
 	}
 
 	// Start by saving the machine before waiting for it to be ready
@@ -182,49 +288,104 @@ func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMac
 		return fmt.Errorf("failed to save machine: %w", err)
 	}
 
-	log.Info("Waiting for Ollama to be started")
+	log.Info("Waiting for SSH to be ready")
+	err = waitForSSH(ctx, m)
+	if err != nil {
+		return err
+	}
 
-	// TODO(alexandrevilain): This is a temporary solution to wait for Ollama to be started.
-	// We should have a better way to know when Ollama is ready.
-	// This would not work if we're asking Ollama to pre-pull models for instance.
-	for {
-		_, sshSession, err := m.SSHClient()
+	if p.machineManager.MachineKind() == provider.MachineKindVM {
+		log.Info("Waiting for machine configuration to be done")
+		err = waitForCloudInit(ctx, m)
 		if err != nil {
-			if errors.Is(err, syscall.ECONNREFUSED) {
-				log.Info("Waiting for SSH to be ready", "err", err)
+			return err
+		}
 
-				time.Sleep(waitMachineStateInterval)
+		err = deliverConnectivitySecrets(m, connectivityProvider)
+		if err != nil {
+			return err
+		}
+	}
 
-				continue
-			}
+	log.Info("Retrieving Ollama host")
+	m.OllamaConfig.Host, err = retrieveOllamaHost(ctx, connectivityProvider, m)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve Ollama host IP from connectivity provider: %w", err)
+	}
+	if m.OllamaConfig.Port == 0 {
+		m.OllamaConfig.Port = ollama.DefaultPort
+	}
 
-			return fmt.Errorf("failed to create ssh client: %w", err)
-		}
+	if m.WireGuard != nil {
+		log.Info("WireGuard configuration written, bring the link up to reach Ollama", "command", "sudo wg-quick up "+m.WireGuard.ClientConfigPath)
+	}
+
+	err = machine.Save(m)
+	if err != nil {
+		return fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	log.Info("Waiting for Ollama to be ready")
+	version, err := WaitForOllama(ctx, m, ollama.ReadinessOptions{})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Ollama ready", "version", version)
+
+	m.OllamaVersion = version
+	if opts.OllamaVersion != "" && version != opts.OllamaVersion {
+		log.Warn("Ollama version differs from the requested one", "requested", opts.OllamaVersion, "installed", version)
+	}
 
-		result, err := sshSession.CombinedOutput("systemctl is-active ollama")
+	// Only virtual machines run Ollama as the systemd service whose logs are checked.
+	if !opts.AllowCPU && p.machineManager.MachineKind() == provider.MachineKindVM {
+		log.Info("Checking Ollama is using a GPU")
+		err = checkGPU(ctx, m)
 		if err != nil {
-			log.Info("Still waiting for Ollama to be started", "err", err)
+			return err
 		}
+	}
 
-		status := strings.Trim(string(result), " \n\t")
+	err = updateGPUs(m)
+	if err != nil {
+		if !opts.AllowCPU {
+			return err
+		}
 
-		if status == "active" {
-			log.Info("Ollama started")
+		log.Info("No NVIDIA GPU detected", "err", err)
+	}
 
-			break
+	if opts.ModelCache != nil {
+		log.Info("Configuring model cache")
+
+		err = setupModelCache(m, modelCacheCredentials)
+		if err != nil {
+			return err
 		}
+	}
 
-		log.Info("Still waiting for Ollama to be started", "status", status)
+	if len(opts.Models) > 0 {
+		err = pullModels(ctx, m, opts.Models, opts.WarmModels)
+		if err != nil {
+			return err
+		}
 
-		time.Sleep(waitMachineStateInterval)
-	}
+		if opts.ModelCache != nil {
+			log.Info("Uploading models to model cache")
 
-	log.Info("Retrieving Ollama host")
-	m.OllamaConfig.Host, err = connectivityProvider.RetrieveOllamaHost(m)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve Ollama host IP from connectivity provider: %w", err)
+			err = saveModelCache(m)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Info("Waiting for models to be ready")
+		_, err = WaitForOllama(ctx, m, ollama.ReadinessOptions{Models: opts.Models})
+		if err != nil {
+			return err
+		}
 	}
-	m.OllamaConfig.Port = ollama.DefaultPort
 
 	err = machine.Save(m)
 	if err != nil {
@@ -236,7 +397,7 @@ func (p *Provisioner) CreateMachine(ctx context.Context, req *provider.CreateMac
 	return nil
 }
 
-func (p *Provisioner) generateCloudInit(connectivityProvider connectivity.Provider, keyPair *ssh.KeyPair) *cloudinit.Config {
+func (p *Provisioner) generateCloudInit(connectivityProvider connectivity.Provider, keyPair *ssh.KeyPair, distro gpu.Distro, opts *CreateMachineOptions) *cloudinit.Config {
 	cloudInit := cloudinit.NewConfig()
 	cloudInit.AddUser(cloudinit.User{
 		Name:   machine.SSHUsername,
@@ -249,18 +410,329 @@ func (p *Provisioner) generateCloudInit(connectivityProvider connectivity.Provid
 	})
 
 	connectivityProvider.InstallViaCloudInit(cloudInit)
+	gpu.InstallViaCloudInit(cloudInit, distro)
+
+	for _, variable := range opts.OllamaEnv {
+		cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, variable.Key, variable.Value)})
+	}
 
 	cloudInit.AddFile(cloudinit.File{
 		Path: "/etc/systemd/system/ollama.service.d/override.conf",
 		Content: fmt.Sprintf(`[Service]
 EnvironmentFile=%s`, machine.OllamaEnvFilePath),
 	})
-	cloudInit.AddRunCmd([]string{"sh", "-c", "curl -fsSL https://ollama.com/install.sh | sh"})
+	cloudInit.AddRunCmd([]string{"sh", "-c", ollama.InstallCommand(opts.OllamaVersion)})
 	cloudInit.AddRunCmd([]string{"sh", "-c", "sudo systemctl start ollama"})
 
+	if opts.ModelCache != nil {
+		modelcache.InstallViaCloudInit(cloudInit, opts.ModelCache)
+	}
+
+	if opts.IdleTimeout != 0 {
+		idle.InstallViaCloudInit(cloudInit, opts.IdleTimeout)
+	}
+
 	return cloudInit
 }
 
+// waitForSSH waits until the machine accepts SSH connections.
+func waitForSSH(ctx context.Context, m *machine.Machine) error {
+	for {
+		sshClient, err := m.SSHDial()
+		if err == nil {
+			return sshClient.Close()
+		}
+
+		var netErr net.Error
+		if !errors.Is(err, syscall.ECONNREFUSED) && (!errors.As(err, &netErr) || !netErr.Timeout()) {
+			return fmt.Errorf("failed to create ssh client: %w", err)
+		}
+
+		log.Info("Still waiting for SSH to be ready", "err", err)
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// waitForCloudInit waits until cloud-init is done configuring the machine,
+// including the reboot it may have scheduled to load GPU drivers.
+func waitForCloudInit(ctx context.Context, m *machine.Machine) error {
+	for {
+		done, err := cloudInitDone(m)
+		if err == nil && done {
+			return nil
+		}
+
+		if err == nil {
+			log.Info("Still waiting for machine to reboot")
+		} else {
+			log.Info("Still waiting for machine configuration to be done", "err", err)
+		}
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cloudInitDone returns true when cloud-init is done and no reboot is pending.
+func cloudInitDone(m *machine.Machine) (bool, error) {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	output, err := ssh.Run(sshClient, "cloud-init status --wait")
+	var exitErr *gossh.ExitError
+	if errors.As(err, &exitErr) {
+		// cloud-init reports failures of its modules with a non-zero exit code,
+		// the machine is still checked afterwards by the Ollama readiness checks.
+		log.Warn("Machine configuration done with errors", "status", strings.TrimSpace(string(output)))
+	} else if err != nil {
+		return false, err
+	}
+
+	_, err = ssh.Run(sshClient, "test -f "+gpu.RebootMarkerPath)
+	if errors.As(err, &exitErr) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// checkGPU checks Ollama detected a GPU when it started, failing when its logs don't tell.
+func checkGPU(ctx context.Context, m *machine.Machine) error {
+	const attempts = 6
+
+	for range attempts {
+		libraries, err := ollamaComputeLibraries(m)
+		if err != nil {
+			return err
+		}
+
+		if len(libraries) > 0 {
+			if !gpu.UsesGPU(libraries) {
+				return errors.New("ollama is running on CPU: no usable GPU was detected, check the instance type and image, or pass --allow-cpu to create a CPU only machine")
+			}
+
+			return nil
+		}
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return err
+		}
+	}
+
+	return errors.New("unable to find the compute devices detected by Ollama in its logs, GPU usage can't be verified: pass --allow-cpu to skip this check")
+}
+
+// updateGPUs stores on the machine the GPUs reported by nvidia-smi.
+func updateGPUs(m *machine.Machine) error {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	devices, err := gpu.Query(sshClient)
+	if err != nil {
+		return err
+	}
+
+	m.GPU = gpu.Summarize(devices)
+	if m.GPU == nil {
+		return errors.New("nvidia-smi reported no gpu")
+	}
+
+	log.Info("GPU detected", "gpu", m.GPU.String(), "driver", m.GPU.DriverVersion)
+
+	return nil
+}
+
+func ollamaComputeLibraries(m *machine.Machine) ([]string, error) {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	logs, err := ssh.Run(sshClient, gpu.OllamaLogsCommand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ollama logs: %w", err)
+	}
+
+	return gpu.OllamaComputeLibraries(string(logs)), nil
+}
+
+// retrieveOllamaHost retrieves the Ollama host from the connectivity provider,
+// retrying while the machine is still being configured.
+func retrieveOllamaHost(ctx context.Context, connectivityProvider connectivity.Provider, m *machine.Machine) (string, error) {
+	for {
+		host, err := connectivityProvider.RetrieveOllamaHost(m)
+		if err == nil && host != "" {
+			return host, nil
+		}
+
+		log.Info("Still waiting for Ollama host to be available", "err", err)
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// WaitForOllama waits until the Ollama API of the machine is reachable through its connectivity
+// and ready according to the given options. It returns the Ollama server version.
+func WaitForOllama(ctx context.Context, m *machine.Machine, opts ollama.ReadinessOptions) (string, error) {
+	for {
+		version, err := checkOllamaReady(ctx, m, opts)
+		if err == nil {
+			return version, nil
+		}
+
+		log.Info("Still waiting for Ollama to be ready", "err", err)
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func checkOllamaReady(ctx context.Context, m *machine.Machine, opts ollama.ReadinessOptions) (string, error) {
+	client, closeClient, err := m.OllamaClient()
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = closeClient()
+	}()
+
+	return client.CheckReady(ctx, opts)
+}
+
+// setupModelCache delivers the model cache credentials to the machine and restores its models from the cache.
+func setupModelCache(m *machine.Machine, credentials *modelcache.Credentials) error {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	err = modelcache.DeliverCredentials(sshClient, credentials)
+	if err != nil {
+		return err
+	}
+
+	if len(m.Models) == 0 {
+		return nil
+	}
+
+	log.Info("Restoring models from model cache")
+
+	return modelcache.Restore(sshClient, m.Models)
+}
+
+// saveModelCache uploads the models of the machine which are not in the model cache yet.
+func saveModelCache(m *machine.Machine) error {
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	return modelcache.Save(sshClient)
+}
+
+// pullModels pulls the given models on the machine, rendering the pull progress on the terminal.
+// If warm is true, models are then loaded into memory.
+func pullModels(ctx context.Context, m *machine.Machine, models []string, warm bool) error {
+	client, closeClient, err := m.OllamaClient()
+	if err != nil {
+		return fmt.Errorf("failed to create ollama client: %w", err)
+	}
+
+	defer func() {
+		_ = closeClient()
+	}()
+
+	for _, model := range models {
+		log.Info("Pulling model", "model", model)
+
+		bar := progress.NewBar(os.Stderr)
+		err = client.Pull(ctx, model, func(resp ollama.ProgressResponse) {
+			bar.Update(resp.Status, resp.Completed, resp.Total)
+		})
+		bar.Done()
+
+		if err != nil {
+			return fmt.Errorf("failed to pull model %s: %w", model, err)
+		}
+	}
+
+	if !warm {
+		return nil
+	}
+
+	for _, model := range models {
+		log.Info("Loading model into memory", "model", model)
+
+		err = client.Load(ctx, model)
+		if err != nil {
+			return fmt.Errorf("failed to load model %s: %w", model, err)
+		}
+
+		// Models are checked right after being loaded, as loading the next ones may evict them.
+		_, err = client.CheckReady(ctx, ollama.ReadinessOptions{Models: []string{model}, Loaded: true})
+		if err != nil {
+			return fmt.Errorf("failed to load model %s: %w", model, err)
+		}
+	}
+
+	_, err = client.CheckReady(ctx, ollama.ReadinessOptions{Models: models, Loaded: true})
+	if err != nil {
+		log.Warn("Some models were unloaded to load the next ones, the machine may lack memory to keep them all loaded", "reason", err)
+	}
+
+	return nil
+}
+
+// sleep pauses the current goroutine for the given duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // DeleteMachine deletes a machine.
 func (p *Provisioner) DeleteMachine(ctx context.Context, machineName string) error {
 	m, err := machine.GetByName(machineName)
@@ -275,6 +747,13 @@ func (p *Provisioner) DeleteMachine(ctx context.Context, machineName string) err
 		return fmt.Errorf("failed to delete machine: %w", err)
 	}
 
+	log.Info("Removing connectivity resources")
+
+	teardownErr := connectivity.ForMachine(m).Teardown(ctx, m)
+	if teardownErr != nil {
+		log.Error("Failed to remove connectivity resources, they must be removed manually", "err", teardownErr)
+	}
+
 	if m.KeyPair != nil {
 		log.Info("Deleting key pair files")
 
@@ -290,6 +769,10 @@ func (p *Provisioner) DeleteMachine(ctx context.Context, machineName string) err
 		return fmt.Errorf("failed to delete machine: %w", err)
 	}
 
+	if teardownErr != nil {
+		return fmt.Errorf("failed to remove connectivity resources: %w", teardownErr)
+	}
+
 	log.Info("Machine deleted")
 
 	return nil
@@ -321,7 +804,20 @@ func (p *Provisioner) StartMachine(ctx context.Context, machineName string) erro
 		}
 
 		log.Info("Still waiting for machine to be started")
-		time.Sleep(waitMachineStateInterval)
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = startConnectivity(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	if m.WireGuard != nil {
+		log.Info("WireGuard configuration updated, bring the link up again to reach Ollama", "command", fmt.Sprintf("sudo wg-quick down %[1]s; sudo wg-quick up %[1]s", m.WireGuard.ClientConfigPath))
 	}
 
 	log.Info("Machine started")
@@ -334,6 +830,38 @@ func (p *Provisioner) StartMachine(ctx context.Context, machineName string) erro
 	return nil
 }
 
+// startConnectivity reconfigures the connectivity of a machine started again, when its provider requires it,
+// and updates its Ollama host.
+func startConnectivity(ctx context.Context, m *machine.Machine) error {
+	connectivityProvider := connectivity.ForMachine(m)
+
+	starter, ok := connectivityProvider.(connectivity.MachineStarter)
+	if !ok {
+		return nil
+	}
+
+	log.Info("Waiting for SSH to be ready")
+
+	err := waitForSSH(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Updating connectivity")
+
+	err = starter.StartMachine(ctx, m)
+	if err != nil {
+		return fmt.Errorf("failed to update connectivity: %w", err)
+	}
+
+	m.OllamaConfig.Host, err = retrieveOllamaHost(ctx, connectivityProvider, m)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve Ollama host IP from connectivity provider: %w", err)
+	}
+
+	return nil
+}
+
 func (p *Provisioner) StopMachine(ctx context.Context, machineName string) error {
 	m, err := machine.GetByName(machineName)
 	if err != nil {
@@ -360,7 +888,11 @@ func (p *Provisioner) StopMachine(ctx context.Context, machineName string) error
 		}
 
 		log.Info("Still waiting for machine to be stopped")
-		time.Sleep(waitMachineStateInterval)
+
+		err = sleep(ctx, waitMachineStateInterval)
+		if err != nil {
+			return err
+		}
 	}
 
 	err = machine.Save(m)
@@ -0,0 +1,93 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/charmbracelet/log"
+)
+
+// ReconcileMachine syncs the stored state of the machine with its provider.
+// A machine that shut itself down, for instance after being idle, is stopped through its provider,
+// as shutting an instance down from the inside doesn't stop billing on all clouds.
+func (p *Provisioner) ReconcileMachine(ctx context.Context, machineName string) error {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	providerMachine, err := p.machineManager.Get(ctx, m.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	if providerMachine.State == provider.MachineStateStopped && m.State != provider.MachineStateStopped {
+		log.Info("Machine shut itself down, stopping it", "machine", m.Name)
+
+		err = p.machineManager.Stop(ctx, m.ID)
+		if err != nil {
+			return fmt.Errorf("failed to stop machine: %w", err)
+		}
+	} else if providerMachine.State == m.State {
+		log.Info("Machine up to date", "machine", m.Name, "state", m.State)
+
+		return nil
+	}
+
+	m.Machine = providerMachine
+
+	err = machine.Save(m)
+	if err != nil {
+		return fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	log.Info("Machine reconciled", "machine", m.Name, "state", m.State)
+
+	return nil
+}
+
+// RefreshMachine updates the stored state of the machine from its provider, and returns the machine.
+// Unlike ReconcileMachine, it doesn't stop machines which shut themselves down.
+func (p *Provisioner) RefreshMachine(ctx context.Context, machineName string) (*machine.Machine, error) {
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	providerMachine, err := p.machineManager.Get(ctx, m.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	if providerMachine.State == m.State && providerMachine.IP == m.IP {
+		return m, nil
+	}
+
+	m.Machine = providerMachine
+
+	err = machine.Save(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	return m, nil
+}
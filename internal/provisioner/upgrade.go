@@ -0,0 +1,91 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/charmbracelet/log"
+)
+
+// UpgradeOllama installs the given Ollama version on the machine, restarts Ollama and waits for it to be ready.
+// The latest version is installed when version is empty.
+func UpgradeOllama(ctx context.Context, machineName, version string) error {
+	version, err := ollama.NormalizeVersion(version)
+	if err != nil {
+		return err
+	}
+
+	m, err := machine.GetByName(machineName)
+	if err != nil {
+		return fmt.Errorf("failed to get machine: %w", err)
+	}
+
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = sshClient.Close()
+	}()
+
+	if version == "" {
+		log.Info("Upgrading Ollama to the latest version", "current", m.OllamaVersion)
+	} else {
+		log.Info("Upgrading Ollama", "current", m.OllamaVersion, "version", version)
+	}
+
+	_, err = ssh.Run(sshClient, ollama.InstallCommand(version))
+	if err != nil {
+		return fmt.Errorf("failed to install ollama: %w", err)
+	}
+
+	log.Info("Restarting Ollama")
+
+	_, err = ssh.Run(sshClient, "sudo systemctl restart ollama")
+	if err != nil {
+		return fmt.Errorf("failed to restart ollama: %w", err)
+	}
+
+	log.Info("Waiting for Ollama to be ready")
+
+	installed, err := WaitForOllama(ctx, m, ollama.ReadinessOptions{})
+	if err != nil {
+		return err
+	}
+
+	if version != "" && installed != version {
+		return fmt.Errorf("ollama reports version %s after upgrading to %s", installed, version)
+	}
+
+	m.OllamaVersion = installed
+
+	err = machine.Save(m)
+	if err != nil {
+		return fmt.Errorf("failed to save machine: %w", err)
+	}
+
+	log.Info("Ollama upgraded", "version", installed)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/alexandrevilain/ollama-machine/internal/provisioner"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/charmbracelet/log"
+)
+
+var _ Backend = (*MachineBackend)(nil)
+
+// MachineBackend is a backend starting and stopping a machine through its cloud provider.
+type MachineBackend struct {
+	name        string
+	provisioner *provisioner.Provisioner
+}
+
+// NewMachineBackend creates a new backend for the given machine.
+func NewMachineBackend(machineName string) (*MachineBackend, error) {
+	prov, err := provisioner.NewProvisionerForMachine(machineName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MachineBackend{
+		name:        machineName,
+		provisioner: prov,
+	}, nil
+}
+
+// Start starts the machine if its provider doesn't report it as running, and waits for Ollama to be ready.
+func (b *MachineBackend) Start(ctx context.Context) (*url.URL, *http.Client, func() error, error) {
+	// The stored state may be stale, as machines can shut themselves down when idle.
+	m, err := b.provisioner.RefreshMachine(ctx, b.name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if m.State != provider.MachineStateRunning {
+		err = b.provisioner.StartMachine(ctx, b.name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// Reload the machine, as its IP address may have changed.
+		m, err = machine.GetByName(b.name)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to get machine: %w", err)
+		}
+	}
+
+	log.Info("Waiting for Ollama to be ready")
+
+	_, err = provisioner.WaitForOllama(ctx, m, ollama.ReadinessOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return m.OllamaHTTPClient()
+}
+
+// Stop stops the machine.
+func (b *MachineBackend) Stop(ctx context.Context) error {
+	return b.provisioner.StopMachine(ctx, b.name)
+}
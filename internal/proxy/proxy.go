@@ -0,0 +1,294 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package proxy implements a scale-to-zero proxy for the Ollama API of a machine.
+// The machine is started on the first request and stopped once the proxy has been idle for a while.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// DefaultStartTimeout is the default time given to the machine to start and Ollama to be ready.
+	DefaultStartTimeout = 10 * time.Minute
+
+	maxCheckInterval = 30 * time.Second
+)
+
+// Backend controls the machine behind the proxy.
+type Backend interface {
+	// Start starts the machine if needed and waits for Ollama to be ready.
+	// It returns the base URL of the Ollama API and an HTTP client reaching it,
+	// along with a function releasing the underlying connection.
+	Start(ctx context.Context) (*url.URL, *http.Client, func() error, error)
+	// Stop stops the machine.
+	Stop(ctx context.Context) error
+}
+
+// Proxy forwards Ollama API requests to a machine, starting it when needed.
+type Proxy struct {
+	backend      Backend
+	idleTimeout  time.Duration
+	startTimeout time.Duration
+
+	// mu guards the fields below. It isn't held while the machine is starting or stopping,
+	// requests wait for the transition in progress instead, until their context is done.
+	mu           sync.Mutex
+	upstream     *upstream
+	transition   *transition
+	inflight     int
+	lastActivity time.Time
+}
+
+type upstream struct {
+	handler *httputil.ReverseProxy
+	close   func() error
+}
+
+// transition is a start or a stop of the machine in progress.
+type transition struct {
+	// done is closed once the transition completes.
+	done chan struct{}
+	// err is the error of a failed start, set before done is closed.
+	err error
+}
+
+// New creates a new proxy stopping the machine after idleTimeout without requests.
+// Requests fail when the machine isn't ready within startTimeout.
+func New(backend Backend, idleTimeout, startTimeout time.Duration) *Proxy {
+	return &Proxy{
+		backend:      backend,
+		idleTimeout:  idleTimeout,
+		startTimeout: startTimeout,
+	}
+}
+
+// Serve accepts requests on the listener until the context is done.
+// It stops the machine once it has been idle for the configured timeout.
+func (p *Proxy) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: maxCheckInterval,
+	}
+
+	go p.watchIdle(ctx)
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.WithoutCancel(ctx))
+	}()
+
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// ServeHTTP forwards the request to the machine, starting it first if needed.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	up, err := p.acquire(r.Context())
+	if err != nil {
+		log.Error("Failed to start machine", "err", err)
+		http.Error(w, "failed to start machine: "+err.Error(), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	defer p.release()
+
+	up.handler.ServeHTTP(w, r)
+}
+
+// StopIfIdle stops the machine if no request was received for the idle timeout.
+// It returns true if the machine was stopped.
+func (p *Proxy) StopIfIdle(ctx context.Context) (bool, error) {
+	p.mu.Lock()
+
+	if p.upstream == nil || p.transition != nil || p.inflight > 0 || time.Since(p.lastActivity) < p.idleTimeout {
+		p.mu.Unlock()
+
+		return false, nil
+	}
+
+	log.Info("No request received recently, stopping machine", "idleTimeout", p.idleTimeout)
+
+	p.resetUpstream(p.upstream)
+
+	// Requests received meanwhile start the machine again once it is stopped.
+	stopping := &transition{done: make(chan struct{})}
+	p.transition = stopping
+	p.mu.Unlock()
+
+	err := p.backend.Stop(ctx)
+
+	p.mu.Lock()
+	p.transition = nil
+	p.mu.Unlock()
+
+	close(stopping.done)
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (p *Proxy) watchIdle(ctx context.Context) {
+	ticker := time.NewTicker(min(p.idleTimeout, maxCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := p.StopIfIdle(ctx)
+			if err != nil {
+				log.Error("Failed to stop machine", "err", err)
+			}
+		}
+	}
+}
+
+// acquire returns the upstream of the started machine, starting it if needed.
+// It waits for the machine to be started or stopped until ctx is done.
+func (p *Proxy) acquire(ctx context.Context) (*upstream, error) {
+	p.mu.Lock()
+
+	for p.upstream == nil {
+		t := p.transition
+		if t == nil {
+			t = &transition{done: make(chan struct{})}
+			p.transition = t
+
+			go p.start(ctx, t)
+		}
+
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.done:
+		}
+
+		if t.err != nil {
+			return nil, t.err
+		}
+
+		p.mu.Lock()
+	}
+
+	p.inflight++
+	p.lastActivity = time.Now()
+
+	up := p.upstream
+	p.mu.Unlock()
+
+	return up, nil
+}
+
+// start starts the machine, records its upstream or the error, and completes the given transition.
+func (p *Proxy) start(ctx context.Context, t *transition) {
+	log.Info("Request received, starting machine")
+
+	// The machine keeps starting even if the client which triggered the start goes away,
+	// but requests waiting for it must not be held forever.
+	startCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.startTimeout)
+	defer cancel()
+
+	baseURL, httpClient, closeFn, err := p.backend.Start(startCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("machine not ready after %s: %w", p.startTimeout, err)
+	}
+
+	p.mu.Lock()
+
+	if err == nil {
+		p.upstream = p.newUpstream(baseURL, httpClient, closeFn)
+		p.lastActivity = time.Now()
+
+		log.Info("Machine ready, forwarding requests")
+	}
+
+	t.err = err
+	p.transition = nil
+	p.mu.Unlock()
+
+	close(t.done)
+}
+
+func (p *Proxy) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inflight--
+	p.lastActivity = time.Now()
+}
+
+func (p *Proxy) newUpstream(baseURL *url.URL, httpClient *http.Client, closeFn func() error) *upstream {
+	up := &upstream{close: closeFn}
+	up.handler = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(baseURL)
+		},
+		Transport: httpClient.Transport,
+		// Flush immediately, so streamed responses reach the client as they are generated.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Error("Failed to forward request", "path", r.URL.Path, "err", err)
+
+			// The connection to the machine may be broken, reconnect on the next request.
+			p.mu.Lock()
+			p.resetUpstream(up)
+			p.mu.Unlock()
+
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	return up
+}
+
+// resetUpstream releases the given upstream if it is still the current one.
+// The caller must hold p.mu.
+func (p *Proxy) resetUpstream(up *upstream) {
+	if p.upstream != up {
+		return
+	}
+
+	p.upstream = nil
+
+	err := up.close()
+	if err != nil {
+		log.Error("Failed to close connection to machine", "err", err)
+	}
+}
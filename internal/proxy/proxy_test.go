@@ -0,0 +1,221 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/internal/proxy"
+	. "github.com/onsi/gomega"
+)
+
+type fakeBackend struct {
+	server   *httptest.Server
+	startErr error
+	// hang makes Start block until its context is done, as when Ollama never gets ready.
+	hang   bool
+	starts atomic.Int32
+	stops  atomic.Int32
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	return &fakeBackend{server: server}
+}
+
+func (b *fakeBackend) Start(ctx context.Context) (*url.URL, *http.Client, func() error, error) {
+	b.starts.Add(1)
+
+	if b.hang {
+		<-ctx.Done()
+
+		return nil, nil, nil, ctx.Err()
+	}
+
+	if b.startErr != nil {
+		return nil, nil, nil, b.startErr
+	}
+
+	// Simulate a machine taking some time to boot.
+	time.Sleep(10 * time.Millisecond)
+
+	baseURL, err := url.Parse(b.server.URL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return baseURL, b.server.Client(), func() error { return nil }, nil
+}
+
+func (b *fakeBackend) Stop(_ context.Context) error {
+	b.stops.Add(1)
+
+	return nil
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	// Errors are reported using t.Error, as requests may be sent from other goroutines.
+	resp, err := http.Get(url) //nolint:noctx
+	if err != nil {
+		t.Error(err)
+
+		return 0, ""
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
+
+func TestProxyStartsMachineOnce(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := newFakeBackend(t)
+	server := httptest.NewServer(proxy.New(backend, time.Hour, time.Minute))
+	t.Cleanup(server.Close)
+
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			status, body := get(t, server.URL+"/api/tags")
+			g.Expect(status).To(Equal(http.StatusOK))
+			g.Expect(body).To(Equal("GET /api/tags"))
+		}()
+	}
+	wg.Wait()
+
+	g.Expect(backend.starts.Load()).To(Equal(int32(1)))
+}
+
+func TestProxyStartFailure(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := newFakeBackend(t)
+	backend.startErr = errors.New("quota exceeded")
+	server := httptest.NewServer(proxy.New(backend, time.Hour, time.Minute))
+	t.Cleanup(server.Close)
+
+	status, body := get(t, server.URL+"/api/tags")
+	g.Expect(status).To(Equal(http.StatusServiceUnavailable))
+	g.Expect(body).To(ContainSubstring("quota exceeded"))
+}
+
+func TestProxyStartTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := newFakeBackend(t)
+	backend.hang = true
+	server := httptest.NewServer(proxy.New(backend, time.Hour, 20*time.Millisecond))
+	t.Cleanup(server.Close)
+
+	status, body := get(t, server.URL+"/api/tags")
+	g.Expect(status).To(Equal(http.StatusServiceUnavailable))
+	g.Expect(body).To(ContainSubstring("machine not ready after 20ms"))
+
+	// The next request tries to start the machine again.
+	status, _ = get(t, server.URL+"/api/tags")
+	g.Expect(status).To(Equal(http.StatusServiceUnavailable))
+	g.Expect(backend.starts.Load()).To(Equal(int32(2)))
+}
+
+func TestProxyStopsIdleMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := newFakeBackend(t)
+	p := proxy.New(backend, 20*time.Millisecond, time.Minute)
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+
+	stopped, err := p.StopIfIdle(t.Context())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stopped).To(BeFalse(), "machine was never started")
+
+	status, _ := get(t, server.URL+"/api/version")
+	g.Expect(status).To(Equal(http.StatusOK))
+
+	stopped, err = p.StopIfIdle(t.Context())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stopped).To(BeFalse(), "machine is not idle yet")
+
+	time.Sleep(30 * time.Millisecond)
+
+	stopped, err = p.StopIfIdle(t.Context())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stopped).To(BeTrue())
+	g.Expect(backend.stops.Load()).To(Equal(int32(1)))
+
+	status, _ = get(t, server.URL+"/api/version")
+	g.Expect(status).To(Equal(http.StatusOK))
+	g.Expect(backend.starts.Load()).To(Equal(int32(2)))
+}
+
+func TestProxyWaitsForStartWithoutLocking(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := newFakeBackend(t)
+	backend.hang = true
+	p := proxy.New(backend, time.Millisecond, time.Minute)
+	server := httptest.NewServer(p)
+	t.Cleanup(server.Close)
+
+	// The request gives up on its own deadline, while the machine keeps starting.
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/tags", nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, err = http.DefaultClient.Do(req) //nolint:bodyclose
+	g.Expect(err).To(MatchError(context.DeadlineExceeded))
+
+	// Checking whether the machine is idle doesn't wait for the start.
+	stopped, err := p.StopIfIdle(t.Context())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stopped).To(BeFalse())
+	g.Expect(backend.starts.Load()).To(Equal(int32(1)))
+	g.Expect(backend.stops.Load()).To(BeZero())
+}
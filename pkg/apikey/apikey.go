@@ -0,0 +1,120 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package apikey generates and verifies API keys. Only the hash of keys is stored.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// Prefix is the prefix of generated API keys, making them easy to identify.
+	Prefix = "om-"
+
+	secretSize = 32
+	idSize     = 4
+)
+
+// Key is a stored API key.
+type Key struct {
+	// ID identifies the key, so it can be revoked.
+	ID string `json:"id"`
+	// Name describes what the key is used for.
+	Name string `json:"name"`
+	// Hash is the hex encoded SHA-256 hash of the key.
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Generate generates a new API key with the given name.
+// It returns the key, which must be shown to the user as it can't be retrieved later, and its stored form.
+func Generate(name string) (string, Key, error) {
+	secret := make([]byte, secretSize)
+
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", Key{}, fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	id := make([]byte, idSize)
+
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", Key{}, fmt.Errorf("failed to generate api key id: %w", err)
+	}
+
+	token := Prefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	return token, Key{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      Hash(token),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the given key.
+// Keys are random, so they don't need a slow password hashing function.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify returns the stored key matching the given token, if any.
+func Verify(keys []Key, token string) (*Key, bool) {
+	hash := []byte(Hash(token))
+
+	for i := range keys {
+		if subtle.ConstantTimeCompare(hash, []byte(keys[i].Hash)) == 1 {
+			return &keys[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// ReadFile reads keys from the given JSON file.
+func ReadFile(path string) ([]Key, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Key{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []Key{}
+
+	err = json.Unmarshal(content, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode api keys: %w", err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,102 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package apikey_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	. "github.com/onsi/gomega"
+)
+
+func TestGenerateAndVerify(t *testing.T) {
+	g := NewWithT(t)
+
+	token, key, err := apikey.Generate("ci")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(token).To(HavePrefix(apikey.Prefix))
+	g.Expect(key.Name).To(Equal("ci"))
+	g.Expect(key.ID).To(HaveLen(8))
+	g.Expect(key.Hash).NotTo(ContainSubstring(strings.TrimPrefix(token, apikey.Prefix)))
+
+	otherToken, otherKey, err := apikey.Generate("app")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(otherToken).NotTo(Equal(token))
+
+	keys := []apikey.Key{key, otherKey}
+
+	found, ok := apikey.Verify(keys, otherToken)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(found.ID).To(Equal(otherKey.ID))
+
+	_, ok = apikey.Verify(keys, token+"x")
+	g.Expect(ok).To(BeFalse())
+
+	_, ok = apikey.Verify(nil, token)
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestReadFile(t *testing.T) {
+	tests := map[string]struct {
+		content  *string
+		keys     int
+		errorMsg string
+	}{
+		"missing file": {
+			content: nil,
+			keys:    0,
+		},
+		"keys": {
+			content: ptr(`[{"id":"a1b2c3d4","name":"ci","hash":"abc","createdAt":"2025-01-26T20:00:00Z"}]`),
+			keys:    1,
+		},
+		"invalid file": {
+			content:  ptr(`{`),
+			errorMsg: "failed to decode api keys",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			path := filepath.Join(t.TempDir(), "apikeys.json")
+			if tt.content != nil {
+				g.Expect(os.WriteFile(path, []byte(*tt.content), 0o600)).To(Succeed())
+			}
+
+			keys, err := apikey.ReadFile(path)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(keys).To(HaveLen(tt.keys))
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,321 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cloudflare is a minimal client of the Cloudflare API managing tunnels, DNS records and Access applications.
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIURL is the URL of the Cloudflare API.
+const APIURL = "https://api.cloudflare.com/client/v4"
+
+// Client is a Cloudflare API client.
+type Client struct {
+	// BaseURL is the URL of the Cloudflare API, APIURL when empty.
+	BaseURL    string
+	HTTPClient *http.Client
+
+	credentials *Credentials
+}
+
+// NewClient returns a new Cloudflare API client using the given credentials.
+func NewClient(credentials *Credentials) *Client {
+	return &Client{
+		BaseURL:     APIURL,
+		HTTPClient:  http.DefaultClient,
+		credentials: credentials,
+	}
+}
+
+// Tunnel is a Cloudflare Tunnel.
+type Tunnel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// IngressRule routes requests for a hostname to a service reachable from the tunnel connector.
+type IngressRule struct {
+	Hostname      string         `json:"hostname,omitempty"`
+	Service       string         `json:"service"`
+	OriginRequest *OriginRequest `json:"originRequest,omitempty"`
+}
+
+// OriginRequest configures how the tunnel connector reaches a service.
+type OriginRequest struct {
+	HTTPHostHeader string `json:"httpHostHeader,omitempty"`
+}
+
+// ServiceToken is a Cloudflare Access service token.
+type ServiceToken struct {
+	ID           string `json:"id"`
+	ClientID     string `json:"client_id"`     //nolint:tagliatelle
+	ClientSecret string `json:"client_secret"` //nolint:tagliatelle
+}
+
+type response struct {
+	Success bool            `json:"success"`
+	Errors  []responseError `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type idResult struct {
+	ID string `json:"id"`
+}
+
+// CreateTunnel creates a remotely-managed tunnel with the given name.
+func (c *Client) CreateTunnel(ctx context.Context, name string) (*Tunnel, error) {
+	result := &Tunnel{}
+
+	err := c.do(ctx, http.MethodPost, c.accountPath("cfd_tunnel"), map[string]any{
+		"name":       name,
+		"config_src": "cloudflare",
+	}, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel: %w", err)
+	}
+
+	return result, nil
+}
+
+// TunnelToken returns the token used by connectors to run the given tunnel.
+func (c *Client) TunnelToken(ctx context.Context, tunnelID string) (string, error) {
+	var result string
+
+	err := c.do(ctx, http.MethodGet, c.accountPath("cfd_tunnel", tunnelID, "token"), nil, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to get tunnel token: %w", err)
+	}
+
+	return result, nil
+}
+
+// ConfigureTunnel sets the ingress rules of the given tunnel.
+// A catch-all rule answering 404 is appended, as required by Cloudflare.
+func (c *Client) ConfigureTunnel(ctx context.Context, tunnelID string, rules []IngressRule) error {
+	rules = append(rules, IngressRule{Service: "http_status:404"})
+
+	err := c.do(ctx, http.MethodPut, c.accountPath("cfd_tunnel", tunnelID, "configurations"), map[string]any{
+		"config": map[string]any{
+			"ingress": rules,
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to configure tunnel: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTunnel deletes the given tunnel, cleaning up its stale connections first.
+func (c *Client) DeleteTunnel(ctx context.Context, tunnelID string) error {
+	err := c.do(ctx, http.MethodDelete, c.accountPath("cfd_tunnel", tunnelID, "connections"), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to clean up tunnel connections: %w", err)
+	}
+
+	err = c.do(ctx, http.MethodDelete, c.accountPath("cfd_tunnel", tunnelID), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete tunnel: %w", err)
+	}
+
+	return nil
+}
+
+// CreateTunnelDNSRecord creates a proxied CNAME record routing the given hostname to the tunnel.
+// It returns the ID of the record.
+func (c *Client) CreateTunnelDNSRecord(ctx context.Context, zoneID, hostname, tunnelID string) (string, error) {
+	result := &idResult{}
+
+	err := c.do(ctx, http.MethodPost, zonePath(zoneID, "dns_records"), map[string]any{
+		"type":    "CNAME",
+		"name":    hostname,
+		"content": tunnelID + ".cfargotunnel.com",
+		"proxied": true,
+		"comment": "Managed by ollama-machine",
+	}, result)
+	if err != nil {
+		return "", fmt.Errorf("failed to create DNS record: %w", err)
+	}
+
+	return result.ID, nil
+}
+
+// DeleteDNSRecord deletes the given DNS record.
+func (c *Client) DeleteDNSRecord(ctx context.Context, zoneID, recordID string) error {
+	err := c.do(ctx, http.MethodDelete, zonePath(zoneID, "dns_records", recordID), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete DNS record: %w", err)
+	}
+
+	return nil
+}
+
+// CreateServiceToken creates an Access service token with the given name.
+func (c *Client) CreateServiceToken(ctx context.Context, name string) (*ServiceToken, error) {
+	result := &ServiceToken{}
+
+	err := c.do(ctx, http.MethodPost, c.accountPath("access", "service_tokens"), map[string]any{
+		"name": name,
+	}, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service token: %w", err)
+	}
+
+	return result, nil
+}
+
+// DeleteServiceToken deletes the given Access service token.
+func (c *Client) DeleteServiceToken(ctx context.Context, tokenID string) error {
+	err := c.do(ctx, http.MethodDelete, c.accountPath("access", "service_tokens", tokenID), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete service token: %w", err)
+	}
+
+	return nil
+}
+
+// CreateAccessApplication creates an Access application protecting the given hostname,
+// only allowing requests authenticated with the given service token.
+// It returns the ID of the application.
+func (c *Client) CreateAccessApplication(ctx context.Context, name, hostname, serviceTokenID string) (string, error) {
+	result := &idResult{}
+
+	err := c.do(ctx, http.MethodPost, c.accountPath("access", "apps"), map[string]any{
+		"name":   name,
+		"domain": hostname,
+		"type":   "self_hosted",
+		"policies": []map[string]any{
+			{
+				"name":     name,
+				"decision": "non_identity",
+				"include": []map[string]any{
+					{"service_token": map[string]any{"token_id": serviceTokenID}},
+				},
+			},
+		},
+	}, result)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Access application: %w", err)
+	}
+
+	return result.ID, nil
+}
+
+// DeleteAccessApplication deletes the given Access application.
+func (c *Client) DeleteAccessApplication(ctx context.Context, applicationID string) error {
+	err := c.do(ctx, http.MethodDelete, c.accountPath("access", "apps", applicationID), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete Access application: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) accountPath(elements ...string) string {
+	return "/accounts/" + url.PathEscape(c.credentials.AccountID) + "/" + joinPath(elements)
+}
+
+func zonePath(zoneID string, elements ...string) string {
+	return "/zones/" + url.PathEscape(zoneID) + "/" + joinPath(elements)
+}
+
+func joinPath(elements []string) string {
+	escaped := make([]string, 0, len(elements))
+	for _, element := range elements {
+		escaped = append(escaped, url.PathEscape(element))
+	}
+
+	return strings.Join(escaped, "/")
+}
+
+// do sends a request to the Cloudflare API and decodes the result of the response into result, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.credentials.APIToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	decoded := &response{}
+
+	err = json.NewDecoder(resp.Body).Decode(decoded)
+	if err != nil {
+		return fmt.Errorf("failed to decode response with status %s: %w", resp.Status, err)
+	}
+
+	if !decoded.Success || resp.StatusCode >= http.StatusBadRequest {
+		messages := make([]string, 0, len(decoded.Errors))
+		for _, responseErr := range decoded.Errors {
+			messages = append(messages, fmt.Sprintf("%s (code %d)", responseErr.Message, responseErr.Code))
+		}
+
+		if len(messages) == 0 {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+
+		return errors.New(strings.Join(messages, ", "))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(decoded.Result, result)
+	if err != nil {
+		return fmt.Errorf("failed to decode result: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudflare_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudflare"
+	. "github.com/onsi/gomega"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *cloudflare.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := cloudflare.NewClient(&cloudflare.Credentials{AccountID: "account", APIToken: "secret"})
+	client.BaseURL = server.URL
+
+	return client
+}
+
+func TestCreateTunnel(t *testing.T) {
+	g := NewWithT(t)
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Method).To(Equal(http.MethodPost))
+		g.Expect(r.URL.Path).To(Equal("/accounts/account/cfd_tunnel"))
+		g.Expect(r.Header.Get("Authorization")).To(Equal("Bearer secret"))
+
+		body := map[string]any{}
+		g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+		g.Expect(body).To(Equal(map[string]any{"name": "ollama-machine-test", "config_src": "cloudflare"}))
+
+		_, _ = w.Write([]byte(`{"success": true, "errors": [], "result": {"id": "tunnel-id", "name": "ollama-machine-test"}}`))
+	})
+
+	tunnel, err := client.CreateTunnel(t.Context(), "ollama-machine-test")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(tunnel).To(Equal(&cloudflare.Tunnel{ID: "tunnel-id", Name: "ollama-machine-test"}))
+}
+
+func TestConfigureTunnel(t *testing.T) {
+	g := NewWithT(t)
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Method).To(Equal(http.MethodPut))
+		g.Expect(r.URL.Path).To(Equal("/accounts/account/cfd_tunnel/tunnel-id/configurations"))
+
+		body := map[string]any{}
+		g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+		g.Expect(body).To(Equal(map[string]any{
+			"config": map[string]any{
+				"ingress": []any{
+					map[string]any{
+						"hostname":      "ollama.example.com",
+						"service":       "http://localhost:11434",
+						"originRequest": map[string]any{"httpHostHeader": "localhost:11434"},
+					},
+					map[string]any{"service": "http_status:404"},
+				},
+			},
+		}))
+
+		_, _ = w.Write([]byte(`{"success": true, "errors": [], "result": {}}`))
+	})
+
+	err := client.ConfigureTunnel(t.Context(), "tunnel-id", []cloudflare.IngressRule{
+		{
+			Hostname:      "ollama.example.com",
+			Service:       "http://localhost:11434",
+			OriginRequest: &cloudflare.OriginRequest{HTTPHostHeader: "localhost:11434"},
+		},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestAPIErrors(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		body       string
+		errorMsg   string
+	}{
+		"api errors": {
+			statusCode: http.StatusBadRequest,
+			body:       `{"success": false, "errors": [{"code": 81053, "message": "An A, AAAA, or CNAME record with that host already exists."}], "result": null}`,
+			errorMsg:   "failed to create DNS record: An A, AAAA, or CNAME record with that host already exists. (code 81053)",
+		},
+		"error without details": {
+			statusCode: http.StatusForbidden,
+			body:       `{"success": false, "errors": [], "result": null}`,
+			errorMsg:   "unexpected status 403 Forbidden",
+		},
+		"invalid response": {
+			statusCode: http.StatusBadGateway,
+			body:       `<html>Bad gateway</html>`,
+			errorMsg:   "failed to decode response with status 502 Bad Gateway",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			})
+
+			_, err := client.CreateTunnelDNSRecord(t.Context(), "zone", "ollama.example.com", "tunnel-id")
+			g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+		})
+	}
+}
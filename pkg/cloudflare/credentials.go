@@ -0,0 +1,73 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cloudflare
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// CredentialsKind is the kind under which Cloudflare credentials are stored in the credentials store.
+const CredentialsKind = "cloudflare"
+
+// Credentials are the credentials of a Cloudflare account.
+// The API token needs the Cloudflare Tunnel, DNS and, to protect tunnels with Cloudflare Access,
+// the Access apps and policies and the Access service tokens edit permissions.
+type Credentials struct {
+	AccountID string `json:"accountId"`
+	APIToken  string `json:"apiToken"`
+
+	apiTokenFromStdin bool `json:"-"`
+}
+
+func (c *Credentials) Complete() error {
+	if c.apiTokenFromStdin {
+		tokenFromStdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		token := strings.TrimSuffix(string(tokenFromStdin), "\n")
+		token = strings.TrimSuffix(token, "\r")
+
+		c.APIToken = token
+	}
+
+	return nil
+}
+
+func (c *Credentials) Validate() error {
+	if c.AccountID == "" {
+		return errors.New("account-id is required")
+	}
+
+	if c.APIToken == "" {
+		return errors.New("api-token is required")
+	}
+
+	return nil
+}
+
+func (c *Credentials) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.AccountID, "account-id", "", "Cloudflare account ID")
+	fs.StringVar(&c.APIToken, "api-token", "", "Cloudflare API token")
+	fs.BoolVar(&c.apiTokenFromStdin, "api-token-from-stdin", false, "Read Cloudflare API token from stdin")
+}
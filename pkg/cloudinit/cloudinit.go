@@ -27,12 +27,13 @@ import (
 
 // Config represents the main cloud-init configuration structure.
 type Config struct {
-	Hostname          string     `yaml:"hostname,omitempty"`
-	SSHAuthorizedKeys []string   `yaml:"ssh_authorized_keys,omitempty"` //nolint:tagliatelle
-	Users             []User     `yaml:"users,omitempty"`
-	RunCmd            [][]string `yaml:"runcmd,omitempty"`
-	Bootcmd           []string   `yaml:"bootcmd,omitempty"`
-	WriteFiles        []File     `yaml:"write_files,omitempty"` //nolint:tagliatelle
+	Hostname          string      `yaml:"hostname,omitempty"`
+	SSHAuthorizedKeys []string    `yaml:"ssh_authorized_keys,omitempty"` //nolint:tagliatelle
+	Users             []User      `yaml:"users,omitempty"`
+	RunCmd            [][]string  `yaml:"runcmd,omitempty"`
+	Bootcmd           []string    `yaml:"bootcmd,omitempty"`
+	WriteFiles        []File      `yaml:"write_files,omitempty"` //nolint:tagliatelle
+	PowerState        *PowerState `yaml:"power_state,omitempty"` //nolint:tagliatelle
 }
 
 // User represents a user configuration.
@@ -54,6 +55,14 @@ type File struct {
 	Encoding    string `yaml:"encoding,omitempty"`
 }
 
+// PowerState represents a power state change applied once cloud-init is done.
+type PowerState struct {
+	Mode      string `yaml:"mode"`
+	Message   string `yaml:"message,omitempty"`
+	Timeout   int    `yaml:"timeout,omitempty"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
 // NewConfig creates a new cloud-init configuration.
 func NewConfig() *Config {
 	return &Config{}
@@ -79,6 +88,11 @@ func (c *Config) AddFile(file File) {
 	c.WriteFiles = append(c.WriteFiles, file)
 }
 
+// SetPowerState sets the power state change to apply once cloud-init is done.
+func (c *Config) SetPowerState(powerState PowerState) {
+	c.PowerState = &powerState
+}
+
 // Marshal returns the YAML representation of the configuration.
 func (c *Config) Marshal() ([]byte, error) {
 	return yaml.Marshal(c)
@@ -203,3 +203,16 @@ func TestRender(t *testing.T) {
 	g.Expect(rendered).To(HavePrefix("#cloud-config\n"))
 	g.Expect(rendered).To(ContainSubstring("hostname: testhost"))
 }
+
+func TestSetPowerState(t *testing.T) {
+	g := NewWithT(t)
+	config := cloudinit.NewConfig()
+	config.SetPowerState(cloudinit.PowerState{
+		Mode:      "reboot",
+		Condition: "test -f /run/reboot-required",
+	})
+
+	data, err := config.Marshal()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring("power_state:\n    mode: reboot\n    condition: test -f /run/reboot-required\n"))
+}
@@ -28,6 +28,9 @@ func Init() error {
 	return errors.Join(
 		os.MkdirAll(GetMachineDir(), 0o750),    //nolint:mnd
 		os.MkdirAll(GetMachineKeyDir(), 0o750), //nolint:mnd
+		os.MkdirAll(GetWireGuardDir(), 0o700),  //nolint:mnd
+		os.MkdirAll(GetTailscaleDir(), 0o700),  //nolint:mnd
+		os.MkdirAll(GetTunnelDir(), 0o700),     //nolint:mnd
 	)
 }
 
@@ -43,6 +46,21 @@ func GetMachineKeyDir() string {
 	return filepath.Join(getBaseDir(), "keys")
 }
 
+// GetWireGuardDir returns the directory where WireGuard client configurations are stored.
+func GetWireGuardDir() string {
+	return filepath.Join(getBaseDir(), "wireguard")
+}
+
+// GetTailscaleDir returns the directory where the state of the embedded Tailscale node is stored.
+func GetTailscaleDir() string {
+	return filepath.Join(getBaseDir(), "tailscale")
+}
+
+// GetTunnelDir returns the directory where the states and logs of running tunnels are stored.
+func GetTunnelDir() string {
+	return filepath.Join(getBaseDir(), "tunnels")
+}
+
 func getHomeDir() string {
 	if runtime.GOOS == "windows" {
 		return os.Getenv("USERPROFILE")
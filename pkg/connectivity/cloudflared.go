@@ -0,0 +1,257 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudcredentials"
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudflare"
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/spf13/pflag"
+)
+
+// CloudflaredProvider is a connectivity provider exposing ollama through a Cloudflare Tunnel,
+// giving a stable HTTPS hostname without opening any port. Ollama itself only listens on localhost.
+// The tunnel and its DNS record are created before the machine and removed when it is deleted.
+type CloudflaredProvider struct {
+	// CredentialsName is the name of the Cloudflare credentials in the credentials store.
+	CredentialsName string
+	// ZoneID is the ID of the zone of the hostname.
+	ZoneID string
+	// Hostname is the public hostname routed to the tunnel.
+	Hostname string
+	// Access protects the hostname with a Cloudflare Access service token.
+	Access bool
+	// Client is the Cloudflare API client, created from the credentials store when nil.
+	Client *cloudflare.Client
+
+	config *machine.CloudflareConfig
+	token  string
+}
+
+// Name returns the name of the provider.
+func (p *CloudflaredProvider) Name() string {
+	return "cloudflared"
+}
+
+// RegisterFlags registers the flags of the provider.
+func (p *CloudflaredProvider) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&p.CredentialsName, "cloudflared", "", "The name of the Cloudflare credentials used to expose Ollama through a Cloudflare Tunnel")
+	fs.StringVar(&p.ZoneID, "cloudflared-zone-id", "", "The ID of the Cloudflare zone of the tunnel hostname")
+	fs.StringVar(&p.Hostname, "cloudflared-hostname", "", "The public hostname routed to the Cloudflare Tunnel, such as ollama.example.com")
+	fs.BoolVar(&p.Access, "cloudflared-access", false, "Protect the Cloudflare Tunnel hostname with a Cloudflare Access service token")
+}
+
+// IsConfigured returns whether any of the Cloudflare Tunnel flags is set.
+func (p *CloudflaredProvider) IsConfigured() bool {
+	return p.CredentialsName != "" || p.ZoneID != "" || p.Hostname != "" || p.Access
+}
+
+// Validate checks the credentials, the zone and the hostname of the tunnel are set.
+func (p *CloudflaredProvider) Validate() error {
+	if p.CredentialsName == "" {
+		return errors.New("the name of the Cloudflare credentials is required with the cloudflared connectivity")
+	}
+
+	if p.ZoneID == "" || p.Hostname == "" {
+		return errors.New("a zone ID and a hostname are required with the cloudflared connectivity")
+	}
+
+	return nil
+}
+
+// Credentials returns the Cloudflare credentials.
+func (p *CloudflaredProvider) Credentials() []cloudcredentials.Key {
+	return []cloudcredentials.Key{{Name: p.CredentialsName, Provider: cloudflare.CredentialsKind}}
+}
+
+// Prepare creates the tunnel routing the hostname to Ollama, its DNS record and, if requested, the Access application protecting it.
+// Resources already created are removed when a step fails.
+func (p *CloudflaredProvider) Prepare(ctx context.Context, machineName string) error {
+	client, err := p.client(p.CredentialsName)
+	if err != nil {
+		return err
+	}
+
+	name := "ollama-machine-" + machineName
+
+	tunnel, err := client.CreateTunnel(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	p.config = &machine.CloudflareConfig{
+		CredentialsName: p.CredentialsName,
+		ZoneID:          p.ZoneID,
+		Hostname:        p.Hostname,
+		TunnelID:        tunnel.ID,
+	}
+
+	err = p.prepare(ctx, client, name)
+	if err != nil {
+		return errors.Join(err, teardownCloudflare(ctx, client, p.config))
+	}
+
+	return nil
+}
+
+func (p *CloudflaredProvider) prepare(ctx context.Context, client *cloudflare.Client, name string) error {
+	err := client.ConfigureTunnel(ctx, p.config.TunnelID, []cloudflare.IngressRule{
+		{
+			Hostname: p.Hostname,
+			Service:  fmt.Sprintf("http://localhost:%d", ollama.DefaultPort),
+			OriginRequest: &cloudflare.OriginRequest{
+				// Ollama only accepts requests for local hosts when it listens on localhost.
+				HTTPHostHeader: fmt.Sprintf("localhost:%d", ollama.DefaultPort),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	p.token, err = client.TunnelToken(ctx, p.config.TunnelID)
+	if err != nil {
+		return err
+	}
+
+	p.config.DNSRecordID, err = client.CreateTunnelDNSRecord(ctx, p.ZoneID, p.Hostname, p.config.TunnelID)
+	if err != nil {
+		return err
+	}
+
+	if !p.Access {
+		return nil
+	}
+
+	serviceToken, err := client.CreateServiceToken(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	p.config.ServiceTokenID = serviceToken.ID
+	p.config.AccessClientID = serviceToken.ClientID
+	p.config.AccessClientSecret = serviceToken.ClientSecret
+
+	p.config.AccessApplicationID, err = client.CreateAccessApplication(ctx, name, p.Hostname, serviceToken.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InstallViaCloudInit installs cloudflared via cloud-init configuration.
+// The tunnel is run once its token is installed by InstallSecrets.
+func (p *CloudflaredProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "localhost")})
+	cloudInit.AddRunCmd([]string{"sh", "-c", strings.Join([]string{
+		"mkdir -p --mode=0755 /usr/share/keyrings",
+		"curl -fsSL https://pkg.cloudflare.com/cloudflare-main.gpg > /usr/share/keyrings/cloudflare-main.gpg",
+		"echo 'deb [signed-by=/usr/share/keyrings/cloudflare-main.gpg] https://pkg.cloudflare.com/cloudflared any main' > /etc/apt/sources.list.d/cloudflared.list",
+		"apt-get update",
+		"apt-get install -y cloudflared",
+	}, " && ")})
+}
+
+// InstallSecrets installs the cloudflared service running the tunnel with its token.
+func (p *CloudflaredProvider) InstallSecrets(config *cloudinit.Config) {
+	config.AddRunCmd([]string{"cloudflared", "service", "install", p.token})
+}
+
+// UninstallCommands removes the cloudflared service, disconnecting the machine from the tunnel.
+func (p *CloudflaredProvider) UninstallCommands() []string {
+	return []string{"cloudflared service uninstall"}
+}
+
+// RetrieveOllamaHost retrieves the Ollama host for the given machine, the hostname routed to the tunnel.
+func (p *CloudflaredProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
+	if m.Cloudflare == nil {
+		return "", errors.New("machine has no Cloudflare tunnel")
+	}
+
+	return m.Cloudflare.Hostname, nil
+}
+
+// ConfigureMachine stores the Cloudflare resources on the machine, so they can be removed when deleting it.
+func (p *CloudflaredProvider) ConfigureMachine(m *machine.Machine) {
+	m.OllamaConfig.Scheme = "https"
+	m.OllamaConfig.Port = PublicTLSPort
+	m.Cloudflare = p.config
+}
+
+// Teardown removes the tunnel of the machine, its DNS record and its Access application.
+func (p *CloudflaredProvider) Teardown(ctx context.Context, m *machine.Machine) error {
+	if m.Cloudflare == nil {
+		return nil
+	}
+
+	client, err := p.client(m.Cloudflare.CredentialsName)
+	if err != nil {
+		return err
+	}
+
+	return teardownCloudflare(ctx, client, m.Cloudflare)
+}
+
+// client returns the Cloudflare API client of the provider, or creates one using the given credentials.
+func (p *CloudflaredProvider) client(credentialsName string) (*cloudflare.Client, error) {
+	if p.Client != nil {
+		return p.Client, nil
+	}
+
+	credentials := &cloudflare.Credentials{}
+
+	err := cloudcredentials.Get(cloudcredentials.Key{
+		Name:     credentialsName,
+		Provider: cloudflare.CredentialsKind,
+	}, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Cloudflare credentials: %w", err)
+	}
+
+	return cloudflare.NewClient(credentials), nil
+}
+
+// teardownCloudflare removes the given Cloudflare resources, carrying on when removing one of them fails.
+func teardownCloudflare(ctx context.Context, client *cloudflare.Client, config *machine.CloudflareConfig) error {
+	var errs []error
+
+	if config.AccessApplicationID != "" {
+		errs = append(errs, client.DeleteAccessApplication(ctx, config.AccessApplicationID))
+	}
+
+	if config.ServiceTokenID != "" {
+		errs = append(errs, client.DeleteServiceToken(ctx, config.ServiceTokenID))
+	}
+
+	if config.DNSRecordID != "" {
+		errs = append(errs, client.DeleteDNSRecord(ctx, config.ZoneID, config.DNSRecordID))
+	}
+
+	errs = append(errs, client.DeleteTunnel(ctx, config.TunnelID))
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,206 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudflare"
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	. "github.com/onsi/gomega"
+)
+
+// fakeCloudflare is a fake Cloudflare API recording the requests it receives.
+type fakeCloudflare struct {
+	mu       sync.Mutex
+	requests []string
+	failOn   string
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	request := r.Method + " " + r.URL.Path
+	f.requests = append(f.requests, request)
+
+	if request == f.failOn {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"success": false, "errors": [{"code": 1000, "message": "failure"}]}`))
+
+		return
+	}
+
+	results := map[string]string{
+		"POST /accounts/account/cfd_tunnel":                `{"id": "tunnel-id"}`,
+		"GET /accounts/account/cfd_tunnel/tunnel-id/token": `"tunnel-token"`,
+		"POST /zones/zone/dns_records":                     `{"id": "record-id"}`,
+		"POST /accounts/account/access/service_tokens":     `{"id": "service-token-id", "client_id": "client-id", "client_secret": "client-secret"}`,
+		"POST /accounts/account/access/apps":               `{"id": "app-id"}`,
+	}
+
+	result, ok := results[request]
+	if !ok {
+		result = "{}"
+	}
+
+	_, _ = w.Write([]byte(`{"success": true, "errors": [], "result": ` + result + `}`))
+}
+
+func (f *fakeCloudflare) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests
+}
+
+func newCloudflaredProvider(t *testing.T, api *fakeCloudflare, access bool) *connectivity.CloudflaredProvider {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client := cloudflare.NewClient(&cloudflare.Credentials{AccountID: "account", APIToken: "secret"})
+	client.BaseURL = server.URL
+
+	return &connectivity.CloudflaredProvider{
+		CredentialsName: "dev",
+		ZoneID:          "zone",
+		Hostname:        "ollama.example.com",
+		Access:          access,
+		Client:          client,
+	}
+}
+
+func TestCloudflaredProviderLifecycle(t *testing.T) {
+	tests := map[string]struct {
+		access           bool
+		prepareRequests  []string
+		config           *machine.CloudflareConfig
+		teardownRequests []string
+	}{
+		"without access": {
+			prepareRequests: []string{
+				"POST /accounts/account/cfd_tunnel",
+				"PUT /accounts/account/cfd_tunnel/tunnel-id/configurations",
+				"GET /accounts/account/cfd_tunnel/tunnel-id/token",
+				"POST /zones/zone/dns_records",
+			},
+			config: &machine.CloudflareConfig{
+				CredentialsName: "dev",
+				ZoneID:          "zone",
+				Hostname:        "ollama.example.com",
+				TunnelID:        "tunnel-id",
+				DNSRecordID:     "record-id",
+			},
+			teardownRequests: []string{
+				"DELETE /zones/zone/dns_records/record-id",
+				"DELETE /accounts/account/cfd_tunnel/tunnel-id/connections",
+				"DELETE /accounts/account/cfd_tunnel/tunnel-id",
+			},
+		},
+		"with access": {
+			access: true,
+			prepareRequests: []string{
+				"POST /accounts/account/cfd_tunnel",
+				"PUT /accounts/account/cfd_tunnel/tunnel-id/configurations",
+				"GET /accounts/account/cfd_tunnel/tunnel-id/token",
+				"POST /zones/zone/dns_records",
+				"POST /accounts/account/access/service_tokens",
+				"POST /accounts/account/access/apps",
+			},
+			config: &machine.CloudflareConfig{
+				CredentialsName:     "dev",
+				ZoneID:              "zone",
+				Hostname:            "ollama.example.com",
+				TunnelID:            "tunnel-id",
+				DNSRecordID:         "record-id",
+				AccessApplicationID: "app-id",
+				ServiceTokenID:      "service-token-id",
+				AccessClientID:      "client-id",
+				AccessClientSecret:  "client-secret",
+			},
+			teardownRequests: []string{
+				"DELETE /accounts/account/access/apps/app-id",
+				"DELETE /accounts/account/access/service_tokens/service-token-id",
+				"DELETE /zones/zone/dns_records/record-id",
+				"DELETE /accounts/account/cfd_tunnel/tunnel-id/connections",
+				"DELETE /accounts/account/cfd_tunnel/tunnel-id",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			api := &fakeCloudflare{}
+			provider := newCloudflaredProvider(t, api, tt.access)
+			g.Expect(provider.Name()).To(Equal("cloudflared"))
+
+			g.Expect(provider.Prepare(t.Context(), "test")).To(Succeed())
+			g.Expect(api.Requests()).To(Equal(tt.prepareRequests))
+
+			cloudInitConfig := &cloudinit.Config{}
+			provider.InstallViaCloudInit(cloudInitConfig)
+			g.Expect(cloudInitConfig.RunCmd).To(HaveLen(2))
+			g.Expect(cloudInitConfig.RunCmd[1][2]).To(HaveSuffix("apt-get install -y cloudflared"))
+			g.Expect(cloudInitConfig.RunCmd[1][2]).NotTo(ContainSubstring("tunnel-token"))
+
+			secrets := &cloudinit.Config{}
+			provider.InstallSecrets(secrets)
+			g.Expect(secrets.RunCmd).To(Equal([][]string{{"cloudflared", "service", "install", "tunnel-token"}}))
+
+			m := &machine.Machine{}
+			provider.ConfigureMachine(m)
+			g.Expect(m.Cloudflare).To(Equal(tt.config))
+			g.Expect(m.OllamaConfig.URL().String()).To(Equal("https://:443"))
+
+			host, err := provider.RetrieveOllamaHost(m)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(host).To(Equal("ollama.example.com"))
+
+			g.Expect(provider.Teardown(t.Context(), m)).To(Succeed())
+			g.Expect(api.Requests()[len(tt.prepareRequests):]).To(Equal(tt.teardownRequests))
+		})
+	}
+}
+
+func TestCloudflaredProviderPrepareRollback(t *testing.T) {
+	g := NewWithT(t)
+
+	api := &fakeCloudflare{failOn: "POST /zones/zone/dns_records"}
+	provider := newCloudflaredProvider(t, api, false)
+
+	err := provider.Prepare(t.Context(), "test")
+	g.Expect(err).To(MatchError(ContainSubstring("failed to create DNS record: failure")))
+	g.Expect(api.Requests()).To(Equal([]string{
+		"POST /accounts/account/cfd_tunnel",
+		"PUT /accounts/account/cfd_tunnel/tunnel-id/configurations",
+		"GET /accounts/account/cfd_tunnel/tunnel-id/token",
+		"POST /zones/zone/dns_records",
+		"DELETE /accounts/account/cfd_tunnel/tunnel-id/connections",
+		"DELETE /accounts/account/cfd_tunnel/tunnel-id",
+	}))
+}
@@ -18,9 +18,10 @@
 package connectivity
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
 )
 
@@ -35,9 +36,9 @@ func (p *PrivateProvider) Name() string {
 }
 
 // InstallViaCloudInit installs the provider via cloud-init configuration.
-// This method does nothing for the private provider.
+// The private provider only makes Ollama listen on localhost.
 func (p *PrivateProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
-	cloudInit.AddRunCmd([]string{"sh", "-c", fmt.Sprintf(`echo "OLLAMA_HOST=localhost" > %s`, machine.OllamaEnvFilePath)})
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "localhost")})
 }
 
 // RetrieveOllamaHost retrieves the Ollama host for the given machine.
@@ -45,3 +46,8 @@ func (p *PrivateProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
 func (p *PrivateProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
 	return "localhost", nil
 }
+
+// Teardown does nothing, the provider doesn't create resources outside of the machine.
+func (p *PrivateProvider) Teardown(_ context.Context, _ *machine.Machine) error {
+	return nil
+}
@@ -39,7 +39,7 @@ func TestPrivateProviderInstallViaCloudInit(t *testing.T) {
 
 	provider.InstallViaCloudInit(cloudInitConfig)
 	g.Expect(cloudInitConfig.RunCmd).To(HaveLen(1))
-	g.Expect(cloudInitConfig.RunCmd[0]).To(Equal([]string{"sh", "-c", `echo "OLLAMA_HOST=localhost" > /home/ollama-machine/env`}))
+	g.Expect(cloudInitConfig.RunCmd[0]).To(Equal([]string{"sh", "-c", `touch '/home/ollama-machine/env' && sed -i '/^OLLAMA_HOST=/d' '/home/ollama-machine/env' && printf '%s\n' 'OLLAMA_HOST=localhost' >> '/home/ollama-machine/env'`}))
 }
 
 func TestPrivateProviderRetrieveOllamaHost(t *testing.T) {
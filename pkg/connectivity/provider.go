@@ -18,8 +18,18 @@
 package connectivity
 
 import (
+	"context"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudcredentials"
 	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/spf13/pflag"
 )
 
 // Provider is an interface that defines the methods that a connectivity provider must implement.
@@ -27,25 +37,90 @@ type Provider interface {
 	Name() string
 	InstallViaCloudInit(cloudInit *cloudinit.Config)
 	RetrieveOllamaHost(m *machine.Machine) (string, error)
+	// Teardown removes the resources created outside of the machine for its connectivity, once it is deleted.
+	Teardown(ctx context.Context, m *machine.Machine) error
 }
 
-// Options are the options for a machine connectivity.
-type Options struct {
-	Public           bool
-	TailscaleAuthKey string
+// Preparer is implemented by providers creating resources before the machine is created.
+type Preparer interface {
+	Prepare(ctx context.Context, machineName string) error
 }
 
-// GetProvider returns the appropriate provider based on the options.
-func GetProvider(opts *Options) Provider {
-	if opts.Public {
-		return &PublicProvider{}
-	}
+// MachineConfigurer is implemented by providers storing connectivity settings on the machine when it is created.
+type MachineConfigurer interface {
+	ConfigureMachine(m *machine.Machine)
+}
+
+// MachineStarter is implemented by providers reconfiguring the machine when it starts again after being stopped.
+type MachineStarter interface {
+	// StartMachine reconfigures the connectivity of the machine, once reachable over SSH.
+	StartMachine(ctx context.Context, m *machine.Machine) error
+}
+
+// SecretsInstaller is implemented by providers needing secrets on the machine.
+// Instance user data can be read by anyone reaching the instance metadata, so secrets aren't written through cloud-init:
+// the configuration filled by InstallSecrets is applied over SSH once cloud-init is done.
+type SecretsInstaller interface {
+	// InstallSecrets adds the files and commands installing the secrets to the given configuration.
+	InstallSecrets(config *cloudinit.Config)
+}
+
+// PortExposer is implemented by providers needing ports opened to the outside world.
+type PortExposer interface {
+	ExposedPorts() []provider.Port
+}
+
+// Uninstaller is implemented by providers installing software on the machine,
+// to remove it when the connectivity of the machine changes.
+type Uninstaller interface {
+	// UninstallCommands returns the shell commands removing the software, run as root.
+	UninstallCommands() []string
+}
 
-	if opts.TailscaleAuthKey != "" {
-		return &TailscaleProvider{
-			AuthKey: opts.TailscaleAuthKey,
-		}
+// Configurable is implemented by providers configured using command line flags.
+type Configurable interface {
+	// RegisterFlags registers the flags of the provider.
+	RegisterFlags(fs *pflag.FlagSet)
+	// IsConfigured returns whether flags of the provider are set,
+	// selecting it when no connectivity is explicitly chosen.
+	IsConfigured() bool
+	// Validate validates the flags of the provider, once it is selected.
+	Validate() error
+}
+
+// CredentialsUser is implemented by providers using entries of the credentials store.
+type CredentialsUser interface {
+	Credentials() []cloudcredentials.Key
+}
+
+// OllamaAddresser is implemented by providers binding Ollama to the address of the machine in a private network,
+// rather than to the loopback interface or to all interfaces.
+type OllamaAddresser interface {
+	// LocalOllamaHost returns the host Ollama listens on, on the machine.
+	LocalOllamaHost(m *machine.Machine) string
+}
+
+// OpenAIRouter is implemented by providers serving the OpenAI-compatible endpoint of the machine over TLS,
+// next to Ollama, instead of it being only reachable on the address Ollama listens on.
+type OpenAIRouter interface {
+	// RouteOpenAI adds the files and commands routing requests to the endpoint while it is installed on the machine,
+	// or removing the route otherwise, to the given configuration applied over SSH.
+	RouteOpenAI(m *machine.Machine, config *cloudinit.Config)
+}
+
+// LocalOllamaURL returns the URL of the Ollama API from the machine itself.
+func LocalOllamaURL(p Provider, m *machine.Machine) *url.URL {
+	host := "127.0.0.1"
+	if addresser, ok := p.(OllamaAddresser); ok {
+		host = addresser.LocalOllamaHost(m)
 	}
 
-	return &PrivateProvider{}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(ollama.DefaultPort))}
+}
+
+// ExposesOllama returns true if the provider exposes the Ollama API to the outside world, without authentication.
+func ExposesOllama(p Provider) bool {
+	portExposer, ok := p.(PortExposer)
+
+	return ok && slices.Contains(portExposer.ExposedPorts(), provider.Port{Protocol: "tcp", Number: ollama.DefaultPort})
 }
@@ -0,0 +1,100 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity_test
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	. "github.com/onsi/gomega"
+)
+
+func TestLocalOllamaURL(t *testing.T) {
+	tests := map[string]struct {
+		provider connectivity.Provider
+		want     string
+	}{
+		"private": {
+			provider: &connectivity.PrivateProvider{},
+			want:     "http://127.0.0.1:11434",
+		},
+		"public": {
+			provider: &connectivity.PublicProvider{},
+			want:     "http://127.0.0.1:11434",
+		},
+		"public-tls": {
+			provider: &connectivity.PublicTLSProvider{},
+			want:     "http://127.0.0.1:11434",
+		},
+		"tailscale": {
+			provider: &connectivity.TailscaleProvider{},
+			want:     "http://100.64.0.1:11434",
+		},
+		"zerotier": {
+			provider: &connectivity.ZeroTierProvider{},
+			want:     "http://100.64.0.1:11434",
+		},
+		"wireguard": {
+			provider: &connectivity.WireGuardProvider{},
+			want:     "http://100.64.0.1:11434",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			m := &machine.Machine{OllamaConfig: machine.OllamaConfig{Host: "100.64.0.1"}}
+			g.Expect(connectivity.LocalOllamaURL(tt.provider, m).String()).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestExposesOllama(t *testing.T) {
+	tests := map[string]struct {
+		provider connectivity.Provider
+		want     bool
+	}{
+		"private": {
+			provider: &connectivity.PrivateProvider{},
+			want:     false,
+		},
+		"public": {
+			provider: &connectivity.PublicProvider{},
+			want:     true,
+		},
+		"public-tls": {
+			provider: &connectivity.PublicTLSProvider{},
+			want:     false,
+		},
+		"wireguard": {
+			provider: &connectivity.WireGuardProvider{},
+			want:     false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(connectivity.ExposesOllama(tt.provider)).To(Equal(tt.want))
+		})
+	}
+}
@@ -18,26 +18,57 @@
 package connectivity
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/spf13/pflag"
 )
 
 // PublicProvider is a public connectivity provider exposing ollama to the outside world.
-type PublicProvider struct{}
+type PublicProvider struct {
+	enabled bool
+}
 
 // Name returns the name of the provider.
 func (p *PublicProvider) Name() string {
 	return "public"
 }
 
+// RegisterFlags registers the flags of the provider.
+func (p *PublicProvider) RegisterFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&p.enabled, "public", false, "Defines if the Ollama instance should be publicly exposed or not (not recommended), if set false you can use SSH tunnel or tailscale to connect to your Ollama instance.")
+}
+
+// IsConfigured returns whether the --public flag is set.
+func (p *PublicProvider) IsConfigured() bool {
+	return p.enabled
+}
+
+// Validate does nothing, the provider has no option.
+func (p *PublicProvider) Validate() error {
+	return nil
+}
+
 // InstallViaCloudInit installs the provider via cloud-init configuration.
 func (p *PublicProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
-	cloudInit.AddRunCmd([]string{"sh", "-c", fmt.Sprintf(`echo "OLLAMA_HOST=0.0.0.0" > %s`, machine.OllamaEnvFilePath)})
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "0.0.0.0")})
+}
+
+// ExposedPorts returns the port of Ollama.
+func (p *PublicProvider) ExposedPorts() []provider.Port {
+	return []provider.Port{{Protocol: "tcp", Number: ollama.DefaultPort}}
 }
 
 // RetrieveOllamaHost retrieves the Ollama host for the given machine.
 func (p *PublicProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
 	return m.IP, nil
 }
+
+// Teardown does nothing, the provider doesn't create resources outside of the machine.
+func (p *PublicProvider) Teardown(_ context.Context, _ *machine.Machine) error {
+	return nil
+}
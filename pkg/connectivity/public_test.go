@@ -40,7 +40,7 @@ func TestPublicProviderInstallViaCloudInit(t *testing.T) {
 
 	provider.InstallViaCloudInit(cloudInitConfig)
 	g.Expect(cloudInitConfig.RunCmd).To(HaveLen(1))
-	g.Expect(cloudInitConfig.RunCmd[0]).To(Equal([]string{"sh", "-c", `echo "OLLAMA_HOST=0.0.0.0" > /home/ollama-machine/env`}))
+	g.Expect(cloudInitConfig.RunCmd[0]).To(Equal([]string{"sh", "-c", `touch '/home/ollama-machine/env' && sed -i '/^OLLAMA_HOST=/d' '/home/ollama-machine/env' && printf '%s\n' 'OLLAMA_HOST=0.0.0.0' >> '/home/ollama-machine/env'`}))
 }
 
 func TestPublicProviderRetrieveOllamaHost(t *testing.T) {
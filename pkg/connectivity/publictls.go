@@ -0,0 +1,335 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// PublicTLSPort is the port the TLS reverse proxy listens on.
+	PublicTLSPort = 443
+
+	publicTLSConfigDir       = "/etc/ollama-machine"
+	publicTLSCertificateFile = "publictls.crt"
+	publicTLSKeyFile         = "publictls.key"
+	caddyConfigDir           = "/etc/caddy"
+
+	tokenLength          = 32
+	certificateValidity  = 10 * 365 * 24 * time.Hour
+	serialNumberBitCount = 128
+)
+
+// PublicTLSProvider is a public connectivity provider exposing ollama through a TLS reverse proxy requiring a bearer token.
+// Ollama itself only listens on localhost.
+// Without domain, the proxy uses a self-signed certificate whose fingerprint is pinned by clients.
+// With a domain, the certificate is issued using ACME.
+type PublicTLSProvider struct {
+	Domain string
+
+	enabled     bool
+	token       string
+	certificate []byte
+	key         []byte
+	fingerprint string
+}
+
+// NewPublicTLSProvider returns a new PublicTLSProvider, generating its token and,
+// when no domain is given, its self-signed certificate.
+func NewPublicTLSProvider(domain string) (*PublicTLSProvider, error) {
+	p := &PublicTLSProvider{Domain: domain}
+
+	err := p.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// RegisterFlags registers the flags of the provider.
+func (p *PublicTLSProvider) RegisterFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&p.enabled, "public-tls", false, "Expose the Ollama instance publicly through a TLS reverse proxy requiring a bearer token, using a self-signed certificate unless --public-tls-domain is set")
+	fs.StringVar(&p.Domain, "public-tls-domain", "", "The domain pointing to the machine, used to get a certificate from Let's Encrypt with --public-tls")
+}
+
+// IsConfigured returns whether the --public-tls or --public-tls-domain flags are set.
+func (p *PublicTLSProvider) IsConfigured() bool {
+	return p.enabled || p.Domain != ""
+}
+
+// Validate does nothing, the domain is checked by Let's Encrypt.
+func (p *PublicTLSProvider) Validate() error {
+	return nil
+}
+
+// Prepare generates the token of the proxy and, when no domain is set, its self-signed certificate.
+func (p *PublicTLSProvider) Prepare(_ context.Context, _ string) error {
+	if p.token != "" {
+		return nil
+	}
+
+	return p.generate()
+}
+
+// generate generates the token of the proxy and, when no domain is set, its self-signed certificate.
+func (p *PublicTLSProvider) generate() error {
+	token := make([]byte, tokenLength)
+
+	_, err := rand.Read(token)
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	p.token = hex.EncodeToString(token)
+
+	if p.Domain == "" {
+		p.certificate, p.key, p.fingerprint, err = generateSelfSignedCertificate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the provider.
+func (p *PublicTLSProvider) Name() string {
+	return "public-tls"
+}
+
+// InstallViaCloudInit binds Ollama to localhost and installs Caddy as the TLS reverse proxy via cloud-init configuration.
+// Caddy stays stopped until its configuration, holding the token, is installed by InstallSecrets.
+func (p *PublicTLSProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "127.0.0.1")})
+	cloudInit.AddRunCmd([]string{"sh", "-c", strings.Join([]string{
+		"apt-get install -y debian-keyring debian-archive-keyring apt-transport-https curl gpg",
+		"curl -1sLf 'https://dl.cloudsmith.io/public/caddy/stable/gpg.key' | gpg --batch --yes --dearmor -o /usr/share/keyrings/caddy-stable-archive-keyring.gpg",
+		"curl -1sLf 'https://dl.cloudsmith.io/public/caddy/stable/debian.deb.txt' > /etc/apt/sources.list.d/caddy-stable.list",
+		"apt-get update",
+		"apt-get install -y caddy",
+		"systemctl disable --now caddy",
+	}, " && ")})
+}
+
+// InstallSecrets installs the Caddy configuration holding the token and, without domain, the certificate and its key,
+// then starts Caddy.
+func (p *PublicTLSProvider) InstallSecrets(config *cloudinit.Config) {
+	// Files are written as root, they are copied to the Caddy configuration directory afterwards.
+	config.AddFile(cloudinit.File{
+		Path:        publicTLSConfigDir + "/Caddyfile",
+		Content:     CaddyConfig(p.Domain, p.token, 0),
+		Permissions: "0600",
+	})
+
+	files := []string{"Caddyfile"}
+
+	if p.Domain == "" {
+		config.AddFile(cloudinit.File{
+			Path:        publicTLSConfigDir + "/" + publicTLSCertificateFile,
+			Content:     string(p.certificate),
+			Permissions: "0644",
+		})
+		config.AddFile(cloudinit.File{
+			Path:        publicTLSConfigDir + "/" + publicTLSKeyFile,
+			Content:     string(p.key),
+			Permissions: "0600",
+		})
+
+		files = append(files, publicTLSCertificateFile, publicTLSKeyFile)
+	}
+
+	installCommands := []string{}
+	for _, file := range files {
+		installCommands = append(installCommands, fmt.Sprintf("install -o caddy -g caddy -m 0600 %s/%s %s/%s", publicTLSConfigDir, file, caddyConfigDir, file))
+	}
+
+	installCommands = append(installCommands, "systemctl enable caddy", "systemctl restart caddy")
+
+	config.AddRunCmd([]string{"sh", "-c", strings.Join(installCommands, " && ")})
+}
+
+// UninstallCommands stops the reverse proxy and removes its configuration.
+func (p *PublicTLSProvider) UninstallCommands() []string {
+	return []string{
+		"systemctl disable --now caddy",
+		fmt.Sprintf("rm -f %[1]s/Caddyfile %[1]s/%[2]s %[1]s/%[3]s %[4]s/Caddyfile %[4]s/%[2]s %[4]s/%[3]s", publicTLSConfigDir, publicTLSCertificateFile, publicTLSKeyFile, caddyConfigDir),
+	}
+}
+
+// RouteOpenAI routes requests to /v1/ to the OpenAI-compatible endpoint while it is installed on the machine,
+// through the reverse proxy serving Ollama, or removes the route once it is uninstalled.
+func (p *PublicTLSProvider) RouteOpenAI(m *machine.Machine, config *cloudinit.Config) {
+	if m.PublicTLS == nil {
+		return
+	}
+
+	openAIPort := 0
+	if m.OpenAI != nil {
+		openAIPort = m.OpenAI.Port
+	}
+
+	config.AddFile(cloudinit.File{
+		Path:        publicTLSConfigDir + "/Caddyfile",
+		Content:     CaddyConfig(m.PublicTLS.Domain, m.PublicTLS.Token, openAIPort),
+		Permissions: "0600",
+	})
+	config.AddRunCmd([]string{"sh", "-c", fmt.Sprintf("install -o caddy -g caddy -m 0600 %[1]s/Caddyfile %[2]s/Caddyfile && systemctl restart caddy", publicTLSConfigDir, caddyConfigDir)})
+}
+
+// RetrieveOllamaHost retrieves the Ollama host for the given machine, its domain if any or its public IP.
+func (p *PublicTLSProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
+	if p.Domain != "" {
+		return p.Domain, nil
+	}
+
+	return m.IP, nil
+}
+
+// ConfigureMachine stores the proxy token and certificate fingerprint on the machine, so clients can reach Ollama.
+func (p *PublicTLSProvider) ConfigureMachine(m *machine.Machine) {
+	m.OllamaConfig.Scheme = "https"
+	m.OllamaConfig.Port = PublicTLSPort
+	m.PublicTLS = &machine.PublicTLSConfig{
+		Domain:                 p.Domain,
+		CertificateFingerprint: p.fingerprint,
+		Token:                  p.token,
+	}
+}
+
+// ExposedPorts returns the ports the reverse proxy listens on.
+// ACME needs port 80 to solve HTTP challenges.
+func (p *PublicTLSProvider) ExposedPorts() []provider.Port {
+	if p.Domain != "" {
+		return []provider.Port{{Protocol: "tcp", Number: 80}, {Protocol: "tcp", Number: PublicTLSPort}} //nolint:mnd
+	}
+
+	return []provider.Port{{Protocol: "tcp", Number: PublicTLSPort}}
+}
+
+// CaddyConfig returns the Caddyfile of the reverse proxy.
+// When domain is empty, the proxy serves the self-signed certificate written by the provider.
+// When openAIPort isn't 0, requests to /v1/ are routed to the OpenAI-compatible endpoint listening on that port,
+// which authenticates them using its own API keys.
+func CaddyConfig(domain, token string, openAIPort int) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString("{\n\tadmin off\n")
+	if domain == "" {
+		fmt.Fprintf(builder, "\tdefault_sni %s\n", machine.PublicTLSServerName)
+	}
+	builder.WriteString("}\n\n")
+
+	if domain == "" {
+		fmt.Fprintf(builder, ":%d {\n", PublicTLSPort)
+		fmt.Fprintf(builder, "\ttls %[1]s/%[2]s %[1]s/%[3]s\n", caddyConfigDir, publicTLSCertificateFile, publicTLSKeyFile)
+	} else {
+		fmt.Fprintf(builder, "%s {\n", domain)
+	}
+
+	indent := "\t"
+
+	if openAIPort != 0 {
+		builder.WriteString("\n\thandle /v1/* {\n")
+		fmt.Fprintf(builder, "\t\treverse_proxy 127.0.0.1:%d {\n", openAIPort)
+		builder.WriteString("\t\t\tflush_interval -1\n")
+		builder.WriteString("\t\t}\n\t}\n\n")
+		builder.WriteString("\thandle {\n")
+
+		indent = "\t\t"
+	}
+
+	fmt.Fprintf(builder, "%s@unauthorized not header Authorization \"Bearer %s\"\n", indent, token)
+	fmt.Fprintf(builder, "%srespond @unauthorized \"Unauthorized\" 401\n\n", indent)
+	fmt.Fprintf(builder, "%sreverse_proxy 127.0.0.1:%d {\n", indent, ollama.DefaultPort)
+	// Ollama only accepts requests for local hosts when it listens on localhost.
+	fmt.Fprintf(builder, "%s\theader_up Host localhost:%d\n", indent, ollama.DefaultPort)
+	fmt.Fprintf(builder, "%s\tflush_interval -1\n", indent)
+	fmt.Fprintf(builder, "%s}\n", indent)
+
+	if openAIPort != 0 {
+		builder.WriteString("\t}\n")
+	}
+
+	builder.WriteString("}\n")
+
+	return builder.String()
+}
+
+// generateSelfSignedCertificate returns a PEM-encoded self-signed certificate, its key and its fingerprint.
+func generateSelfSignedCertificate() ([]byte, []byte, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBitCount))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: machine.PublicTLSServerName},
+		DNSNames:              []string{machine.PublicTLSServerName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to marshal certificate key: %w", err)
+	}
+
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certificatePEM, keyPEM, machine.CertificateFingerprint(der), nil
+}
+
+// Teardown does nothing, the provider doesn't create resources outside of the machine.
+func (p *PublicTLSProvider) Teardown(_ context.Context, _ *machine.Machine) error {
+	return nil
+}
@@ -0,0 +1,150 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudcredentials"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/spf13/pflag"
+)
+
+// DefaultConnectivity is the connectivity of machines when none is chosen.
+const DefaultConnectivity = "private"
+
+// Providers are the constructors of the connectivity providers, by connectivity name.
+var Providers = map[string]func() Provider{ //nolint:gochecknoglobals
+	"private":     func() Provider { return &PrivateProvider{} },
+	"public":      func() Provider { return &PublicProvider{} },
+	"public-tls":  func() Provider { return &PublicTLSProvider{} },
+	"tailscale":   func() Provider { return &TailscaleProvider{} },
+	"zerotier":    func() Provider { return &ZeroTierProvider{} },
+	"cloudflared": func() Provider { return &CloudflaredProvider{} },
+	"wireguard":   func() Provider { return &WireGuardProvider{} },
+}
+
+// Names returns the sorted names of the connectivity providers.
+func Names() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// ForMachine returns the provider of the given machine connectivity, to manage it after the machine is created.
+func ForMachine(m *machine.Machine) Provider {
+	newProvider, ok := Providers[m.Connectivity]
+	if !ok {
+		newProvider = Providers[DefaultConnectivity]
+	}
+
+	return newProvider()
+}
+
+// Selector selects the connectivity provider of a new machine using command line flags.
+type Selector struct {
+	// Name is the name of the connectivity explicitly chosen, if any.
+	Name string
+
+	providers map[string]Provider
+}
+
+// NewSelector returns a new Selector holding a provider of each connectivity.
+func NewSelector() *Selector {
+	providers := make(map[string]Provider, len(Providers))
+	for name, newProvider := range Providers {
+		providers[name] = newProvider()
+	}
+
+	return &Selector{providers: providers}
+}
+
+// RegisterFlags registers the --connectivity flag, and the flags of each provider.
+func (s *Selector) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.Name, "connectivity", "", fmt.Sprintf("The connectivity of the instance, one of %s (defaults to the connectivity whose flags are set, or %s)", strings.Join(Names(), ", "), DefaultConnectivity))
+
+	s.RegisterProviderFlags(fs)
+}
+
+// RegisterProviderFlags registers the flags of each provider, for commands taking the connectivity name as argument.
+func (s *Selector) RegisterProviderFlags(fs *pflag.FlagSet) {
+	for _, name := range Names() {
+		if configurable, ok := s.providers[name].(Configurable); ok {
+			configurable.RegisterFlags(fs)
+		}
+	}
+}
+
+// Provider returns the chosen provider, once validated.
+// Without explicit choice, the provider whose flags are set is chosen, DefaultConnectivity if none.
+func (s *Selector) Provider() (Provider, error) {
+	configured := []string{}
+	for _, name := range Names() {
+		if configurable, ok := s.providers[name].(Configurable); ok && configurable.IsConfigured() {
+			configured = append(configured, name)
+		}
+	}
+
+	name := s.Name
+	if name == "" {
+		switch len(configured) {
+		case 0:
+			name = DefaultConnectivity
+		case 1:
+			name = configured[0]
+		default:
+			return nil, fmt.Errorf("flags of the %s connectivities can't be combined", strings.Join(configured, " and "))
+		}
+	}
+
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown connectivity %q, expected one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	for _, other := range configured {
+		if other != name {
+			return nil, fmt.Errorf("flags of the %s connectivity can't be used with the %s connectivity", other, name)
+		}
+	}
+
+	if configurable, ok := p.(Configurable); ok {
+		err := configurable.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if credentialsUser, ok := p.(CredentialsUser); ok {
+		for _, key := range credentialsUser.Credentials() {
+			err := cloudcredentials.Get(key, &map[string]any{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get %s credentials %q: %w", key.Provider, key.Name, err)
+			}
+		}
+	}
+
+	return p, nil
+}
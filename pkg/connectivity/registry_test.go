@@ -0,0 +1,117 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+func TestSelectorProvider(t *testing.T) {
+	tests := map[string]struct {
+		args     []string
+		name     string
+		errorMsg string
+	}{
+		"default": {
+			name: "private",
+		},
+		"explicit connectivity": {
+			args: []string{"--connectivity", "public"},
+			name: "public",
+		},
+		"connectivity selected by its flags": {
+			args: []string{"--zerotier-network-id", "8056c2e21c000001"},
+			name: "zerotier",
+		},
+		"explicit connectivity with its flags": {
+			args: []string{"--connectivity", "public-tls", "--public-tls-domain", "ollama.example.com"},
+			name: "public-tls",
+		},
+		"unknown connectivity": {
+			args:     []string{"--connectivity", "carrier-pigeon"},
+			errorMsg: `unknown connectivity "carrier-pigeon"`,
+		},
+		"flags of another connectivity": {
+			args:     []string{"--connectivity", "private", "--tailscale-auth-key", "tskey-abcdef"},
+			errorMsg: "flags of the tailscale connectivity can't be used with the private connectivity",
+		},
+		"flags of several connectivities": {
+			args:     []string{"--public", "--wireguard"},
+			errorMsg: "flags of the public and wireguard connectivities can't be combined",
+		},
+		"invalid flags": {
+			args:     []string{"--tailscale-auth-key", "tskey-abcdef", "--tailscale-advertise-tags", "ollama"},
+			errorMsg: `invalid Tailscale tag "ollama"`,
+		},
+		"missing flags": {
+			args:     []string{"--connectivity", "cloudflared"},
+			errorMsg: "the name of the Cloudflare credentials is required",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			selector := connectivity.NewSelector()
+
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			selector.RegisterFlags(fs)
+			g.Expect(fs.Parse(tt.args)).To(Succeed())
+
+			p, err := selector.Provider()
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(p.Name()).To(Equal(tt.name))
+		})
+	}
+}
+
+func TestForMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	for _, name := range connectivity.Names() {
+		g.Expect(connectivity.ForMachine(&machine.Machine{Connectivity: name}).Name()).To(Equal(name))
+	}
+
+	g.Expect(connectivity.ForMachine(&machine.Machine{}).Name()).To(Equal(connectivity.DefaultConnectivity))
+}
+
+func TestProvidersUninstall(t *testing.T) {
+	g := NewWithT(t)
+
+	// Providers only changing the Ollama environment have nothing to remove when the connectivity changes.
+	withoutSoftware := []string{"private", "public"}
+
+	for _, name := range connectivity.Names() {
+		_, ok := connectivity.Providers[name]().(connectivity.Uninstaller)
+		g.Expect(ok).To(Equal(!slices.Contains(withoutSoftware, name)), name)
+	}
+}
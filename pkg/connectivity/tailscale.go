@@ -18,16 +18,44 @@
 package connectivity
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudcredentials"
 	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
 	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
+	"github.com/spf13/pflag"
 )
 
+// TailscaleAuthKeyExpiry is the lifetime of the auth keys minted for machines, long enough for them to boot.
+const TailscaleAuthKeyExpiry = 30 * time.Minute
+
 // TailscaleProvider is a private connectivity provider that exposes ollama through tailscale network.
 type TailscaleProvider struct {
+	// AuthKey is the auth key registering the node, minted using the API credentials when empty.
 	AuthKey string
+	// LoginServer is the URL of a custom control server, such as a Headscale server.
+	LoginServer string
+	// Hostname is the hostname of the node, the machine one when empty.
+	Hostname string
+	// Tags are the tags advertised by the node, such as tag:ollama.
+	Tags []string
+	// Ephemeral registers the node as an ephemeral node, removed by the control server once offline.
+	// Its state is kept in memory, so it registers again, as a new node, when the machine restarts.
+	Ephemeral bool
+	// SSH enables Tailscale SSH on the node.
+	SSH bool
+	// CredentialsName is the name of the Tailscale API credentials used to mint the auth key of the machine
+	// and to remove its node when deleting it.
+	CredentialsName string
+	// Client is the Tailscale API client, created from the credentials store when nil.
+	Client *tailscale.Client
 }
 
 // Name returns the name of the provider.
@@ -35,28 +63,241 @@ func (p *TailscaleProvider) Name() string {
 	return "tailscale"
 }
 
+// RegisterFlags registers the flags of the provider.
+func (p *TailscaleProvider) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&p.AuthKey, "tailscale-auth-key", "", "The Tailscale authentication key to use for the instance")
+	fs.StringVar(&p.LoginServer, "tailscale-login-server", "", "The URL of a custom Tailscale control server, such as a Headscale server")
+	fs.StringVar(&p.Hostname, "tailscale-hostname", "", "The hostname of the instance in the tailnet (defaults to the instance hostname)")
+	fs.StringSliceVar(&p.Tags, "tailscale-advertise-tags", nil, "The tags advertised by the instance in the tailnet, such as tag:ollama")
+	fs.BoolVar(&p.Ephemeral, "tailscale-ephemeral", false, "Register the instance as an ephemeral node, removed from the tailnet once offline")
+	fs.BoolVar(&p.SSH, "tailscale-ssh", false, "Enable Tailscale SSH on the instance")
+	fs.StringVar(&p.CredentialsName, "tailscale-api-credentials", "", "The name of the Tailscale API credentials used to mint the instance auth key when none is given, and to remove the instance from the tailnet when deleting it")
+}
+
+// IsConfigured returns whether any of the Tailscale flags is set.
+func (p *TailscaleProvider) IsConfigured() bool {
+	return p.AuthKey != "" || p.CredentialsName != "" || p.LoginServer != "" || p.Hostname != "" || len(p.Tags) > 0 || p.Ephemeral || p.SSH
+}
+
+// Validate checks an auth key can be used or minted, and the tags are valid.
+func (p *TailscaleProvider) Validate() error {
+	if p.AuthKey == "" && p.CredentialsName == "" {
+		return errors.New("a Tailscale auth key or API credentials are required")
+	}
+
+	for _, tag := range p.Tags {
+		if !strings.HasPrefix(tag, "tag:") {
+			return fmt.Errorf("invalid Tailscale tag %q, tags must start with tag:", tag)
+		}
+	}
+
+	return nil
+}
+
+// Credentials returns the Tailscale API credentials, if any.
+func (p *TailscaleProvider) Credentials() []cloudcredentials.Key {
+	if p.CredentialsName == "" {
+		return nil
+	}
+
+	return []cloudcredentials.Key{{Name: p.CredentialsName, Provider: tailscale.CredentialsKind}}
+}
+
 // InstallViaCloudInit installs tailscale via cloud-init configuration.
 func (p *TailscaleProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
 	cloudInit.AddRunCmd([]string{"sh", "-c", "curl -fsSL https://tailscale.com/install.sh | sh"})
 	cloudInit.AddRunCmd([]string{"sh", "-c", "echo 'net.ipv4.ip_forward = 1' | sudo tee -a /etc/sysctl.d/99-tailscale.conf && echo 'net.ipv6.conf.all.forwarding = 1' | sudo tee -a /etc/sysctl.d/99-tailscale.conf && sudo sysctl -p /etc/sysctl.d/99-tailscale.conf"})
-	cloudInit.AddRunCmd([]string{"sh", "-c", fmt.Sprintf(`tailscale up --auth-key=%s`, p.AuthKey)})
-	cloudInit.AddRunCmd([]string{"sh", "-c", fmt.Sprintf(`echo "OLLAMA_HOST=$(tailscale ip -4)" > %s`, machine.OllamaEnvFilePath)})
+	if p.Ephemeral {
+		cloudInit.AddRunCmd([]string{"sh", "-c", `sed -i 's/^FLAGS=.*/FLAGS="--state=mem:"/' /etc/default/tailscaled && systemctl restart tailscaled`})
+	}
+	cloudInit.AddRunCmd([]string{"sh", "-c", p.upCommand()})
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetExprCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "$(tailscale ip -4)")})
+}
+
+// UninstallCommands logs the node out of the tailnet and removes Tailscale.
+func (p *TailscaleProvider) UninstallCommands() []string {
+	return []string{
+		"tailscale logout || true",
+		"apt-get remove -y tailscale",
+		"rm -f /etc/sysctl.d/99-tailscale.conf",
+	}
+}
+
+// Prepare mints a single-use and pre-authorized auth key for the machine when no auth key is given.
+// The key only registers an ephemeral node for ephemeral machines, so other machines keep their node when stopped.
+func (p *TailscaleProvider) Prepare(ctx context.Context, machineName string) error {
+	if p.AuthKey != "" {
+		return nil
+	}
+
+	if p.CredentialsName == "" {
+		return errors.New("a Tailscale auth key or API credentials are required")
+	}
+
+	client, err := p.client(p.CredentialsName, p.LoginServer)
+	if err != nil {
+		return err
+	}
+
+	key, err := client.CreateAuthKey(ctx, tailscale.AuthKeyOptions{
+		Description:   "ollama-machine " + machineName,
+		Tags:          p.Tags,
+		Ephemeral:     p.Ephemeral,
+		Preauthorized: true,
+		Expiry:        TailscaleAuthKeyExpiry,
+	})
+	if err != nil {
+		return err
+	}
+
+	p.AuthKey = key
+
+	return nil
+}
+
+// upCommand returns the command connecting the node to the tailnet.
+func (p *TailscaleProvider) upCommand() string {
+	args := []string{"tailscale", "up", "--auth-key=" + ssh.Quote(p.AuthKey)}
+
+	if p.LoginServer != "" {
+		args = append(args, "--login-server="+ssh.Quote(p.LoginServer))
+	}
+
+	if p.Hostname != "" {
+		args = append(args, "--hostname="+ssh.Quote(p.Hostname))
+	}
+
+	if len(p.Tags) > 0 {
+		args = append(args, "--advertise-tags="+ssh.Quote(strings.Join(p.Tags, ",")))
+	}
+
+	if p.SSH {
+		args = append(args, "--ssh")
+	}
+
+	return strings.Join(args, " ")
+}
+
+// LocalOllamaHost returns the host Ollama listens on, the address of the machine in the tailnet.
+func (p *TailscaleProvider) LocalOllamaHost(m *machine.Machine) string {
+	return m.OllamaConfig.Host
 }
 
 // RetrieveOllamaHost retrieves the Ollama host for the given machine.
-// Under-the-hood is connects to the machine using SSH and runs `tailscale ip -4` to get the machine's IP.
+// Under-the-hood is connects to the machine using SSH and runs `tailscale status --json` to get the machine's IP,
+// and records the node ID on the machine so it can be removed from the tailnet.
 func (p *TailscaleProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
-	_, sshSession, err := m.SSHClient()
+	client, err := m.SSHDial()
 	if err != nil {
 		return "", fmt.Errorf("failed to create ssh client: %w", err)
 	}
 
-	result, err := sshSession.CombinedOutput("tailscale ip -4")
+	defer func() {
+		_ = client.Close()
+	}()
+
+	result, err := ssh.Run(client, "tailscale status --json")
 	if err != nil {
 		return "", fmt.Errorf("failed to get machine IP: %w", err)
 	}
 
-	ip := strings.Trim(string(result), " \n\t")
+	node, err := tailscale.ParseStatus(result)
+	if err != nil {
+		return "", err
+	}
+
+	if m.Tailscale != nil {
+		m.Tailscale.NodeID = node.ID
+	}
+
+	return node.IP, nil
+}
+
+// ConfigureMachine stores the control server and the API credentials on the machine, so its node can be removed.
+func (p *TailscaleProvider) ConfigureMachine(m *machine.Machine) {
+	m.Tailscale = &machine.TailscaleConfig{
+		LoginServer:     p.LoginServer,
+		CredentialsName: p.CredentialsName,
+		Ephemeral:       p.Ephemeral,
+		Hostname:        p.Hostname,
+		Tags:            p.Tags,
+		SSH:             p.SSH,
+	}
+}
+
+// StartMachine registers ephemeral nodes again, as their state is lost when the machine stops,
+// using a new auth key minted with the API credentials of the machine, and binds Ollama to the new node address.
+func (p *TailscaleProvider) StartMachine(ctx context.Context, m *machine.Machine) error {
+	if m.Tailscale == nil || !m.Tailscale.Ephemeral {
+		return nil
+	}
+
+	if m.Tailscale.CredentialsName == "" {
+		return errors.New("the ephemeral Tailscale node of the machine can't register again without Tailscale API credentials")
+	}
+
+	p.LoginServer = m.Tailscale.LoginServer
+	p.CredentialsName = m.Tailscale.CredentialsName
+	p.Ephemeral = true
+	p.Hostname = m.Tailscale.Hostname
+	p.Tags = m.Tailscale.Tags
+	p.SSH = m.Tailscale.SSH
+	p.AuthKey = ""
+
+	err := p.Prepare(ctx, m.Name)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.SSHDial()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = client.Close()
+	}()
+
+	for _, command := range []string{p.upCommand(), envfile.SetExprCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "$(tailscale ip -4)"), "systemctl restart ollama"} {
+		// Commands are sent on stdin, so the auth key doesn't show up in errors.
+		_, err = ssh.RunWithStdin(client, "sudo sh -s", strings.NewReader(command))
+		if err != nil {
+			return fmt.Errorf("failed to register Tailscale node: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Teardown removes the node of the machine from the tailnet, when the machine has Tailscale API credentials.
+func (p *TailscaleProvider) Teardown(ctx context.Context, m *machine.Machine) error {
+	if m.Tailscale == nil || m.Tailscale.CredentialsName == "" || m.Tailscale.NodeID == "" {
+		return nil
+	}
+
+	client, err := p.client(m.Tailscale.CredentialsName, m.Tailscale.LoginServer)
+	if err != nil {
+		return err
+	}
+
+	return client.DeleteNode(ctx, m.Tailscale.NodeID)
+}
+
+// client returns the Tailscale API client, created from the given credentials when not injected.
+func (p *TailscaleProvider) client(credentialsName, loginServer string) (*tailscale.Client, error) {
+	if p.Client != nil {
+		return p.Client, nil
+	}
+
+	credentials := &tailscale.Credentials{}
+
+	err := cloudcredentials.Get(cloudcredentials.Key{
+		Name:     credentialsName,
+		Provider: tailscale.CredentialsKind,
+	}, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Tailscale credentials: %w", err)
+	}
 
-	return ip, nil
+	return tailscale.NewClient(loginServer, credentials), nil
 }
@@ -0,0 +1,180 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
+	. "github.com/onsi/gomega"
+)
+
+func TestTailscaleProviderInstallViaCloudInit(t *testing.T) {
+	tests := map[string]struct {
+		provider  *connectivity.TailscaleProvider
+		upCommand string
+		ephemeral bool
+	}{
+		"default options": {
+			provider:  &connectivity.TailscaleProvider{AuthKey: "tskey-abcdef"},
+			upCommand: "tailscale up --auth-key='tskey-abcdef'",
+		},
+		"headscale with tagged ephemeral node": {
+			provider: &connectivity.TailscaleProvider{
+				AuthKey:     "abcdef",
+				LoginServer: "https://headscale.example.com",
+				Hostname:    "ollama",
+				Tags:        []string{"tag:ollama", "tag:gpu"},
+				Ephemeral:   true,
+				SSH:         true,
+			},
+			upCommand: "tailscale up --auth-key='abcdef' --login-server='https://headscale.example.com' --hostname='ollama' --advertise-tags='tag:ollama,tag:gpu' --ssh",
+			ephemeral: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			cloudInitConfig := &cloudinit.Config{}
+			tt.provider.InstallViaCloudInit(cloudInitConfig)
+
+			commands := []string{}
+			for _, cmd := range cloudInitConfig.RunCmd {
+				commands = append(commands, cmd[2])
+			}
+
+			g.Expect(commands).To(ContainElement(tt.upCommand))
+			if tt.ephemeral {
+				g.Expect(commands).To(ContainElement(ContainSubstring(`FLAGS="--state=mem:"`)))
+			} else {
+				g.Expect(commands).NotTo(ContainElement(ContainSubstring("--state=mem:")))
+			}
+		})
+	}
+}
+
+func TestTailscaleProviderTeardown(t *testing.T) {
+	g := NewWithT(t)
+
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	t.Cleanup(server.Close)
+
+	p := &connectivity.TailscaleProvider{
+		LoginServer:     server.URL,
+		CredentialsName: "headscale",
+		Client:          tailscale.NewClient(server.URL, &tailscale.Credentials{APIKey: "secret"}),
+	}
+
+	m := &machine.Machine{}
+	p.ConfigureMachine(m)
+	g.Expect(m.Tailscale).To(Equal(&machine.TailscaleConfig{LoginServer: server.URL, CredentialsName: "headscale"}))
+
+	// Ephemeral nodes can't be started again without API credentials.
+	g.Expect((&connectivity.TailscaleProvider{}).StartMachine(t.Context(), &machine.Machine{Tailscale: &machine.TailscaleConfig{Ephemeral: true}})).
+		To(MatchError(ContainSubstring("can't register again without Tailscale API credentials")))
+
+	// The node ID is only known once the machine has joined the tailnet.
+	g.Expect(p.Teardown(t.Context(), m)).To(Succeed())
+	g.Expect(path).To(BeEmpty())
+
+	m.Tailscale.NodeID = "42"
+	g.Expect(p.Teardown(t.Context(), m)).To(Succeed())
+	g.Expect(path).To(Equal("/api/v1/node/42"))
+}
+
+func TestTailscaleProviderPrepare(t *testing.T) {
+	tests := map[string]struct {
+		provider  *connectivity.TailscaleProvider
+		authKey   string
+		minted    bool
+		ephemeral bool
+		errorMsg  string
+	}{
+		"given auth key": {
+			provider: &connectivity.TailscaleProvider{AuthKey: "tskey-given", CredentialsName: "tailscale"},
+			authKey:  "tskey-given",
+		},
+		"minted auth key": {
+			provider: &connectivity.TailscaleProvider{CredentialsName: "tailscale", Tags: []string{"tag:ollama"}},
+			authKey:  "tskey-auth-minted",
+			minted:   true,
+		},
+		"minted auth key for ephemeral node": {
+			provider:  &connectivity.TailscaleProvider{CredentialsName: "tailscale", Ephemeral: true},
+			authKey:   "tskey-auth-minted",
+			minted:    true,
+			ephemeral: true,
+		},
+		"no auth key nor credentials": {
+			provider: &connectivity.TailscaleProvider{},
+			errorMsg: "auth key or API credentials are required",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			var requests []map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request := map[string]any{}
+				_ = json.NewDecoder(r.Body).Decode(&request)
+				requests = append(requests, request)
+
+				_, _ = w.Write([]byte(`{"key": "tskey-auth-minted"}`))
+			}))
+			t.Cleanup(server.Close)
+
+			client := tailscale.NewClient("", &tailscale.Credentials{APIKey: "secret"})
+			client.BaseURL = server.URL
+			tt.provider.Client = client
+
+			err := tt.provider.Prepare(t.Context(), "test")
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(tt.provider.AuthKey).To(Equal(tt.authKey))
+
+			if !tt.minted {
+				g.Expect(requests).To(BeEmpty())
+
+				return
+			}
+
+			g.Expect(requests).To(HaveLen(1))
+			g.Expect(requests[0]).To(HaveKeyWithValue("capabilities", HaveKeyWithValue("devices", HaveKeyWithValue("create", HaveKeyWithValue("ephemeral", tt.ephemeral)))))
+		})
+	}
+}
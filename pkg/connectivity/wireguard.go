@@ -0,0 +1,289 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/config"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/alexandrevilain/ollama-machine/pkg/wireguard"
+	"github.com/spf13/pflag"
+)
+
+// wireGuardOllamaDropIn is the systemd drop-in making Ollama wait for the link.
+const wireGuardOllamaDropIn = "/etc/systemd/system/ollama.service.d/wireguard.conf"
+
+// WireGuardProvider is a private connectivity provider linking the machine to the local host with WireGuard,
+// without relying on a third-party coordination server.
+// Keys are generated locally, and the local WireGuard configuration is written once the machine IP is known,
+// and updated when the machine starts again.
+type WireGuardProvider struct {
+	// Port is the UDP port WireGuard listens on, on the machine.
+	Port int
+	// Network is the network of the link, allocated from wireguard.DefaultPool when invalid.
+	Network netip.Prefix
+	// ConfigDir is the directory where the local WireGuard configuration is written, config.GetWireGuardDir() when empty.
+	ConfigDir string
+
+	machineName string
+	serverKey   wireguard.Key
+	clientKey   wireguard.Key
+	enabled     bool
+	network     string
+}
+
+// Name returns the name of the provider.
+func (p *WireGuardProvider) Name() string {
+	return "wireguard"
+}
+
+// RegisterFlags registers the flags of the provider.
+func (p *WireGuardProvider) RegisterFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&p.enabled, "wireguard", false, "Link the instance to this host with WireGuard, writing the local WireGuard configuration")
+	flags.IntVar(&p.Port, "wireguard-port", wireguard.DefaultPort, "The UDP port WireGuard listens on, on the instance")
+	flags.StringVar(&p.network, "wireguard-network", "", "The network of the WireGuard link, such as 10.66.0.0/30 (allocated from 10.66.0.0/16 by default)")
+}
+
+// IsConfigured returns whether the --wireguard or --wireguard-network flags are set,
+// or the --wireguard-port flag is set to another port than the default one.
+func (p *WireGuardProvider) IsConfigured() bool {
+	return p.enabled || p.network != "" || (p.Port != 0 && p.Port != wireguard.DefaultPort)
+}
+
+// Validate parses the network of the link, if set.
+func (p *WireGuardProvider) Validate() error {
+	if p.network == "" {
+		return nil
+	}
+
+	network, err := netip.ParsePrefix(p.network)
+	if err != nil {
+		return fmt.Errorf("invalid WireGuard network: %w", err)
+	}
+
+	if network.Bits() > wireguard.NetworkBits {
+		return fmt.Errorf("WireGuard network %s is too small, it must hold at least two addresses", network)
+	}
+
+	p.Network = network.Masked()
+
+	return nil
+}
+
+// Prepare generates the keys of the link and allocates its network, if not set.
+func (p *WireGuardProvider) Prepare(_ context.Context, machineName string) error {
+	var err error
+
+	p.machineName = machineName
+
+	if p.Port == 0 {
+		p.Port = wireguard.DefaultPort
+	}
+
+	if !p.Network.IsValid() {
+		p.Network, err = allocateWireGuardNetwork()
+		if err != nil {
+			return err
+		}
+	}
+
+	p.serverKey, err = wireguard.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	p.clientKey, err = wireguard.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// allocateWireGuardNetwork returns a network which isn't used by the WireGuard links of existing machines.
+func allocateWireGuardNetwork() (netip.Prefix, error) {
+	machines, err := machine.List()
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	used := []netip.Prefix{}
+	for _, m := range machines {
+		if m.WireGuard == nil {
+			continue
+		}
+
+		network, err := netip.ParsePrefix(m.WireGuard.Network)
+		if err == nil {
+			used = append(used, network)
+		}
+	}
+
+	return wireguard.AllocateNetwork(wireguard.DefaultPool, used)
+}
+
+// InstallViaCloudInit installs WireGuard and binds Ollama to the machine address in the link via cloud-init configuration.
+// The link is brought up once its configuration, holding the server key, is installed by InstallSecrets.
+func (p *WireGuardProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
+	// Ollama can only bind to the link address once the interface is up.
+	cloudInit.AddFile(cloudinit.File{
+		Path: wireGuardOllamaDropIn,
+		Content: fmt.Sprintf(`[Unit]
+Wants=wg-quick@%[1]s.service
+After=wg-quick@%[1]s.service`, wireguard.ServerInterface),
+	})
+	cloudInit.AddRunCmd([]string{"sh", "-c", "apt-get update && apt-get install -y wireguard-tools"})
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", wireguard.ServerAddress(p.Network).String())})
+}
+
+// InstallSecrets installs the configuration of the link, brings it up and restarts Ollama to bind to its address.
+func (p *WireGuardProvider) InstallSecrets(config *cloudinit.Config) {
+	config.AddFile(cloudinit.File{
+		Path:        "/etc/wireguard/" + wireguard.ServerInterface + ".conf",
+		Content:     wireguard.ServerConfig(p.Network, p.Port, p.serverKey, p.clientKey.PublicKey()),
+		Permissions: "0600",
+	})
+	config.AddRunCmd([]string{"sh", "-c", "systemctl enable --now wg-quick@" + wireguard.ServerInterface + " && systemctl restart ollama"})
+}
+
+// UninstallCommands brings the link down and removes its configuration, and the Ollama dependency on it.
+func (p *WireGuardProvider) UninstallCommands() []string {
+	return []string{
+		"systemctl disable --now wg-quick@" + wireguard.ServerInterface,
+		"rm -f /etc/wireguard/" + wireguard.ServerInterface + ".conf " + wireGuardOllamaDropIn,
+		"systemctl daemon-reload",
+	}
+}
+
+// ExposedPorts returns the UDP port WireGuard listens on.
+func (p *WireGuardProvider) ExposedPorts() []provider.Port {
+	return []provider.Port{{Protocol: "udp", Number: p.Port}}
+}
+
+// ConfigureMachine stores the link settings on the machine.
+func (p *WireGuardProvider) ConfigureMachine(m *machine.Machine) {
+	m.WireGuard = &machine.WireGuardConfig{
+		Network:          p.Network.String(),
+		Port:             p.Port,
+		ServerPublicKey:  p.serverKey.PublicKey().String(),
+		ClientConfigPath: filepath.Join(p.configDir(), wireguard.ClientInterface(p.machineName)+".conf"),
+	}
+}
+
+// LocalOllamaHost returns the host Ollama listens on, the address of the machine in the WireGuard link.
+func (p *WireGuardProvider) LocalOllamaHost(m *machine.Machine) string {
+	return m.OllamaConfig.Host
+}
+
+// RetrieveOllamaHost retrieves the Ollama host for the given machine, its address in the link.
+// It writes the local WireGuard configuration, reaching the machine on its public IP.
+func (p *WireGuardProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
+	if m.WireGuard == nil {
+		return "", errors.New("machine has no WireGuard link")
+	}
+
+	network, err := netip.ParsePrefix(m.WireGuard.Network)
+	if err != nil {
+		return "", fmt.Errorf("invalid WireGuard network: %w", err)
+	}
+
+	if !p.clientKey.IsZero() {
+		serverPublicKey, err := wireguard.ParseKey(m.WireGuard.ServerPublicKey)
+		if err != nil {
+			return "", err
+		}
+
+		ip, err := netip.ParseAddr(m.IP)
+		if err != nil {
+			return "", fmt.Errorf("invalid machine IP %q: %w", m.IP, err)
+		}
+
+		clientConfig := wireguard.ClientConfig(network, netip.AddrPortFrom(ip, uint16(m.WireGuard.Port)), p.clientKey, serverPublicKey) //nolint:gosec
+
+		err = os.MkdirAll(filepath.Dir(m.WireGuard.ClientConfigPath), 0o700) //nolint:mnd
+		if err != nil {
+			return "", fmt.Errorf("failed to create WireGuard configuration directory: %w", err)
+		}
+
+		err = os.WriteFile(m.WireGuard.ClientConfigPath, []byte(clientConfig), 0o600) //nolint:mnd
+		if err != nil {
+			return "", fmt.Errorf("failed to write WireGuard configuration: %w", err)
+		}
+	}
+
+	return wireguard.ServerAddress(network).String(), nil
+}
+
+// StartMachine updates the endpoint of the local WireGuard configuration, as the machine may get a new public IP
+// when it starts again.
+func (p *WireGuardProvider) StartMachine(_ context.Context, m *machine.Machine) error {
+	if m.WireGuard == nil {
+		return errors.New("machine has no WireGuard link")
+	}
+
+	ip, err := netip.ParseAddr(m.IP)
+	if err != nil {
+		return fmt.Errorf("invalid machine IP %q: %w", m.IP, err)
+	}
+
+	clientConfig, err := os.ReadFile(m.WireGuard.ClientConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read WireGuard configuration: %w", err)
+	}
+
+	endpoint := netip.AddrPortFrom(ip, uint16(m.WireGuard.Port)) //nolint:gosec
+
+	err = os.WriteFile(m.WireGuard.ClientConfigPath, []byte(wireguard.SetClientEndpoint(string(clientConfig), endpoint)), 0o600) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("failed to write WireGuard configuration: %w", err)
+	}
+
+	return nil
+}
+
+// Teardown removes the local WireGuard configuration.
+func (p *WireGuardProvider) Teardown(_ context.Context, m *machine.Machine) error {
+	if m.WireGuard == nil {
+		return nil
+	}
+
+	err := os.Remove(m.WireGuard.ClientConfigPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove WireGuard configuration: %w", err)
+	}
+
+	return nil
+}
+
+func (p *WireGuardProvider) configDir() string {
+	if p.ConfigDir != "" {
+		return p.ConfigDir
+	}
+
+	return config.GetWireGuardDir()
+}
@@ -0,0 +1,128 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity_test
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/provider"
+	"github.com/alexandrevilain/ollama-machine/pkg/wireguard"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+func TestWireGuardProviderLifecycle(t *testing.T) {
+	g := NewWithT(t)
+
+	p := &connectivity.WireGuardProvider{
+		Network:   netip.MustParsePrefix("10.66.0.4/30"),
+		ConfigDir: t.TempDir(),
+	}
+	g.Expect(p.Name()).To(Equal("wireguard"))
+	g.Expect(p.Prepare(t.Context(), "my-machine")).To(Succeed())
+	g.Expect(p.ExposedPorts()).To(Equal([]provider.Port{{Protocol: "udp", Number: 51820}}))
+
+	cloudInitConfig := &cloudinit.Config{}
+	p.InstallViaCloudInit(cloudInitConfig)
+	g.Expect(cloudInitConfig.WriteFiles).To(HaveLen(1))
+	g.Expect(cloudInitConfig.WriteFiles[0].Path).To(Equal("/etc/systemd/system/ollama.service.d/wireguard.conf"))
+	g.Expect(cloudInitConfig.RunCmd).To(HaveLen(2))
+	g.Expect(cloudInitConfig.RunCmd[1]).To(Equal([]string{"sh", "-c", `touch '/home/ollama-machine/env' && sed -i '/^OLLAMA_HOST=/d' '/home/ollama-machine/env' && printf '%s\n' 'OLLAMA_HOST=10.66.0.5' >> '/home/ollama-machine/env'`}))
+
+	secrets := &cloudinit.Config{}
+	p.InstallSecrets(secrets)
+	g.Expect(secrets.WriteFiles).To(HaveLen(1))
+	g.Expect(secrets.WriteFiles[0].Path).To(Equal("/etc/wireguard/wg-ollama.conf"))
+	g.Expect(secrets.WriteFiles[0].Content).To(ContainSubstring("Address = 10.66.0.5/30\nListenPort = 51820\n"))
+	g.Expect(secrets.RunCmd).To(Equal([][]string{{"sh", "-c", "systemctl enable --now wg-quick@wg-ollama && systemctl restart ollama"}}))
+
+	m := &machine.Machine{Machine: &provider.Machine{Name: "my-machine", IP: "1.2.3.4"}, Connectivity: p.Name()}
+	p.ConfigureMachine(m)
+	g.Expect(m.WireGuard.Network).To(Equal("10.66.0.4/30"))
+	g.Expect(m.WireGuard.Port).To(Equal(51820))
+	g.Expect(m.WireGuard.ClientConfigPath).To(Equal(filepath.Join(p.ConfigDir, wireguard.ClientInterface("my-machine")+".conf")))
+
+	host, err := p.RetrieveOllamaHost(m)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(host).To(Equal("10.66.0.5"))
+
+	clientConfig, err := os.ReadFile(m.WireGuard.ClientConfigPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(clientConfig)).To(ContainSubstring("Address = 10.66.0.6/30\n"))
+	g.Expect(string(clientConfig)).To(ContainSubstring("PublicKey = " + m.WireGuard.ServerPublicKey + "\nEndpoint = 1.2.3.4:51820\n"))
+
+	// The machine gets a new public IP when it starts again.
+	m.IP = "5.6.7.8"
+	g.Expect(connectivity.ForMachine(m).(connectivity.MachineStarter).StartMachine(t.Context(), m)).To(Succeed())
+
+	clientConfig, err = os.ReadFile(m.WireGuard.ClientConfigPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(clientConfig)).To(ContainSubstring("PublicKey = " + m.WireGuard.ServerPublicKey + "\nEndpoint = 5.6.7.8:51820\n"))
+
+	g.Expect(connectivity.ForMachine(m).Teardown(t.Context(), m)).To(Succeed())
+	g.Expect(m.WireGuard.ClientConfigPath).NotTo(BeAnExistingFile())
+	g.Expect(connectivity.ForMachine(m).Teardown(t.Context(), m)).To(Succeed())
+}
+
+func TestWireGuardProviderValidate(t *testing.T) {
+	tests := map[string]struct {
+		network  string
+		errorMsg string
+	}{
+		"valid network": {
+			network: "10.66.0.4/30",
+		},
+		"network too small": {
+			network:  "10.66.0.4/31",
+			errorMsg: "is too small",
+		},
+		"invalid network": {
+			network:  "10.66.0.4",
+			errorMsg: "invalid WireGuard network",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			p := &connectivity.WireGuardProvider{}
+
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			p.RegisterFlags(fs)
+			g.Expect(fs.Parse([]string{"--wireguard-network", tt.network})).To(Succeed())
+
+			err := p.Validate()
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(p.Network.String()).To(Equal(tt.network))
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/spf13/pflag"
+)
+
+// ZeroTierCentralURL is the URL of the ZeroTier Central API.
+const ZeroTierCentralURL = "https://api.zerotier.com/api/v1"
+
+const zeroTierCentralTimeout = 30 * time.Second
+
+var zeroTierNetworkIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// ErrNoZeroTierAddress is returned when the machine has no address in the ZeroTier network yet,
+// usually because its membership hasn't been authorized.
+var ErrNoZeroTierAddress = errors.New("no address assigned in the ZeroTier network, the member may not be authorized yet")
+
+// ZeroTierProvider is a private connectivity provider that exposes ollama through a ZeroTier network.
+// Ollama listens on localhost until the machine gets its address in the network.
+type ZeroTierProvider struct {
+	// NetworkID is the ID of the ZeroTier network to join.
+	NetworkID string
+	// APIToken is the ZeroTier Central API token used to authorize the machine in the network.
+	// When empty, the machine has to be authorized manually.
+	APIToken string
+	// CentralURL is the URL of the ZeroTier Central API, ZeroTierCentralURL when empty.
+	CentralURL string
+}
+
+// ValidateZeroTierNetworkID returns an error if the given network ID isn't a valid ZeroTier network ID.
+func ValidateZeroTierNetworkID(networkID string) error {
+	if !zeroTierNetworkIDPattern.MatchString(networkID) {
+		return fmt.Errorf("invalid ZeroTier network ID %q, expected 16 lowercase hexadecimal characters", networkID)
+	}
+
+	return nil
+}
+
+// Name returns the name of the provider.
+func (p *ZeroTierProvider) Name() string {
+	return "zerotier"
+}
+
+// RegisterFlags registers the flags of the provider.
+func (p *ZeroTierProvider) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&p.NetworkID, "zerotier-network-id", "", "The ID of the ZeroTier network the instance joins to expose Ollama")
+	fs.StringVar(&p.APIToken, "zerotier-api-token", "", "The ZeroTier Central API token used to authorize the instance in the network (the instance must be authorized manually otherwise)")
+}
+
+// IsConfigured returns whether any of the ZeroTier flags is set.
+func (p *ZeroTierProvider) IsConfigured() bool {
+	return p.NetworkID != "" || p.APIToken != ""
+}
+
+// Validate checks the network ID is valid.
+func (p *ZeroTierProvider) Validate() error {
+	return ValidateZeroTierNetworkID(p.NetworkID)
+}
+
+// InstallViaCloudInit installs ZeroTier and joins the network via cloud-init configuration.
+func (p *ZeroTierProvider) InstallViaCloudInit(cloudInit *cloudinit.Config) {
+	cloudInit.AddRunCmd([]string{"sh", "-c", "curl -fsSL https://install.zerotier.com | bash"})
+	cloudInit.AddRunCmd([]string{"sh", "-c", "zerotier-cli join " + p.NetworkID})
+	cloudInit.AddRunCmd([]string{"sh", "-c", envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", "localhost")})
+}
+
+// UninstallCommands removes ZeroTier, leaving its networks.
+func (p *ZeroTierProvider) UninstallCommands() []string {
+	return []string{"apt-get remove -y zerotier-one"}
+}
+
+// LocalOllamaHost returns the host Ollama listens on, the address of the machine in the ZeroTier network.
+func (p *ZeroTierProvider) LocalOllamaHost(m *machine.Machine) string {
+	return m.OllamaConfig.Host
+}
+
+// RetrieveOllamaHost retrieves the Ollama host for the given machine.
+// Under-the-hood it connects to the machine using SSH, authorizes it in the network when an API token is set,
+// and waits for its ZeroTier address. Ollama is then bound to this address.
+func (p *ZeroTierProvider) RetrieveOllamaHost(m *machine.Machine) (string, error) {
+	client, err := m.SSHDial()
+	if err != nil {
+		return "", fmt.Errorf("failed to create ssh client: %w", err)
+	}
+
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if p.APIToken != "" {
+		info, err := ssh.Run(client, "sudo zerotier-cli info")
+		if err != nil {
+			return "", fmt.Errorf("failed to get ZeroTier node info: %w", err)
+		}
+
+		memberID, err := ParseZeroTierNodeID(string(info))
+		if err != nil {
+			return "", err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), zeroTierCentralTimeout)
+		defer cancel()
+
+		err = p.AuthorizeMember(ctx, memberID, m.Name)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	networks, err := ssh.Run(client, "sudo zerotier-cli -j listnetworks")
+	if err != nil {
+		return "", fmt.Errorf("failed to list ZeroTier networks: %w", err)
+	}
+
+	ip, err := ParseZeroTierAddress(networks, p.NetworkID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = ssh.Run(client, "sudo sh -c "+ssh.Quote(envfile.SetCommand(machine.OllamaEnvFilePath, "OLLAMA_HOST", ip)+" && systemctl restart ollama"))
+	if err != nil {
+		return "", fmt.Errorf("failed to bind Ollama to the ZeroTier address: %w", err)
+	}
+
+	return ip, nil
+}
+
+// AuthorizeMember authorizes the given member in the network using the ZeroTier Central API, and names it.
+func (p *ZeroTierProvider) AuthorizeMember(ctx context.Context, memberID, name string) error {
+	centralURL := p.CentralURL
+	if centralURL == "" {
+		centralURL = ZeroTierCentralURL
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"name": name,
+		"config": map[string]any{
+			"authorized": true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal ZeroTier member: %w", err)
+	}
+
+	endpoint := centralURL + "/network/" + url.PathEscape(p.NetworkID) + "/member/" + url.PathEscape(memberID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create ZeroTier Central request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "token "+p.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to authorize ZeroTier member: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) //nolint:mnd
+
+		return fmt.Errorf("failed to authorize ZeroTier member: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// ParseZeroTierNodeID returns the node ID from the output of `zerotier-cli info`, such as "200 info 1a2b3c4d5e 1.14.2 ONLINE".
+func ParseZeroTierNodeID(output string) (string, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != "200" || fields[1] != "info" { //nolint:mnd
+		return "", fmt.Errorf("unexpected ZeroTier node info %q", strings.TrimSpace(output))
+	}
+
+	return fields[2], nil
+}
+
+// ParseZeroTierAddress returns the IPv4 address assigned to the machine in the given network,
+// from the output of `zerotier-cli -j listnetworks`.
+func ParseZeroTierAddress(output []byte, networkID string) (string, error) {
+	var networks []struct {
+		ID                string   `json:"id"`
+		AssignedAddresses []string `json:"assignedAddresses"`
+	}
+
+	err := json.Unmarshal(output, &networks)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse ZeroTier networks: %w", err)
+	}
+
+	for _, network := range networks {
+		if network.ID != networkID {
+			continue
+		}
+
+		for _, address := range network.AssignedAddresses {
+			ip, _, err := net.ParseCIDR(address)
+			if err == nil && ip.To4() != nil {
+				return ip.String(), nil
+			}
+		}
+
+		return "", ErrNoZeroTierAddress
+	}
+
+	return "", fmt.Errorf("machine hasn't joined the ZeroTier network %s", networkID)
+}
+
+// Teardown does nothing, the provider doesn't create resources outside of the machine.
+func (p *ZeroTierProvider) Teardown(_ context.Context, _ *machine.Machine) error {
+	return nil
+}
@@ -0,0 +1,180 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package connectivity_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/connectivity"
+	. "github.com/onsi/gomega"
+)
+
+func TestZeroTierProviderInstallViaCloudInit(t *testing.T) {
+	g := NewWithT(t)
+	provider := &connectivity.ZeroTierProvider{NetworkID: "8056c2e21c000001"}
+	cloudInitConfig := &cloudinit.Config{}
+
+	g.Expect(provider.Name()).To(Equal("zerotier"))
+
+	provider.InstallViaCloudInit(cloudInitConfig)
+	g.Expect(cloudInitConfig.RunCmd).To(Equal([][]string{
+		{"sh", "-c", "curl -fsSL https://install.zerotier.com | bash"},
+		{"sh", "-c", "zerotier-cli join 8056c2e21c000001"},
+		{"sh", "-c", `touch '/home/ollama-machine/env' && sed -i '/^OLLAMA_HOST=/d' '/home/ollama-machine/env' && printf '%s\n' 'OLLAMA_HOST=localhost' >> '/home/ollama-machine/env'`},
+	}))
+}
+
+func TestValidateZeroTierNetworkID(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(connectivity.ValidateZeroTierNetworkID("8056c2e21c000001")).To(Succeed())
+	g.Expect(connectivity.ValidateZeroTierNetworkID("8056c2e21c")).NotTo(Succeed())
+	g.Expect(connectivity.ValidateZeroTierNetworkID("8056C2E21C000001")).NotTo(Succeed())
+}
+
+func TestParseZeroTierNodeID(t *testing.T) {
+	tests := map[string]struct {
+		output   string
+		result   string
+		errorMsg string
+	}{
+		"online node": {
+			output: "200 info 1a2b3c4d5e 1.14.2 ONLINE\n",
+			result: "1a2b3c4d5e",
+		},
+		"unexpected output": {
+			output:   "zerotier-cli: missing authentication token\n",
+			errorMsg: "unexpected ZeroTier node info",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, err := connectivity.ParseZeroTierNodeID(tt.output)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestParseZeroTierAddress(t *testing.T) {
+	tests := map[string]struct {
+		output   string
+		result   string
+		errorMsg string
+	}{
+		"assigned address": {
+			output: `[{"id": "8056c2e21c000001", "assignedAddresses": ["fd80:56c2:e21c::1/88", "10.147.17.5/24"]}]`,
+			result: "10.147.17.5",
+		},
+		"not authorized yet": {
+			output:   `[{"id": "8056c2e21c000001", "assignedAddresses": []}]`,
+			errorMsg: "no address assigned",
+		},
+		"network not joined": {
+			output:   `[{"id": "8056c2e21c000002", "assignedAddresses": ["10.147.17.5/24"]}]`,
+			errorMsg: "hasn't joined",
+		},
+		"invalid output": {
+			output:   `not json`,
+			errorMsg: "failed to parse ZeroTier networks",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, err := connectivity.ParseZeroTierAddress([]byte(tt.output), "8056c2e21c000001")
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestZeroTierProviderAuthorizeMember(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		errorMsg   string
+	}{
+		"authorized": {
+			statusCode: http.StatusOK,
+		},
+		"forbidden": {
+			statusCode: http.StatusForbidden,
+			errorMsg:   "unexpected status 403 Forbidden",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			var body map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				g.Expect(r.Method).To(Equal(http.MethodPost))
+				g.Expect(r.URL.Path).To(Equal("/network/8056c2e21c000001/member/1a2b3c4d5e"))
+				g.Expect(r.Header.Get("Authorization")).To(Equal("token secret"))
+				g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+
+				w.WriteHeader(tt.statusCode)
+			}))
+			t.Cleanup(server.Close)
+
+			provider := &connectivity.ZeroTierProvider{
+				NetworkID:  "8056c2e21c000001",
+				APIToken:   "secret",
+				CentralURL: server.URL,
+			}
+
+			err := provider.AuthorizeMember(t.Context(), "1a2b3c4d5e", "my-machine")
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(body).To(Equal(map[string]any{
+				"name":   "my-machine",
+				"config": map[string]any{"authorized": true},
+			}))
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package envfile reads and edits environment files, such as the ones used by systemd EnvironmentFile directives.
+package envfile
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+)
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ErrInvalidKey is returned when a variable name isn't a valid environment variable name.
+var ErrInvalidKey = errors.New("invalid environment variable name")
+
+// Variable is an environment variable.
+type Variable struct {
+	Key   string
+	Value string
+}
+
+// ValidateKey returns an error if the given key isn't a valid environment variable name.
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	return nil
+}
+
+// ParseAssignment parses a KEY=VALUE assignment.
+func ParseAssignment(assignment string) (Variable, error) {
+	key, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return Variable{}, fmt.Errorf("invalid assignment %q, expected KEY=VALUE", assignment)
+	}
+
+	err := ValidateKey(key)
+	if err != nil {
+		return Variable{}, err
+	}
+
+	return Variable{Key: key, Value: value}, nil
+}
+
+// Parse returns the variables defined in the given environment file content, in order.
+// Empty lines and comments are ignored.
+func Parse(content string) []Variable {
+	result := []Variable{}
+
+	for line := range strings.Lines(content) {
+		key, value, ok := parseLine(line)
+		if ok {
+			result = append(result, Variable{Key: key, Value: value})
+		}
+	}
+
+	return result
+}
+
+// Get returns the value of the given variable in the environment file content.
+// When the variable is defined several times, the last definition wins.
+func Get(content, key string) (string, bool) {
+	value, found := "", false
+
+	for _, variable := range Parse(content) {
+		if variable.Key == key {
+			value, found = variable.Value, true
+		}
+	}
+
+	return value, found
+}
+
+// Set sets the given variable in the environment file content, replacing its existing definitions.
+// Other lines are kept as is.
+func Set(content, key, value string) string {
+	return Unset(content, key) + Format(key, value) + "\n"
+}
+
+// Unset removes all definitions of the given variable from the environment file content.
+func Unset(content, key string) string {
+	builder := &strings.Builder{}
+
+	for line := range strings.Lines(content) {
+		lineKey, _, ok := parseLine(line)
+		if ok && lineKey == key {
+			continue
+		}
+
+		builder.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String()
+}
+
+// Format returns the line defining the given variable, quoting its value when needed.
+func Format(key, value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"'\\#$`") {
+		value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+
+	return key + "=" + value
+}
+
+// SetCommand returns a shell command setting the given variable in the environment file at path,
+// replacing its existing definitions and keeping other variables.
+func SetCommand(path, key, value string) string {
+	return fmt.Sprintf(`%s && printf '%%s\n' %s >> %s`, unsetCommand(path, key), ssh.Quote(Format(key, value)), ssh.Quote(path))
+}
+
+// SetExprCommand is like SetCommand, but value is a shell expression expanded when the command runs,
+// such as "$(tailscale ip -4)".
+func SetExprCommand(path, key, expr string) string {
+	return fmt.Sprintf(`%s && echo "%s=%s" >> %s`, unsetCommand(path, key), key, expr, ssh.Quote(path))
+}
+
+func unsetCommand(path, key string) string {
+	return fmt.Sprintf("touch %[1]s && sed -i '/^%[2]s=/d' %[1]s", ssh.Quote(path), key)
+}
+
+func parseLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+		return "", "", false
+	}
+
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(key), unquote(strings.TrimSpace(value)), true
+}
+
+func unquote(value string) string {
+	const minQuotedLength = 2
+
+	if len(value) < minQuotedLength {
+		return value
+	}
+
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value[1 : len(value)-1])
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return value[1 : len(value)-1]
+	default:
+		return value
+	}
+}
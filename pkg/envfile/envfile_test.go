@@ -0,0 +1,153 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package envfile_test
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/envfile"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseAssignment(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		result   envfile.Variable
+		errorMsg string
+	}{
+		"simple": {
+			input:  "OLLAMA_KEEP_ALIVE=1h",
+			result: envfile.Variable{Key: "OLLAMA_KEEP_ALIVE", Value: "1h"},
+		},
+		"value containing equal sign": {
+			input:  "OLLAMA_ORIGINS=https://app.example.com?a=b",
+			result: envfile.Variable{Key: "OLLAMA_ORIGINS", Value: "https://app.example.com?a=b"},
+		},
+		"empty value": {
+			input:  "OLLAMA_DEBUG=",
+			result: envfile.Variable{Key: "OLLAMA_DEBUG", Value: ""},
+		},
+		"missing value": {
+			input:    "OLLAMA_DEBUG",
+			errorMsg: "expected KEY=VALUE",
+		},
+		"invalid key": {
+			input:    "OLLAMA DEBUG=1",
+			errorMsg: "invalid environment variable name",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, err := envfile.ParseAssignment(tt.input)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	g := NewWithT(t)
+
+	content := `# Managed by ollama-machine
+OLLAMA_HOST=localhost
+
+OLLAMA_ORIGINS="https://a.example.com https://b.example.com"
+OLLAMA_KEEP_ALIVE='1h'
+OLLAMA_ESCAPED="say \"hi\""`
+
+	g.Expect(envfile.Parse(content)).To(Equal([]envfile.Variable{
+		{Key: "OLLAMA_HOST", Value: "localhost"},
+		{Key: "OLLAMA_ORIGINS", Value: "https://a.example.com https://b.example.com"},
+		{Key: "OLLAMA_KEEP_ALIVE", Value: "1h"},
+		{Key: "OLLAMA_ESCAPED", Value: `say "hi"`},
+	}))
+}
+
+func TestSetAndUnset(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		edit    func(content string) string
+		result  string
+	}{
+		"set new variable": {
+			content: "OLLAMA_HOST=localhost\n",
+			edit: func(content string) string {
+				return envfile.Set(content, "OLLAMA_KEEP_ALIVE", "1h")
+			},
+			result: "OLLAMA_HOST=localhost\nOLLAMA_KEEP_ALIVE=1h\n",
+		},
+		"replace existing variable": {
+			content: "OLLAMA_KEEP_ALIVE=5m\nOLLAMA_HOST=localhost",
+			edit: func(content string) string {
+				return envfile.Set(content, "OLLAMA_KEEP_ALIVE", "1h")
+			},
+			result: "OLLAMA_HOST=localhost\nOLLAMA_KEEP_ALIVE=1h\n",
+		},
+		"set value needing quotes": {
+			content: "",
+			edit: func(content string) string {
+				return envfile.Set(content, "OLLAMA_ORIGINS", "https://a.example.com https://b.example.com")
+			},
+			result: "OLLAMA_ORIGINS=\"https://a.example.com https://b.example.com\"\n",
+		},
+		"unset variable": {
+			content: "# comment\nOLLAMA_HOST=localhost\nOLLAMA_KEEP_ALIVE=1h\n",
+			edit: func(content string) string {
+				return envfile.Unset(content, "OLLAMA_KEEP_ALIVE")
+			},
+			result: "# comment\nOLLAMA_HOST=localhost\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result := tt.edit(tt.content)
+			g.Expect(result).To(Equal(tt.result))
+
+			for _, variable := range envfile.Parse(result) {
+				value, ok := envfile.Get(result, variable.Key)
+				g.Expect(ok).To(BeTrue())
+				g.Expect(value).To(Equal(variable.Value))
+			}
+		})
+	}
+}
+
+func TestSetCommand(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(envfile.SetCommand("/home/ollama-machine/env", "OLLAMA_ORIGINS", "it's")).To(Equal(
+		`touch '/home/ollama-machine/env' && sed -i '/^OLLAMA_ORIGINS=/d' '/home/ollama-machine/env' && printf '%s\n' 'OLLAMA_ORIGINS="it'"'"'s"' >> '/home/ollama-machine/env'`,
+	))
+	g.Expect(envfile.SetExprCommand("/home/ollama-machine/env", "OLLAMA_HOST", "$(tailscale ip -4)")).To(Equal(
+		`touch '/home/ollama-machine/env' && sed -i '/^OLLAMA_HOST=/d' '/home/ollama-machine/env' && echo "OLLAMA_HOST=$(tailscale ip -4)" >> '/home/ollama-machine/env'`,
+	))
+}
@@ -0,0 +1,167 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package gpu installs and checks GPU drivers on machines.
+package gpu
+
+import (
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+)
+
+// Distro is a Linux distribution supported by the GPU bootstrap stage.
+type Distro string
+
+const (
+	// DistroDebian is the Debian distribution.
+	DistroDebian Distro = "debian"
+	// DistroUbuntu is the Ubuntu distribution.
+	DistroUbuntu Distro = "ubuntu"
+	// DistroUnknown is used when the distribution can't be known in advance, it's then detected at boot.
+	DistroUnknown Distro = ""
+)
+
+const (
+	// RebootMarkerPath is the path of the file created when the machine must reboot to load the installed drivers.
+	RebootMarkerPath = "/run/ollama-machine/reboot-required"
+
+	bootstrapScriptPath = "/usr/local/bin/ollama-machine-gpu-bootstrap"
+)
+
+// DetectDistro returns the distribution of the given image name, or DistroUnknown if it can't be guessed.
+func DetectDistro(image string) Distro {
+	image = strings.ToLower(image)
+
+	switch {
+	case strings.Contains(image, "ubuntu"):
+		return DistroUbuntu
+	case strings.Contains(image, "debian"):
+		return DistroDebian
+	default:
+		return DistroUnknown
+	}
+}
+
+const scriptHeader = `#!/bin/sh
+# Managed by ollama-machine: installs NVIDIA drivers when an NVIDIA GPU is detected.
+set -eu
+
+export DEBIAN_FRONTEND=noninteractive
+`
+
+const debianDriver = `
+install_driver_debian() {
+	# NVIDIA drivers are in the contrib and non-free components.
+	if [ -f /etc/apt/sources.list.d/debian.sources ]; then
+		sed -i 's/^Components: .*/Components: main contrib non-free non-free-firmware/' /etc/apt/sources.list.d/debian.sources
+	fi
+	if [ -f /etc/apt/sources.list ]; then
+		sed -i -E 's/^(deb(-src)? .* main)$/\1 contrib non-free non-free-firmware/' /etc/apt/sources.list
+	fi
+	apt-get update
+	apt-get install -y "linux-headers-$(uname -r)" nvidia-driver nvidia-smi firmware-misc-nonfree
+}
+`
+
+const ubuntuDriver = `
+install_driver_ubuntu() {
+	apt-get update
+	apt-get install -y ubuntu-drivers-common
+	ubuntu-drivers install
+}
+`
+
+const detectDriver = `
+install_driver() {
+	. /etc/os-release
+	case "$ID" in
+		debian) install_driver_debian ;;
+		ubuntu) install_driver_ubuntu ;;
+		*) echo "Unsupported distribution $ID, NVIDIA drivers must be installed manually" >&2 ;;
+	esac
+}
+`
+
+const containerToolkit = `
+install_container_toolkit() {
+	apt-get install -y gnupg
+	curl -fsSL https://nvidia.github.io/libnvidia-container/gpgkey | gpg --batch --yes --dearmor -o /usr/share/keyrings/nvidia-container-toolkit-keyring.gpg
+	curl -fsSL https://nvidia.github.io/libnvidia-container/stable/deb/nvidia-container-toolkit.list \
+		| sed 's#deb https://#deb [signed-by=/usr/share/keyrings/nvidia-container-toolkit-keyring.gpg] https://#g' \
+		> /etc/apt/sources.list.d/nvidia-container-toolkit.list
+	apt-get update
+	apt-get install -y nvidia-container-toolkit
+	nvidia-ctk runtime configure --runtime=docker
+	systemctl restart docker
+}
+`
+
+const scriptMain = `
+if ! grep -qs 0x10de /sys/bus/pci/devices/*/vendor; then
+	echo "No NVIDIA GPU detected, skipping driver installation"
+	exit 0
+fi
+
+if nvidia-smi > /dev/null 2>&1; then
+	echo "NVIDIA driver already installed"
+else
+	install_driver
+	# The driver can't be loaded while nouveau is, the machine is rebooted once cloud-init is done.
+	if ! nvidia-smi > /dev/null 2>&1; then
+		mkdir -p "$(dirname ` + RebootMarkerPath + `)"
+		touch ` + RebootMarkerPath + `
+	fi
+fi
+
+# Docker images need the container toolkit to expose the GPU to containers.
+if command -v docker > /dev/null 2>&1; then
+	install_container_toolkit
+fi
+`
+
+// BootstrapScript returns the script installing NVIDIA drivers on the given distribution.
+func BootstrapScript(distro Distro) string {
+	var driver string
+
+	switch distro {
+	case DistroDebian:
+		driver = debianDriver + "\ninstall_driver() {\n\tinstall_driver_debian\n}\n"
+	case DistroUbuntu:
+		driver = ubuntuDriver + "\ninstall_driver() {\n\tinstall_driver_ubuntu\n}\n"
+	default:
+		driver = debianDriver + ubuntuDriver + detectDriver
+	}
+
+	return scriptHeader + driver + containerToolkit + scriptMain
+}
+
+// InstallViaCloudInit adds the GPU bootstrap stage to the cloud-init configuration.
+// It must run before Ollama is installed, so the Ollama install script finds working drivers.
+func InstallViaCloudInit(cloudInit *cloudinit.Config, distro Distro) {
+	cloudInit.AddFile(cloudinit.File{
+		Path:        bootstrapScriptPath,
+		Content:     BootstrapScript(distro),
+		Permissions: "0755",
+	})
+	cloudInit.AddRunCmd([]string{bootstrapScriptPath})
+	cloudInit.SetPowerState(cloudinit.PowerState{
+		Mode:      "reboot",
+		Message:   "Rebooting to load NVIDIA drivers",
+		Condition: "test -f " + RebootMarkerPath,
+	})
+}
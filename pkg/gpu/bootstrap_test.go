@@ -0,0 +1,101 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gpu_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/gpu"
+	. "github.com/onsi/gomega"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestInstallViaCloudInit(t *testing.T) {
+	tests := map[string]struct {
+		image  string
+		golden string
+	}{
+		"debian": {
+			image:  "Debian 12",
+			golden: "debian.golden.yaml",
+		},
+		"ubuntu": {
+			image:  "Ubuntu 24.04",
+			golden: "ubuntu.golden.yaml",
+		},
+		"unknown distribution": {
+			image:  "ami-0123456789abcdef0",
+			golden: "unknown.golden.yaml",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			cloudInitConfig := cloudinit.NewConfig()
+			gpu.InstallViaCloudInit(cloudInitConfig, gpu.DetectDistro(tt.image))
+
+			rendered, err := cloudInitConfig.Render()
+			g.Expect(err).NotTo(HaveOccurred())
+
+			goldenPath := filepath.Join("testdata", tt.golden)
+			if *update {
+				g.Expect(os.WriteFile(goldenPath, rendered, 0o600)).To(Succeed())
+			}
+
+			golden, err := os.ReadFile(goldenPath)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(rendered)).To(Equal(string(golden)))
+		})
+	}
+}
+
+func TestDetectDistro(t *testing.T) {
+	tests := map[string]struct {
+		image  string
+		distro gpu.Distro
+	}{
+		"openstack debian image": {
+			image:  "Debian 12 - Docker",
+			distro: gpu.DistroDebian,
+		},
+		"aws ubuntu image name": {
+			image:  "ubuntu/images/hvm-ssd-gp3/ubuntu-noble-24.04-amd64-server-20250115",
+			distro: gpu.DistroUbuntu,
+		},
+		"ami id": {
+			image:  "ami-0123456789abcdef0",
+			distro: gpu.DistroUnknown,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(gpu.DetectDistro(tt.image)).To(Equal(tt.distro))
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gpu
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// QueryCommand is the nvidia-smi command listing the GPUs of the machine.
+// Its output is parsed by ParseQuery.
+const QueryCommand = "nvidia-smi --query-gpu=index,name,memory.total,memory.used,utilization.gpu,driver_version --format=csv,noheader,nounits"
+
+const queryFields = 6
+
+// Device is a GPU reported by nvidia-smi.
+type Device struct {
+	Index int
+	Name  string
+	// MemoryTotal is the total memory of the GPU, in MiB.
+	MemoryTotal int64
+	// MemoryUsed is the memory currently used on the GPU, in MiB.
+	MemoryUsed int64
+	// Utilization is the percentage of time the GPU was busy over the last sample period.
+	Utilization   int
+	DriverVersion string
+}
+
+// Query lists the GPUs of the machine the client is connected to, using nvidia-smi.
+func Query(client *gossh.Client) ([]Device, error) {
+	output, err := ssh.Run(client, QueryCommand)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gpus: %w", err)
+	}
+
+	return ParseQuery(string(output))
+}
+
+// ParseQuery parses the output of QueryCommand.
+// Values nvidia-smi can't report, such as "[N/A]", are parsed as zero.
+func ParseQuery(output string) ([]Device, error) {
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = queryFields
+
+	devices := []Device{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return devices, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse nvidia-smi output: %w", err)
+		}
+
+		device, err := parseDevice(record)
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+}
+
+func parseDevice(record []string) (Device, error) {
+	index, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil {
+		return Device{}, fmt.Errorf("invalid gpu index %q: %w", record[0], err)
+	}
+
+	memoryTotal, err := parseNumber(record[2])
+	if err != nil {
+		return Device{}, fmt.Errorf("invalid total memory of gpu %d: %w", index, err)
+	}
+
+	memoryUsed, err := parseNumber(record[3])
+	if err != nil {
+		return Device{}, fmt.Errorf("invalid used memory of gpu %d: %w", index, err)
+	}
+
+	utilization, err := parseNumber(record[4])
+	if err != nil {
+		return Device{}, fmt.Errorf("invalid utilization of gpu %d: %w", index, err)
+	}
+
+	return Device{
+		Index:         index,
+		Name:          strings.TrimSpace(record[1]),
+		MemoryTotal:   memoryTotal,
+		MemoryUsed:    memoryUsed,
+		Utilization:   int(utilization),
+		DriverVersion: strings.TrimSpace(record[5]),
+	}, nil
+}
+
+func parseNumber(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Summarize returns the summary of the given devices stored on the machine.
+// It returns nil when there is no device.
+func Summarize(devices []Device) *machine.GPU {
+	if len(devices) == 0 {
+		return nil
+	}
+
+	summary := &machine.GPU{
+		Model:         devices[0].Name,
+		Count:         len(devices),
+		DriverVersion: devices[0].DriverVersion,
+	}
+
+	for _, device := range devices {
+		summary.Memory += device.MemoryTotal
+		if device.Name != summary.Model {
+			summary.Model = "mixed"
+		}
+	}
+
+	return summary
+}
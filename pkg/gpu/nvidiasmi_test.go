@@ -0,0 +1,117 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gpu_test
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/gpu"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := map[string]struct {
+		output   string
+		devices  []gpu.Device
+		errorMsg string
+	}{
+		"single gpu": {
+			output: "0, NVIDIA L4, 23034, 18227, 97, 550.54.15\n",
+			devices: []gpu.Device{
+				{Index: 0, Name: "NVIDIA L4", MemoryTotal: 23034, MemoryUsed: 18227, Utilization: 97, DriverVersion: "550.54.15"},
+			},
+		},
+		"multiple gpus": {
+			output: "0, Tesla V100S-PCIE-32GB, 32768, 0, 0, 535.183.01\n1, Tesla V100S-PCIE-32GB, 32768, 512, 12, 535.183.01\n",
+			devices: []gpu.Device{
+				{Index: 0, Name: "Tesla V100S-PCIE-32GB", MemoryTotal: 32768, DriverVersion: "535.183.01"},
+				{Index: 1, Name: "Tesla V100S-PCIE-32GB", MemoryTotal: 32768, MemoryUsed: 512, Utilization: 12, DriverVersion: "535.183.01"},
+			},
+		},
+		"not available values": {
+			output: "0, NVIDIA A100-SXM4-40GB MIG 1g.5gb, 40960, 0, [N/A], 550.54.15\n",
+			devices: []gpu.Device{
+				{Index: 0, Name: "NVIDIA A100-SXM4-40GB MIG 1g.5gb", MemoryTotal: 40960, DriverVersion: "550.54.15"},
+			},
+		},
+		"no gpu": {
+			output:  "",
+			devices: []gpu.Device{},
+		},
+		"missing fields": {
+			output:   "0, NVIDIA L4, 23034\n",
+			errorMsg: "wrong number of fields",
+		},
+		"invalid memory": {
+			output:   "0, NVIDIA L4, lots, 0, 0, 550.54.15\n",
+			errorMsg: "invalid total memory of gpu 0",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			devices, err := gpu.ParseQuery(tt.output)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(devices).To(Equal(tt.devices))
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := map[string]struct {
+		devices []gpu.Device
+		result  *machine.GPU
+	}{
+		"no gpu": {
+			devices: []gpu.Device{},
+			result:  nil,
+		},
+		"same model": {
+			devices: []gpu.Device{
+				{Index: 0, Name: "NVIDIA L4", MemoryTotal: 23034, DriverVersion: "550.54.15"},
+				{Index: 1, Name: "NVIDIA L4", MemoryTotal: 23034, DriverVersion: "550.54.15"},
+			},
+			result: &machine.GPU{Model: "NVIDIA L4", Count: 2, Memory: 46068, DriverVersion: "550.54.15"},
+		},
+		"mixed models": {
+			devices: []gpu.Device{
+				{Index: 0, Name: "NVIDIA L4", MemoryTotal: 23034, DriverVersion: "550.54.15"},
+				{Index: 1, Name: "NVIDIA L40S", MemoryTotal: 46068, DriverVersion: "550.54.15"},
+			},
+			result: &machine.GPU{Model: "mixed", Count: 2, Memory: 69102, DriverVersion: "550.54.15"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(gpu.Summarize(tt.devices)).To(Equal(tt.result))
+		})
+	}
+}
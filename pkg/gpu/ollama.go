@@ -0,0 +1,50 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gpu
+
+import (
+	"regexp"
+	"strings"
+)
+
+// OllamaLogsCommand is the command returning the logs Ollama wrote since the machine booted.
+const OllamaLogsCommand = "sudo journalctl -u ollama -b --no-pager -o cat"
+
+var inferenceComputeLibrary = regexp.MustCompile(`msg="inference compute".*\blibrary="?([^\s"]+)`)
+
+// OllamaComputeLibraries returns the compute libraries reported by Ollama in its logs when it starts,
+// such as cuda, rocm or cpu.
+func OllamaComputeLibraries(logs string) []string {
+	result := []string{}
+	for _, match := range inferenceComputeLibrary.FindAllStringSubmatch(logs, -1) {
+		result = append(result, strings.ToLower(match[1]))
+	}
+
+	return result
+}
+
+// UsesGPU returns true if one of the given compute libraries runs on a GPU.
+func UsesGPU(libraries []string) bool {
+	for _, library := range libraries {
+		if library != "cpu" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gpu_test
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/gpu"
+	. "github.com/onsi/gomega"
+)
+
+func TestOllamaComputeLibraries(t *testing.T) {
+	tests := map[string]struct {
+		logs      string
+		libraries []string
+		usesGPU   bool
+	}{
+		"cuda": {
+			logs: `time=2025-01-26T20:22:17.000Z level=INFO source=routes.go:1238 msg="Listening on 127.0.0.1:11434 (version 0.5.7)"
+time=2025-01-26T20:22:18.000Z level=INFO source=types.go:131 msg="inference compute" id=GPU-452cac9f library=cuda variant=v12 compute=7.0 driver=12.4 name="Tesla V100S-PCIE-32GB" total="31.7 GiB" available="31.4 GiB"`,
+			libraries: []string{"cuda"},
+			usesGPU:   true,
+		},
+		"cpu only": {
+			logs:      `time=2025-01-26T20:22:18.000Z level=INFO source=types.go:131 msg="inference compute" id=0 library=cpu variant=avx2 compute="" driver=0.0 name="" total="7.7 GiB" available="7.1 GiB"`,
+			libraries: []string{"cpu"},
+			usesGPU:   false,
+		},
+		"newer quoted format": {
+			logs:      `time=2025-09-26T20:22:18.000Z level=INFO source=types.go:42 msg="inference compute" id=GPU-452cac9f library="CUDA" compute=8.9 name=CUDA0 description="NVIDIA L4"`,
+			libraries: []string{"cuda"},
+			usesGPU:   true,
+		},
+		"not started yet": {
+			logs:      `Started ollama.service - Ollama Service.`,
+			libraries: []string{},
+			usesGPU:   false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			libraries := gpu.OllamaComputeLibraries(tt.logs)
+			g.Expect(libraries).To(Equal(tt.libraries))
+			g.Expect(gpu.UsesGPU(libraries)).To(Equal(tt.usesGPU))
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package idle installs a watchdog shutting machines down when Ollama is idle.
+package idle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+)
+
+const (
+	// MinTimeout is the minimum idle timeout, the watchdog checks Ollama activity every minute.
+	MinTimeout = 5 * time.Minute
+
+	envFilePath      = "/etc/ollama-machine/idle.env"
+	activityFilePath = "/run/ollama-machine/last-activity"
+	scriptPath       = "/usr/local/bin/ollama-machine-idle-watchdog"
+	serviceName      = "ollama-machine-idle-watchdog"
+)
+
+// script records the last time Ollama was active, and powers the machine off once it has been idle for too long.
+// Ollama is considered active when it served requests other than the ones used to check its state,
+// as polled by the gateway or health checks. Loaded models and open connections aren't activity:
+// models may be kept loaded forever, and proxies keep idle connections to Ollama open.
+// The activity file lives in /run, so the idle time is reset when the machine boots.
+var script = `#!/bin/sh
+# Managed by ollama-machine: shuts the machine down when Ollama is idle.
+set -eu
+
+. ` + envFilePath + `
+
+ACTIVITY_FILE=` + activityFilePath + `
+
+mkdir -p "$(dirname "$ACTIVITY_FILE")"
+if [ ! -f "$ACTIVITY_FILE" ]; then
+	touch "$ACTIVITY_FILE"
+fi
+
+active() {
+	journalctl -u ollama --since "-2min" --no-pager -o cat \
+		| grep -F '[GIN]' \
+		| grep -v -e '"/"' -e '"/api/ps"' -e '"/api/version"' -e '"/api/tags"' \
+		| grep -q .
+}
+
+if active; then
+	touch "$ACTIVITY_FILE"
+	exit 0
+fi
+
+idle=$(( $(date +%s) - $(stat -c %Y "$ACTIVITY_FILE") ))
+if [ "$idle" -ge "$IDLE_TIMEOUT" ]; then
+	echo "Ollama has been idle for ${idle}s, shutting down"
+	systemctl poweroff
+fi
+`
+
+// InstallViaCloudInit installs the idle watchdog via cloud-init configuration.
+func InstallViaCloudInit(cloudInit *cloudinit.Config, timeout time.Duration) {
+	cloudInit.AddFile(cloudinit.File{
+		Path:        scriptPath,
+		Content:     script,
+		Permissions: "0755",
+	})
+	cloudInit.AddFile(cloudinit.File{
+		Path:    envFilePath,
+		Content: fmt.Sprintf("IDLE_TIMEOUT=%d\n", int64(timeout.Seconds())),
+	})
+	cloudInit.AddFile(cloudinit.File{
+		Path: "/etc/systemd/system/" + serviceName + ".service",
+		Content: fmt.Sprintf(`[Unit]
+Description=Shut the machine down when Ollama is idle
+After=ollama.service
+
+[Service]
+Type=oneshot
+ExecStart=%s`, scriptPath),
+	})
+	cloudInit.AddFile(cloudinit.File{
+		Path: "/etc/systemd/system/" + serviceName + ".timer",
+		Content: `[Unit]
+Description=Periodically check whether Ollama is idle
+
+[Timer]
+OnBootSec=1min
+OnUnitActiveSec=1min
+
+[Install]
+WantedBy=timers.target`,
+	})
+	cloudInit.AddRunCmd([]string{"sh", "-c", "systemctl daemon-reload && systemctl enable --now " + serviceName + ".timer"})
+}
+
+// ValidateTimeout returns an error if the given idle timeout is too short for the watchdog.
+func ValidateTimeout(timeout time.Duration) error {
+	if timeout < MinTimeout {
+		return fmt.Errorf("idle timeout must be at least %s", MinTimeout)
+	}
+
+	return nil
+}
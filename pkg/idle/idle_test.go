@@ -0,0 +1,175 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package idle_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/idle"
+	. "github.com/onsi/gomega"
+)
+
+func TestInstallViaCloudInit(t *testing.T) {
+	g := NewWithT(t)
+
+	cloudInitConfig := cloudinit.NewConfig()
+	idle.InstallViaCloudInit(cloudInitConfig, 30*time.Minute)
+
+	g.Expect(cloudInitConfig.WriteFiles).To(ContainElement(cloudinit.File{
+		Path:    "/etc/ollama-machine/idle.env",
+		Content: "IDLE_TIMEOUT=1800\n",
+	}))
+	g.Expect(cloudInitConfig.RunCmd).To(ContainElement([]string{"sh", "-c", "systemctl daemon-reload && systemctl enable --now ollama-machine-idle-watchdog.timer"}))
+
+}
+
+// ginLog returns a request log line of Ollama.
+func ginLog(method, path string) string {
+	return fmt.Sprintf("[GIN] 2025/01/01 - 10:00:00 | 200 |  1.2ms | 127.0.0.1 | %-7s %q", method, path)
+}
+
+func TestWatchdogScript(t *testing.T) {
+	tests := map[string]struct {
+		logs     []string
+		idleFor  time.Duration
+		poweroff bool
+	}{
+		"idle for longer than the timeout": {
+			idleFor:  time.Hour,
+			poweroff: true,
+		},
+		"idle for less than the timeout": {
+			idleFor:  10 * time.Minute,
+			poweroff: false,
+		},
+		"state checks only": {
+			logs:     []string{ginLog("GET", "/api/ps"), ginLog("GET", "/api/version"), ginLog("GET", "/api/tags"), ginLog("HEAD", "/")},
+			idleFor:  time.Hour,
+			poweroff: true,
+		},
+		"served request": {
+			logs:     []string{ginLog("GET", "/api/ps"), ginLog("POST", "/api/generate")},
+			idleFor:  time.Hour,
+			poweroff: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			dir := t.TempDir()
+			envFile := filepath.Join(dir, "idle.env")
+			activityFile := filepath.Join(dir, "run", "last-activity")
+			poweroffFile := filepath.Join(dir, "poweroff")
+			binDir := filepath.Join(dir, "bin")
+
+			cloudInitConfig := cloudinit.NewConfig()
+			idle.InstallViaCloudInit(cloudInitConfig, 30*time.Minute)
+
+			script := ""
+			for _, file := range cloudInitConfig.WriteFiles {
+				switch file.Path {
+				case "/usr/local/bin/ollama-machine-idle-watchdog":
+					script = file.Content
+				case "/etc/ollama-machine/idle.env":
+					g.Expect(os.WriteFile(envFile, []byte(file.Content), 0o600)).To(Succeed())
+				}
+			}
+
+			script = strings.ReplaceAll(script, "/etc/ollama-machine/idle.env", envFile)
+			script = strings.ReplaceAll(script, "/run/ollama-machine/last-activity", activityFile)
+
+			// Loaded models and open connections, such as idle connections of proxies, aren't activity.
+			fakes := map[string]string{
+				"journalctl": "cat <<'EOF'\n" + strings.Join(append([]string{"Listening on 127.0.0.1:11434"}, tt.logs...), "\n") + "\nEOF\n",
+				"ss":         "echo '0 0 127.0.0.1:11434 127.0.0.1:52000'\n",
+				"curl":       `echo '{"models":[{"name":"llama3.2:latest"}]}'` + "\n",
+				"systemctl":  "echo \"$@\" > " + poweroffFile + "\n",
+			}
+			g.Expect(os.Mkdir(binDir, 0o700)).To(Succeed())
+			for name, content := range fakes {
+				g.Expect(os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"+content), 0o700)).To(Succeed()) //nolint:gosec
+			}
+
+			g.Expect(os.MkdirAll(filepath.Dir(activityFile), 0o700)).To(Succeed())
+			g.Expect(os.WriteFile(activityFile, nil, 0o600)).To(Succeed())
+			lastActivity := time.Now().Add(-tt.idleFor)
+			g.Expect(os.Chtimes(activityFile, lastActivity, lastActivity)).To(Succeed())
+
+			cmd := exec.Command("sh", "-c", script)
+			cmd.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+			output, err := cmd.CombinedOutput()
+			g.Expect(err).NotTo(HaveOccurred(), string(output))
+
+			if tt.poweroff {
+				g.Expect(os.ReadFile(poweroffFile)).To(Equal([]byte("poweroff\n")))
+			} else {
+				g.Expect(poweroffFile).NotTo(BeAnExistingFile())
+			}
+
+			info, err := os.Stat(activityFile)
+			g.Expect(err).NotTo(HaveOccurred())
+			if tt.logs != nil && !tt.poweroff {
+				g.Expect(info.ModTime()).To(BeTemporally("~", time.Now(), time.Minute))
+			} else {
+				g.Expect(info.ModTime()).To(BeTemporally("~", lastActivity, time.Second))
+			}
+		})
+	}
+}
+
+func TestValidateTimeout(t *testing.T) {
+	tests := map[string]struct {
+		timeout  time.Duration
+		errorMsg string
+	}{
+		"valid": {
+			timeout: 30 * time.Minute,
+		},
+		"minimum": {
+			timeout: 5 * time.Minute,
+		},
+		"too short": {
+			timeout:  time.Minute,
+			errorMsg: "idle timeout must be at least 5m0s",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			err := idle.ValidateTimeout(tt.timeout)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(tt.errorMsg))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
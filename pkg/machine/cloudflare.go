@@ -0,0 +1,59 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package machine
+
+import "net/http"
+
+// CloudflareConfig describes the Cloudflare resources exposing Ollama through a Cloudflare Tunnel.
+type CloudflareConfig struct {
+	// CredentialsName is the name of the Cloudflare credentials in the credentials store.
+	CredentialsName string `json:"credentialsName"`
+	// ZoneID is the ID of the zone of the hostname.
+	ZoneID string `json:"zoneId"`
+	// Hostname is the public hostname routed to the tunnel.
+	Hostname string `json:"hostname"`
+	// TunnelID is the ID of the tunnel.
+	TunnelID string `json:"tunnelId"`
+	// DNSRecordID is the ID of the DNS record routing the hostname to the tunnel.
+	DNSRecordID string `json:"dnsRecordId,omitempty"`
+	// AccessApplicationID is the ID of the Access application protecting the hostname, if any.
+	AccessApplicationID string `json:"accessApplicationId,omitempty"`
+	// ServiceTokenID is the ID of the Access service token allowed by the application, if any.
+	ServiceTokenID string `json:"serviceTokenId,omitempty"`
+	// AccessClientID is the client ID of the Access service token.
+	AccessClientID string `json:"accessClientId,omitempty"`
+	// AccessClientSecret is the client secret of the Access service token.
+	AccessClientSecret string `json:"accessClientSecret,omitempty"`
+}
+
+// HTTPClient returns an HTTP client sending the Access service token, if any.
+func (c *CloudflareConfig) HTTPClient() *http.Client {
+	if c.AccessClientID == "" {
+		return &http.Client{}
+	}
+
+	return &http.Client{
+		Transport: &headerTransport{
+			headers: http.Header{
+				"Cf-Access-Client-Id":     []string{c.AccessClientID},
+				"Cf-Access-Client-Secret": []string{c.AccessClientSecret},
+			},
+			base: http.DefaultTransport,
+		},
+	}
+}
@@ -18,9 +18,17 @@
 package machine
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"strconv"
+	"time"
 
+	"github.com/alexandrevilain/ollama-machine/pkg/apikey"
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider"
 	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
 	gossh "golang.org/x/crypto/ssh"
@@ -29,6 +37,8 @@ import (
 const (
 	SSHUsername       = "ollama-machine"
 	OllamaEnvFilePath = "/home/ollama-machine/env"
+	// ExpiresAtTag is the provider tag holding the expiry date of the machine, in RFC 3339 format.
+	ExpiresAtTag = "ollama-machine-expires-at"
 )
 
 type Machine struct {
@@ -39,6 +49,37 @@ type Machine struct {
 	CredentialsName string            `json:"credentialsName"`
 	Connectivity    string            `json:"connectivity"`
 	KeyPair         *ssh.KeyPairFiles `json:"keyPair"`
+	Models          []string          `json:"models,omitempty"`
+	ModelCache      *ModelCacheConfig `json:"modelCache,omitempty"`
+	GPU             *GPU              `json:"gpu,omitempty"`
+	OllamaVersion   string            `json:"ollamaVersion,omitempty"`
+	IdleTimeout     time.Duration     `json:"idleTimeout,omitempty"`
+	ExpiresAt       *time.Time        `json:"expiresAt,omitempty"`
+	APIKeys         []apikey.Key      `json:"apiKeys,omitempty"`
+	OpenAI          *OpenAIConfig     `json:"openai,omitempty"`
+	PublicTLS       *PublicTLSConfig  `json:"publicTLS,omitempty"`
+	Cloudflare      *CloudflareConfig `json:"cloudflare,omitempty"`
+	WireGuard       *WireGuardConfig  `json:"wireguard,omitempty"`
+	Tailscale       *TailscaleConfig  `json:"tailscale,omitempty"`
+	// ExposedPorts are the ports opened to the outside world for the connectivity, in addition to SSH.
+	ExposedPorts []provider.Port `json:"exposedPorts,omitempty"`
+}
+
+// Expired returns true if the machine has an expiry date which is before now.
+func (m *Machine) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// RemainingTime returns a human readable representation of the time left before the machine expires.
+func (m *Machine) RemainingTime(now time.Time) string {
+	switch {
+	case m.ExpiresAt == nil:
+		return "-"
+	case m.Expired(now):
+		return "expired"
+	default:
+		return m.ExpiresAt.Sub(now).Round(time.Minute).String()
+	}
 }
 
 // SSHClient returns a new SSH client and session for the machine.
@@ -46,11 +87,179 @@ func (m *Machine) SSHClient() (*gossh.Client, *gossh.Session, error) {
 	return ssh.NewClient(m.IP, "22", SSHUsername, m.KeyPair)
 }
 
+// SSHDial returns a new SSH client connected to the machine.
+func (m *Machine) SSHDial() (*gossh.Client, error) {
+	return ssh.Dial(m.IP, "22", SSHUsername, m.KeyPair)
+}
+
+// OllamaClient returns an Ollama API client reaching the machine through its connectivity.
+// The returned function must be called to release the underlying connection.
+func (m *Machine) OllamaClient() (*ollama.Client, func() error, error) {
+	baseURL, httpClient, closeFn, err := m.OllamaHTTPClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ollama.NewClient(baseURL, httpClient), closeFn, nil
+}
+
+// OllamaThroughSSH returns true if the Ollama API of the machine is reached by dialing it through an SSH connection.
+func (m *Machine) OllamaThroughSSH() bool {
+	if m.PublicTLS != nil || m.Cloudflare != nil {
+		return false
+	}
+
+	if _, ok := m.EmbeddedTailscaleNode(); ok {
+		return false
+	}
+
+	return m.OllamaConfig.Loopback() || m.Connectivity == "private" || m.Connectivity == "wireguard" || m.Connectivity == ""
+}
+
+// OllamaHTTPClient returns the base URL of the Ollama API of the machine and an HTTP client reaching it through its connectivity.
+// Machines with private connectivity, or with Ollama only listening on the loopback interface, are reached by dialing Ollama through an SSH connection.
+// So are machines with WireGuard connectivity, as the WireGuard link may not be up on the local host.
+// Machines with Tailscale connectivity are reached through an embedded Tailscale node, when it is enabled.
+// The returned function must be called to release the underlying connection.
+func (m *Machine) OllamaHTTPClient() (*url.URL, *http.Client, func() error, error) {
+	baseURL := m.OllamaConfig.URL()
+
+	if m.PublicTLS != nil {
+		return baseURL, m.PublicTLS.HTTPClient(), func() error { return nil }, nil
+	}
+
+	if m.Cloudflare != nil {
+		return baseURL, m.Cloudflare.HTTPClient(), func() error { return nil }, nil
+	}
+
+	if node, ok := m.EmbeddedTailscaleNode(); ok {
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				DialContext: node.Dial,
+			},
+		}
+
+		// The node is shared by the process, and closed once the command ends.
+		return baseURL, httpClient, func() error { return nil }, nil
+	}
+
+	if !m.OllamaThroughSSH() {
+		return baseURL, &http.Client{}, func() error { return nil }, nil
+	}
+
+	sshClient, err := m.SSHDial()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return sshClient.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	return baseURL, httpClient, sshClient.Close, nil
+}
+
+// ModelCacheConfig is the configuration of the object storage bucket used as a model cache.
+type ModelCacheConfig struct {
+	// CredentialsName is the name of the object storage credentials in the credentials store.
+	CredentialsName string `json:"credentialsName"`
+	// Bucket is the name of the bucket storing models.
+	Bucket string `json:"bucket"`
+	// Prefix is the path prefix of models in the bucket.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// GPU describes the GPUs of the machine, as reported after provisioning.
+type GPU struct {
+	// Model is the name of the GPUs, or "mixed" when the machine has different models.
+	Model string `json:"model"`
+	// Count is the number of GPUs.
+	Count int `json:"count"`
+	// Memory is the total memory of all GPUs, in MiB.
+	Memory int64 `json:"memory"`
+	// DriverVersion is the version of the NVIDIA driver.
+	DriverVersion string `json:"driverVersion"`
+}
+
+// String returns a short description of the GPUs, such as "2x NVIDIA L4 (45 GiB)".
+func (g *GPU) String() string {
+	if g == nil {
+		return "-"
+	}
+
+	return fmt.Sprintf("%dx %s (%d GiB)", g.Count, g.Model, g.Memory/1024) //nolint:mnd
+}
+
+// OpenAIConfig is the configuration of the OpenAI-compatible server running on the machine.
+type OpenAIConfig struct {
+	// Port is the port the server listens on.
+	Port int `json:"port"`
+}
+
+// WireGuardConfig is the configuration of the WireGuard link between the machine and the local host.
+type WireGuardConfig struct {
+	// Network is the network of the link, holding the machine and local host addresses.
+	Network string `json:"network"`
+	// Port is the UDP port WireGuard listens on, on the machine.
+	Port int `json:"port"`
+	// ServerPublicKey is the public key of the machine.
+	ServerPublicKey string `json:"serverPublicKey"`
+	// ClientConfigPath is the path of the local WireGuard configuration.
+	ClientConfigPath string `json:"clientConfigPath"`
+}
+
+// TailscaleConfig describes the node of the machine in the tailnet.
+type TailscaleConfig struct {
+	// LoginServer is the URL of the custom control server, such as a Headscale server, if any.
+	LoginServer string `json:"loginServer,omitempty"`
+	// NodeID is the ID of the node.
+	NodeID string `json:"nodeId,omitempty"`
+	// CredentialsName is the name of the Tailscale API credentials used to remove the node,
+	// and to register ephemeral nodes again when the machine restarts, if any.
+	CredentialsName string `json:"credentialsName,omitempty"`
+	// Ephemeral is true for ephemeral nodes, which register again, as new nodes, when the machine restarts.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// Hostname is the hostname of the node, if set.
+	Hostname string `json:"hostname,omitempty"`
+	// Tags are the tags advertised by the node.
+	Tags []string `json:"tags,omitempty"`
+	// SSH is true when Tailscale SSH is enabled on the node.
+	SSH bool `json:"ssh,omitempty"`
+}
+
 type OllamaConfig struct {
-	Host string `json:"host"`
-	Port int    `json:"port"`
+	// Scheme is the scheme of the Ollama API, http when empty.
+	Scheme string `json:"scheme,omitempty"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
 }
 
 func (o OllamaConfig) Address() string {
 	return net.JoinHostPort(o.Host, strconv.Itoa(o.Port))
 }
+
+// Loopback returns true if Ollama only listens on the loopback interface of the machine,
+// so it can only be reached through SSH.
+func (o OllamaConfig) Loopback() bool {
+	if o.Host == "localhost" {
+		return true
+	}
+
+	ip, err := netip.ParseAddr(o.Host)
+
+	return err == nil && ip.IsLoopback()
+}
+
+// URL returns the base URL of the Ollama API.
+func (o OllamaConfig) URL() *url.URL {
+	scheme := o.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	return &url.URL{Scheme: scheme, Host: o.Address()}
+}
@@ -0,0 +1,98 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package machine_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	. "github.com/onsi/gomega"
+)
+
+func TestRemainingTime(t *testing.T) {
+	now := time.Date(2025, 1, 26, 20, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(7*time.Hour + 59*time.Minute + 40*time.Second)
+
+	tests := map[string]struct {
+		machine   *machine.Machine
+		now       time.Time
+		expired   bool
+		remaining string
+	}{
+		"no expiry": {
+			machine:   &machine.Machine{},
+			now:       now,
+			expired:   false,
+			remaining: "-",
+		},
+		"not expired": {
+			machine:   &machine.Machine{ExpiresAt: &expiresAt},
+			now:       now,
+			expired:   false,
+			remaining: "8h0m0s",
+		},
+		"expired": {
+			machine:   &machine.Machine{ExpiresAt: &expiresAt},
+			now:       expiresAt,
+			expired:   true,
+			remaining: "expired",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(tt.machine.Expired(tt.now)).To(Equal(tt.expired))
+			g.Expect(tt.machine.RemainingTime(tt.now)).To(Equal(tt.remaining))
+		})
+	}
+}
+
+func TestOllamaConfigLoopback(t *testing.T) {
+	tests := map[string]struct {
+		host     string
+		loopback bool
+	}{
+		"localhost": {
+			host:     "localhost",
+			loopback: true,
+		},
+		"loopback address": {
+			host:     "127.0.0.1",
+			loopback: true,
+		},
+		"public address": {
+			host:     "1.2.3.4",
+			loopback: false,
+		},
+		"domain": {
+			host:     "ollama.example.com",
+			loopback: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(machine.OllamaConfig{Host: tt.host}.Loopback()).To(Equal(tt.loopback))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package machine
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// PublicTLSServerName is the server name of the self-signed certificates of the public-tls connectivity.
+const PublicTLSServerName = "ollama-machine"
+
+// ErrCertificateMismatch is returned when the certificate presented by a machine doesn't match its pinned fingerprint.
+var ErrCertificateMismatch = errors.New("certificate doesn't match the pinned fingerprint")
+
+// PublicTLSConfig is the configuration of the authenticated TLS reverse proxy exposing Ollama.
+type PublicTLSConfig struct {
+	// Domain is the domain of the machine, when its certificate is issued using ACME.
+	Domain string `json:"domain,omitempty"`
+	// CertificateFingerprint is the SHA-256 fingerprint of the self-signed certificate of the proxy.
+	// It is empty when the certificate is issued using ACME.
+	CertificateFingerprint string `json:"certificateFingerprint,omitempty"`
+	// Token is the bearer token required by the proxy.
+	Token string `json:"token"`
+}
+
+// CertificateFingerprint returns the hex-encoded SHA-256 fingerprint of the given DER-encoded certificate.
+func CertificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// HTTPClient returns an HTTP client sending the bearer token and, for self-signed certificates,
+// verifying the certificate presented by the proxy against its pinned fingerprint.
+func (c *PublicTLSConfig) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &headerTransport{
+			headers: http.Header{"Authorization": []string{"Bearer " + c.Token}},
+			base: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: c.tlsConfig(),
+			},
+		},
+	}
+}
+
+func (c *PublicTLSConfig) tlsConfig() *tls.Config {
+	if c.CertificateFingerprint == "" {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: PublicTLSServerName,
+		// The certificate is self-signed, it is verified against its pinned fingerprint instead.
+		InsecureSkipVerify: true, //nolint:gosec
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 || CertificateFingerprint(state.PeerCertificates[0].Raw) != c.CertificateFingerprint {
+				return ErrCertificateMismatch
+			}
+
+			return nil
+		},
+	}
+}
+
+// headerTransport is an http.RoundTripper adding headers to requests.
+type headerTransport struct {
+	headers http.Header
+	base    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		req.Header[key] = values
+	}
+
+	return t.base.RoundTrip(req)
+}
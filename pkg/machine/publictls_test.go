@@ -0,0 +1,93 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package machine_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	. "github.com/onsi/gomega"
+)
+
+func TestPublicTLSConfigHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := map[string]struct {
+		config     *machine.PublicTLSConfig
+		statusCode int
+		errorMsg   string
+	}{
+		"pinned certificate": {
+			config: &machine.PublicTLSConfig{
+				CertificateFingerprint: machine.CertificateFingerprint(server.Certificate().Raw),
+				Token:                  "secret",
+			},
+			statusCode: http.StatusOK,
+		},
+		"wrong token": {
+			config: &machine.PublicTLSConfig{
+				CertificateFingerprint: machine.CertificateFingerprint(server.Certificate().Raw),
+				Token:                  "wrong",
+			},
+			statusCode: http.StatusUnauthorized,
+		},
+		"fingerprint mismatch": {
+			config: &machine.PublicTLSConfig{
+				CertificateFingerprint: machine.CertificateFingerprint([]byte("another certificate")),
+				Token:                  "secret",
+			},
+			errorMsg: machine.ErrCertificateMismatch.Error(),
+		},
+		"untrusted certificate without fingerprint": {
+			config: &machine.PublicTLSConfig{
+				Domain: "ollama.example.com",
+				Token:  "secret",
+			},
+			errorMsg: "certificate",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			resp, err := tt.config.HTTPClient().Get(server.URL)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			g.Expect(resp.StatusCode).To(Equal(tt.statusCode))
+		})
+	}
+}
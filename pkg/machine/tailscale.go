@@ -0,0 +1,44 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package machine
+
+import (
+	"github.com/alexandrevilain/ollama-machine/pkg/config"
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
+)
+
+// EmbeddedTailscaleNode returns an embedded Tailscale node reaching the tailnet of the machine,
+// when the machine has Tailscale connectivity and the auth key of the embedded node is set.
+// The node is shared by the process, and closed by tailscale.CloseEmbeddedNodes.
+func (m *Machine) EmbeddedTailscaleNode() (*tailscale.EmbeddedNode, bool) {
+	if m.Connectivity != "tailscale" {
+		return nil, false
+	}
+
+	authKey, ok := tailscale.EmbeddedAuthKey()
+	if !ok {
+		return nil, false
+	}
+
+	loginServer := ""
+	if m.Tailscale != nil {
+		loginServer = m.Tailscale.LoginServer
+	}
+
+	return tailscale.SharedEmbeddedNode(config.GetTailscaleDir(), loginServer, authKey), true
+}
@@ -0,0 +1,76 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelcache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Credentials are the credentials of an S3-compatible object storage.
+type Credentials struct {
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey"`
+
+	secretAccessKeyFromStdin bool `json:"-"`
+}
+
+func (c *Credentials) Complete() error {
+	if c.secretAccessKeyFromStdin {
+		secretFromStdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		secret := strings.TrimSuffix(string(secretFromStdin), "\n")
+		secret = strings.TrimSuffix(secret, "\r")
+
+		c.SecretAccessKey = secret
+	}
+
+	return nil
+}
+
+func (c *Credentials) Validate() error {
+	if c.AccessKeyID == "" {
+		return errors.New("access-key-id is required")
+	}
+
+	if c.SecretAccessKey == "" {
+		return errors.New("secret-access-key is required")
+	}
+
+	if c.Endpoint == "" && c.Region == "" {
+		return errors.New("endpoint or region is required")
+	}
+
+	return nil
+}
+
+func (c *Credentials) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.Endpoint, "endpoint", "", "S3-compatible object storage endpoint, leave empty for AWS S3")
+	fs.StringVar(&c.Region, "region", "", "Object storage region")
+	fs.StringVar(&c.AccessKeyID, "access-key-id", "", "Object storage access key ID")
+	fs.StringVar(&c.SecretAccessKey, "secret-access-key", "", "Object storage secret access key")
+	fs.BoolVar(&c.secretAccessKeyFromStdin, "secret-access-key-from-stdin", false, "Read object storage secret access key from stdin")
+}
@@ -0,0 +1,238 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package modelcache syncs the Ollama model store of machines with an S3-compatible object storage bucket.
+package modelcache
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/modelstore"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// CredentialsKind is the kind under which object storage credentials are stored in the credentials store.
+	CredentialsKind = "s3"
+
+	configDir          = "/etc/ollama-machine"
+	rcloneConfPath     = configDir + "/model-cache.conf"
+	envFilePath        = configDir + "/model-cache.env"
+	modelsListPath     = configDir + "/model-cache.models"
+	scriptPath         = "/usr/local/bin/ollama-model-cache"
+	saveServiceName    = "ollama-model-cache-save"
+	restoreServiceName = "ollama-model-cache-restore"
+	remoteName         = "cache"
+)
+
+// installRcloneCommand installs rclone from the distribution packages,
+// or from the package published by rclone when the distribution doesn't provide it.
+const installRcloneCommand = `command -v rclone || (apt-get update && apt-get install -y rclone) || ` +
+	`(curl -fsSL -o /tmp/rclone.deb "https://downloads.rclone.org/rclone-current-linux-$(dpkg --print-architecture).deb" && dpkg -i /tmp/rclone.deb && rm -f /tmp/rclone.deb)`
+
+const script = `#!/bin/sh
+# Managed by ollama-machine: syncs the Ollama model store with an object storage bucket.
+set -eu
+
+CONFIG=` + rcloneConfPath + `
+MODELS=` + modelstore.RemotePath + `
+LIST=` + modelsListPath + `
+. ` + envFilePath + `
+
+if [ ! -f "$CONFIG" ]; then
+	echo "model cache credentials are not available yet" >&2
+	exit 0
+fi
+
+rclone() {
+	command rclone --config "$CONFIG" "$@"
+}
+
+# restore fetches the given manifests and their blobs from the bucket, and records them so they are restored at boot.
+# Without manifest, the recorded ones are restored.
+# The manifest is moved into the store last, so a model only shows up once all its blobs are there.
+restore() {
+	if [ "$#" -eq 0 ]; then
+		[ -f "$LIST" ] || exit 0
+		set -- $(cat "$LIST")
+	fi
+	for manifest in "$@"; do
+		grep -qxF "$manifest" "$LIST" 2>/dev/null || echo "$manifest" >> "$LIST"
+	done
+	tmp=$(mktemp -d)
+	trap 'rm -rf "$tmp"' EXIT
+	for manifest in "$@"; do
+		if ! rclone copyto "$REMOTE/$manifest" "$tmp/manifest"; then
+			echo "$manifest is not cached" >&2
+			continue
+		fi
+		grep -o 'sha256:[0-9a-f]\{64\}' "$tmp/manifest" | sed 's/:/-/' > "$tmp/blobs"
+		rclone copy "$REMOTE/blobs" "$MODELS/blobs" --files-from "$tmp/blobs" --ignore-existing
+		mkdir -p "$(dirname "$MODELS/$manifest")"
+		mv "$tmp/manifest" "$MODELS/$manifest"
+	done
+	chown -R ollama:ollama "$MODELS"
+}
+
+# save uploads the blobs which are not in the bucket yet, along with all manifests.
+save() {
+	rclone copy "$MODELS/blobs" "$REMOTE/blobs" --ignore-existing --exclude '*-partial*'
+	rclone copy "$MODELS/manifests" "$REMOTE/manifests"
+}
+
+command="$1"
+shift
+case "$command" in
+	restore) restore "$@" ;;
+	save) save ;;
+	*) echo "usage: $0 restore [manifest]... | save" >&2; exit 1 ;;
+esac
+`
+
+// remote returns the rclone path of the model store in the bucket.
+func remote(cfg *machine.ModelCacheConfig) string {
+	return remoteName + ":" + path.Join(cfg.Bucket, cfg.Prefix)
+}
+
+// InstallViaCloudInit installs the model cache tooling via cloud-init configuration.
+// Credentials are not part of the cloud-init configuration, they are delivered over SSH once the machine is up.
+func InstallViaCloudInit(cloudInit *cloudinit.Config, cfg *machine.ModelCacheConfig) {
+	cloudInit.AddFile(cloudinit.File{
+		Path:        scriptPath,
+		Content:     script,
+		Permissions: "0755",
+	})
+	cloudInit.AddFile(cloudinit.File{
+		Path:    envFilePath,
+		Content: fmt.Sprintf("REMOTE=%s\n", ssh.Quote(remote(cfg))),
+	})
+	cloudInit.AddFile(cloudinit.File{
+		Path: "/etc/systemd/system/" + saveServiceName + ".service",
+		Content: fmt.Sprintf(`[Unit]
+Description=Upload new Ollama models to the model cache
+ConditionPathExists=%s
+
+[Service]
+Type=oneshot
+ExecStart=%s save`, rcloneConfPath, scriptPath),
+	})
+	cloudInit.AddFile(cloudinit.File{
+		Path: "/etc/systemd/system/" + saveServiceName + ".timer",
+		Content: `[Unit]
+Description=Periodically upload new Ollama models to the model cache
+
+[Timer]
+OnBootSec=10min
+OnUnitActiveSec=10min
+
+[Install]
+WantedBy=timers.target`,
+	})
+	// Machines whose disk doesn't survive a stop get their models back before Ollama starts.
+	cloudInit.AddFile(cloudinit.File{
+		Path: "/etc/systemd/system/" + restoreServiceName + ".service",
+		Content: fmt.Sprintf(`[Unit]
+Description=Restore Ollama models from the model cache
+ConditionPathExists=%s
+Wants=network-online.target
+After=network-online.target
+Before=ollama.service
+
+[Service]
+Type=oneshot
+ExecStart=%s restore
+
+[Install]
+WantedBy=multi-user.target ollama.service`, rcloneConfPath, scriptPath),
+	})
+	cloudInit.AddRunCmd([]string{"sh", "-c", installRcloneCommand})
+	cloudInit.AddRunCmd([]string{"sh", "-c", "systemctl daemon-reload && systemctl enable " + restoreServiceName + ".service && systemctl enable --now " + saveServiceName + ".timer"})
+}
+
+// RcloneConfig returns the rclone configuration giving access to the object storage.
+func RcloneConfig(creds *Credentials) string {
+	lines := []string{
+		"[" + remoteName + "]",
+		"type = s3",
+	}
+
+	if creds.Endpoint == "" {
+		lines = append(lines, "provider = AWS")
+	} else {
+		lines = append(lines, "provider = Other", "endpoint = "+creds.Endpoint)
+	}
+
+	if creds.Region != "" {
+		lines = append(lines, "region = "+creds.Region)
+	}
+
+	lines = append(lines,
+		"access_key_id = "+creds.AccessKeyID,
+		"secret_access_key = "+creds.SecretAccessKey,
+		"no_check_bucket = true",
+	)
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// DeliverCredentials writes the object storage credentials on the machine, readable by root only.
+func DeliverCredentials(client *gossh.Client, creds *Credentials) error {
+	script := fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s", configDir, rcloneConfPath)
+
+	_, err := ssh.RunWithStdin(client, "sudo sh -c "+ssh.Quote(script), strings.NewReader(RcloneConfig(creds)))
+	if err != nil {
+		return fmt.Errorf("failed to deliver model cache credentials: %w", err)
+	}
+
+	return nil
+}
+
+// Restore fetches the given models from the bucket when they are cached, and records them on the machine,
+// so they are fetched again when it boots. Models which are not cached are skipped, so Ollama pulls them from their registry.
+func Restore(client *gossh.Client, models []string) error {
+	args := []string{scriptPath, "restore"}
+	for _, model := range models {
+		name, err := modelstore.ParseName(model)
+		if err != nil {
+			return err
+		}
+
+		args = append(args, ssh.Quote(name.ManifestPath()))
+	}
+
+	_, err := ssh.Run(client, "sudo "+strings.Join(args, " "))
+	if err != nil {
+		return fmt.Errorf("failed to restore models from cache: %w", err)
+	}
+
+	return nil
+}
+
+// Save uploads the models of the machine which are not in the bucket yet.
+func Save(client *gossh.Client) error {
+	_, err := ssh.Run(client, "sudo "+scriptPath+" save")
+	if err != nil {
+		return fmt.Errorf("failed to save models to cache: %w", err)
+	}
+
+	return nil
+}
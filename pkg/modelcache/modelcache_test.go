@@ -0,0 +1,187 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelcache_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudinit"
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/modelcache"
+	. "github.com/onsi/gomega"
+)
+
+func TestRcloneConfig(t *testing.T) {
+	tests := map[string]struct {
+		credentials *modelcache.Credentials
+		result      string
+	}{
+		"aws s3": {
+			credentials: &modelcache.Credentials{
+				Region:          "eu-west-3",
+				AccessKeyID:     "AKIA",
+				SecretAccessKey: "secret",
+			},
+			result: `[cache]
+type = s3
+provider = AWS
+region = eu-west-3
+access_key_id = AKIA
+secret_access_key = secret
+no_check_bucket = true
+`,
+		},
+		"minio": {
+			credentials: &modelcache.Credentials{
+				Endpoint:        "http://minio.local:9000",
+				AccessKeyID:     "minioadmin",
+				SecretAccessKey: "minioadmin",
+			},
+			result: `[cache]
+type = s3
+provider = Other
+endpoint = http://minio.local:9000
+access_key_id = minioadmin
+secret_access_key = minioadmin
+no_check_bucket = true
+`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(modelcache.RcloneConfig(tt.credentials)).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestInstallViaCloudInit(t *testing.T) {
+	tests := map[string]struct {
+		config *machine.ModelCacheConfig
+		remote string
+	}{
+		"bucket only": {
+			config: &machine.ModelCacheConfig{Bucket: "models"},
+			remote: "REMOTE='cache:models'\n",
+		},
+		"bucket with prefix": {
+			config: &machine.ModelCacheConfig{Bucket: "models", Prefix: "ollama/"},
+			remote: "REMOTE='cache:models/ollama'\n",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			cloudInitConfig := cloudinit.NewConfig()
+			modelcache.InstallViaCloudInit(cloudInitConfig, tt.config)
+
+			g.Expect(cloudInitConfig.WriteFiles).To(ContainElement(cloudinit.File{
+				Path:    "/etc/ollama-machine/model-cache.env",
+				Content: tt.remote,
+			}))
+
+			units := map[string]string{}
+			for _, file := range cloudInitConfig.WriteFiles {
+				units[file.Path] = file.Content
+			}
+			g.Expect(units).To(HaveKeyWithValue("/etc/systemd/system/ollama-model-cache-restore.service", ContainSubstring("Before=ollama.service")))
+
+			rendered, err := cloudInitConfig.Render()
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(rendered)).NotTo(ContainSubstring("secret_access_key"))
+		})
+	}
+}
+
+func TestRestoreScript(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	bucket := filepath.Join(dir, "bucket")
+	store := filepath.Join(dir, "models")
+	configDir := filepath.Join(dir, "etc")
+	binDir := filepath.Join(dir, "bin")
+
+	cloudInitConfig := cloudinit.NewConfig()
+	modelcache.InstallViaCloudInit(cloudInitConfig, &machine.ModelCacheConfig{Bucket: "models"})
+
+	script := ""
+	for _, file := range cloudInitConfig.WriteFiles {
+		if file.Path == "/usr/local/bin/ollama-model-cache" {
+			script = file.Content
+		}
+	}
+
+	script = strings.ReplaceAll(script, "/etc/ollama-machine", configDir)
+	script = strings.ReplaceAll(script, "/usr/share/ollama/.ollama/models", store)
+
+	g.Expect(os.MkdirAll(configDir, 0o700)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(configDir, "model-cache.conf"), nil, 0o600)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(configDir, "model-cache.env"), []byte("REMOTE="+bucket+"\n"), 0o600)).To(Succeed())
+
+	// The bucket holds llama3.2, but not qwen3.
+	manifest := "manifests/registry.ollama.ai/library/llama3.2/latest"
+	blob := "sha256-" + strings.Repeat("a", 64)
+	g.Expect(os.MkdirAll(filepath.Join(bucket, filepath.Dir(manifest)), 0o700)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(bucket, manifest), []byte(`{"layers":[{"digest":"sha256:`+strings.Repeat("a", 64)+`"}]}`), 0o600)).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(bucket, "blobs"), 0o700)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(bucket, "blobs", blob), []byte("weights"), 0o600)).To(Succeed())
+
+	fakes := map[string]string{
+		"rclone": `shift 2
+case "$1" in
+	copyto) [ -f "$2" ] && mkdir -p "$(dirname "$3")" && cp "$2" "$3" ;;
+	copy) mkdir -p "$3" && while read -r f; do cp "$2/$f" "$3/$f"; done < "$5" ;;
+esac
+`,
+		"chown": "exit 0\n",
+	}
+	g.Expect(os.Mkdir(binDir, 0o700)).To(Succeed())
+	for name, content := range fakes {
+		g.Expect(os.WriteFile(filepath.Join(binDir, name), []byte("#!/bin/sh\n"+content), 0o700)).To(Succeed()) //nolint:gosec
+	}
+
+	run := func(args ...string) {
+		cmd := exec.Command("sh", append([]string{"-c", script, "ollama-model-cache"}, args...)...)
+		cmd.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		output, err := cmd.CombinedOutput()
+		g.Expect(err).NotTo(HaveOccurred(), string(output))
+	}
+
+	// Models restored when they are pulled are recorded, cached or not.
+	run("restore", manifest, "manifests/registry.ollama.ai/library/qwen3/latest")
+	g.Expect(filepath.Join(store, manifest)).To(BeAnExistingFile())
+	g.Expect(filepath.Join(store, "blobs", blob)).To(BeAnExistingFile())
+	g.Expect(os.ReadFile(filepath.Join(configDir, "model-cache.models"))).To(Equal([]byte(manifest + "\nmanifests/registry.ollama.ai/library/qwen3/latest\n")))
+
+	// Recorded models are restored at boot, when the store didn't survive a stop.
+	g.Expect(os.RemoveAll(store)).To(Succeed())
+	run("restore")
+	g.Expect(filepath.Join(store, manifest)).To(BeAnExistingFile())
+	g.Expect(filepath.Join(store, "blobs", blob)).To(BeAnExistingFile())
+	g.Expect(os.ReadFile(filepath.Join(configDir, "model-cache.models"))).To(Equal([]byte(manifest + "\nmanifests/registry.ollama.ai/library/qwen3/latest\n")))
+}
@@ -0,0 +1,265 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelstore
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/machine"
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	"github.com/google/uuid"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const modelfileName = "Modelfile"
+
+// LocalFile is a local file or directory referenced by a Modelfile.
+type LocalFile struct {
+	// LocalPath is the path of the file on the local host.
+	LocalPath string
+	// ArchivePath is the slash separated path of the file in the uploaded build context.
+	ArchivePath string
+}
+
+// RewriteModelfile rewrites the FROM and ADAPTER instructions of the given Modelfile referencing local paths,
+// so they reference the same files under remoteDir. Relative paths are resolved from baseDir.
+// It returns the rewritten Modelfile and the local files to upload.
+func RewriteModelfile(content, baseDir, remoteDir string) (string, []LocalFile, error) {
+	lines := strings.Split(content, "\n")
+	files := []LocalFile{}
+	inMultiline := false
+
+	for i, line := range lines {
+		wasInMultiline := inMultiline
+		if strings.Count(line, `"""`)%2 == 1 {
+			inMultiline = !inMultiline
+		}
+
+		if wasInMultiline {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 { //nolint:mnd
+			continue
+		}
+
+		instruction := strings.ToUpper(fields[0])
+		if instruction != "FROM" && instruction != "ADAPTER" {
+			continue
+		}
+
+		localPath, ok, err := resolveLocalPath(strings.Trim(strings.TrimSpace(strings.TrimSpace(line)[len(fields[0]):]), `"`), baseDir)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		file := LocalFile{
+			LocalPath:   localPath,
+			ArchivePath: path.Join("files", strconv.Itoa(len(files)), filepath.Base(localPath)),
+		}
+		files = append(files, file)
+		lines[i] = fmt.Sprintf("%s %s", fields[0], path.Join(remoteDir, file.ArchivePath))
+	}
+
+	return strings.Join(lines, "\n"), files, nil
+}
+
+// resolveLocalPath returns the absolute path of the given Modelfile reference when it exists on the local host.
+func resolveLocalPath(ref, baseDir string) (string, bool, error) {
+	if ref == "" {
+		return "", false, nil
+	}
+
+	if ref == "~" || strings.HasPrefix(ref, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false, err
+		}
+
+		ref = filepath.Join(home, ref[1:])
+	}
+
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(baseDir, ref)
+	}
+
+	_, err := os.Stat(ref)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return ref, true, nil
+}
+
+// Create builds the model named name on the machine reachable through client from the Modelfile at modelfilePath.
+// Local files referenced by the Modelfile are uploaded along with it, and the output of
+// the remote ollama CLI is written to output.
+func Create(client *gossh.Client, modelfilePath, name string, output io.Writer) error {
+	content, err := os.ReadFile(modelfilePath)
+	if err != nil {
+		return fmt.Errorf("failed to read Modelfile: %w", err)
+	}
+
+	remoteDir := path.Join("/tmp", "ollama-machine-"+uuid.New().String())
+
+	modelfile, files, err := RewriteModelfile(string(content), filepath.Dir(modelfilePath), remoteDir)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_, _ = ssh.Run(client, "rm -rf "+ssh.Quote(remoteDir))
+	}()
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeBuildContext(writer, modelfile, files))
+	}()
+
+	_, err = ssh.RunWithStdin(client, fmt.Sprintf("mkdir -p %[1]s && tar -C %[1]s -xf -", ssh.Quote(remoteDir)), reader)
+	if err != nil {
+		return fmt.Errorf("failed to upload build context: %w", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create ssh session: %w", err)
+	}
+
+	defer func() {
+		_ = session.Close()
+	}()
+
+	session.Stdout = output
+	session.Stderr = output
+
+	// The env file is sourced so the ollama CLI targets the address Ollama listens on.
+	script := fmt.Sprintf("set -a && . %s && set +a && ollama create %s -f %s",
+		ssh.Quote(machine.OllamaEnvFilePath),
+		ssh.Quote(name),
+		ssh.Quote(path.Join(remoteDir, modelfileName)),
+	)
+
+	err = session.Run("sh -c " + ssh.Quote(script))
+	if err != nil {
+		return fmt.Errorf("failed to create model: %w", err)
+	}
+
+	return nil
+}
+
+// writeBuildContext writes a tar archive containing the Modelfile and the files it references.
+func writeBuildContext(w io.Writer, modelfile string, files []LocalFile) error {
+	tw := tar.NewWriter(w)
+
+	err := tw.WriteHeader(&tar.Header{
+		Name: modelfileName,
+		Mode: 0o644, //nolint:mnd
+		Size: int64(len(modelfile)),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(tw, modelfile)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err = addToArchive(tw, file)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to build context: %w", file.LocalPath, err)
+		}
+	}
+
+	return tw.Close()
+}
+
+// addToArchive adds the given local file or directory to the archive under its archive path.
+func addToArchive(tw *tar.Writer, file LocalFile) error {
+	return filepath.WalkDir(file.LocalPath, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(file.LocalPath, localPath)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		header.Name = path.Join(file.ArchivePath, filepath.ToSlash(rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			_ = f.Close()
+		}()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+}
@@ -0,0 +1,81 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/modelstore"
+	. "github.com/onsi/gomega"
+)
+
+func TestRewriteModelfile(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(baseDir, "model.gguf"), []byte("gguf"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(baseDir, "adapter"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		modelfile string
+		result    string
+		files     []modelstore.LocalFile
+	}{
+		"model from registry": {
+			modelfile: "FROM llama3.2\nPARAMETER temperature 0.2",
+			result:    "FROM llama3.2\nPARAMETER temperature 0.2",
+			files:     []modelstore.LocalFile{},
+		},
+		"relative gguf file and adapter": {
+			modelfile: "FROM ./model.gguf\nadapter adapter",
+			result:    "FROM /tmp/ctx/files/0/model.gguf\nadapter /tmp/ctx/files/1/adapter",
+			files: []modelstore.LocalFile{
+				{LocalPath: filepath.Join(baseDir, "model.gguf"), ArchivePath: "files/0/model.gguf"},
+				{LocalPath: filepath.Join(baseDir, "adapter"), ArchivePath: "files/1/adapter"},
+			},
+		},
+		"absolute quoted path": {
+			modelfile: `FROM "` + filepath.Join(baseDir, "model.gguf") + `"`,
+			result:    "FROM /tmp/ctx/files/0/model.gguf",
+			files: []modelstore.LocalFile{
+				{LocalPath: filepath.Join(baseDir, "model.gguf"), ArchivePath: "files/0/model.gguf"},
+			},
+		},
+		"instruction inside multiline block": {
+			modelfile: "FROM llama3.2\nSYSTEM \"\"\"\nFROM ./model.gguf\n\"\"\"",
+			result:    "FROM llama3.2\nSYSTEM \"\"\"\nFROM ./model.gguf\n\"\"\"",
+			files:     []modelstore.LocalFile{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, files, err := modelstore.RewriteModelfile(tt.modelfile, baseDir, "/tmp/ctx")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+			g.Expect(files).To(Equal(tt.files))
+		})
+	}
+}
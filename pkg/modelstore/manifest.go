@@ -0,0 +1,89 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Layer is a blob referenced by a manifest.
+type Layer struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// Manifest describes the blobs of a model.
+type Manifest struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	MediaType     string  `json:"mediaType"`
+	Config        Layer   `json:"config"`
+	Layers        []Layer `json:"layers"`
+}
+
+// Blobs returns all the blobs referenced by the manifest, including its config.
+func (m *Manifest) Blobs() []Layer {
+	result := make([]Layer, 0, len(m.Layers)+1)
+	if m.Config.Digest != "" {
+		result = append(result, m.Config)
+	}
+
+	return append(result, m.Layers...)
+}
+
+// BlobPath returns the slash separated path of the blob with the given digest, relative to the store root.
+func BlobPath(digest string) string {
+	return path.Join("blobs", strings.Replace(digest, ":", "-", 1))
+}
+
+// DefaultPath returns the path of the local model store, honoring the OLLAMA_MODELS environment variable.
+func DefaultPath() (string, error) {
+	if p := os.Getenv("OLLAMA_MODELS"); p != "" {
+		return p, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".ollama", "models"), nil
+}
+
+// ReadManifest reads the manifest of the given model from the store at root.
+// It returns the parsed manifest along with its raw content.
+func ReadManifest(root string, name Name) (*Manifest, []byte, error) {
+	content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name.ManifestPath())))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest of %s: %w", name, err)
+	}
+
+	manifest := &Manifest{}
+
+	err = json.Unmarshal(content, manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest of %s: %w", name, err)
+	}
+
+	return manifest, content, nil
+}
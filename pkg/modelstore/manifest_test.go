@@ -0,0 +1,60 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelstore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/modelstore"
+	. "github.com/onsi/gomega"
+)
+
+func TestReadManifest(t *testing.T) {
+	g := NewWithT(t)
+
+	root := t.TempDir()
+	name, err := modelstore.ParseName("me/my-finetune")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	manifestPath := filepath.Join(root, filepath.FromSlash(name.ManifestPath()))
+	g.Expect(os.MkdirAll(filepath.Dir(manifestPath), 0o750)).To(Succeed())
+	g.Expect(os.WriteFile(manifestPath, []byte(`{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+  "config": {"mediaType": "application/vnd.docker.container.image.v1+json", "digest": "sha256:c0nf19", "size": 485},
+  "layers": [
+    {"mediaType": "application/vnd.ollama.image.model", "digest": "sha256:m0de1", "size": 2019377376},
+    {"mediaType": "application/vnd.ollama.image.template", "digest": "sha256:temp1a7e", "size": 1429}
+  ]
+}`), 0o600)).To(Succeed())
+
+	manifest, _, err := modelstore.ReadManifest(root, name)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	digests := []string{}
+	for _, layer := range manifest.Blobs() {
+		digests = append(digests, layer.Digest)
+	}
+	g.Expect(digests).To(Equal([]string{"sha256:c0nf19", "sha256:m0de1", "sha256:temp1a7e"}))
+	g.Expect(modelstore.BlobPath("sha256:m0de1")).To(Equal("blobs/sha256-m0de1"))
+
+	_, _, err = modelstore.ReadManifest(root, modelstore.Name{Host: "registry.ollama.ai", Namespace: "library", Model: "missing", Tag: "latest"})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,96 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package modelstore reads Ollama model stores and copies models between them.
+package modelstore
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry used when a model name doesn't specify one.
+	DefaultRegistry = "registry.ollama.ai"
+	// DefaultNamespace is the namespace used when a model name doesn't specify one.
+	DefaultNamespace = "library"
+	// DefaultTag is the tag used when a model name doesn't specify one.
+	DefaultTag = "latest"
+)
+
+// Name is a fully qualified model name.
+type Name struct {
+	Host      string
+	Namespace string
+	Model     string
+	Tag       string
+}
+
+// ParseName parses a model name as accepted by the ollama CLI, filling the missing parts with defaults.
+func ParseName(s string) (Name, error) {
+	name := Name{
+		Host:      DefaultRegistry,
+		Namespace: DefaultNamespace,
+		Tag:       DefaultTag,
+	}
+
+	if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		name.Tag = s[i+1:]
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, "/")
+	switch len(parts) {
+	case 1:
+		name.Model = parts[0]
+	case 2: //nolint:mnd
+		name.Namespace, name.Model = parts[0], parts[1]
+	case 3: //nolint:mnd
+		name.Host, name.Namespace, name.Model = parts[0], parts[1], parts[2]
+	default:
+		return Name{}, fmt.Errorf("invalid model name %q", s)
+	}
+
+	for _, part := range []string{name.Host, name.Namespace, name.Model, name.Tag} {
+		if part == "" || part == "." || part == ".." {
+			return Name{}, fmt.Errorf("invalid model name %q", s)
+		}
+	}
+
+	return name, nil
+}
+
+// String returns the short form of the name, as displayed by the ollama CLI.
+func (n Name) String() string {
+	result := n.Model + ":" + n.Tag
+
+	if n.Host != DefaultRegistry {
+		return path.Join(n.Host, n.Namespace, result)
+	}
+
+	if n.Namespace != DefaultNamespace {
+		return path.Join(n.Namespace, result)
+	}
+
+	return result
+}
+
+// ManifestPath returns the slash separated path of the model manifest, relative to the store root.
+func (n Name) ManifestPath() string {
+	return path.Join("manifests", n.Host, n.Namespace, n.Model, n.Tag)
+}
@@ -0,0 +1,91 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelstore_test
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/modelstore"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseName(t *testing.T) {
+	tests := map[string]struct {
+		input        string
+		result       modelstore.Name
+		manifestPath string
+		short        string
+		wantErr      bool
+	}{
+		"model only": {
+			input:        "llama3.2",
+			result:       modelstore.Name{Host: "registry.ollama.ai", Namespace: "library", Model: "llama3.2", Tag: "latest"},
+			manifestPath: "manifests/registry.ollama.ai/library/llama3.2/latest",
+			short:        "llama3.2:latest",
+		},
+		"model with tag": {
+			input:        "llama3.2:1b",
+			result:       modelstore.Name{Host: "registry.ollama.ai", Namespace: "library", Model: "llama3.2", Tag: "1b"},
+			manifestPath: "manifests/registry.ollama.ai/library/llama3.2/1b",
+			short:        "llama3.2:1b",
+		},
+		"model with namespace": {
+			input:        "me/my-finetune:v2",
+			result:       modelstore.Name{Host: "registry.ollama.ai", Namespace: "me", Model: "my-finetune", Tag: "v2"},
+			manifestPath: "manifests/registry.ollama.ai/me/my-finetune/v2",
+			short:        "me/my-finetune:v2",
+		},
+		"model with host and port": {
+			input:        "localhost:5000/me/my-finetune",
+			result:       modelstore.Name{Host: "localhost:5000", Namespace: "me", Model: "my-finetune", Tag: "latest"},
+			manifestPath: "manifests/localhost:5000/me/my-finetune/latest",
+			short:        "localhost:5000/me/my-finetune:latest",
+		},
+		"too many parts": {
+			input:   "a/b/c/d",
+			wantErr: true,
+		},
+		"path traversal": {
+			input:   "../../etc:passwd",
+			wantErr: true,
+		},
+		"empty tag": {
+			input:   "llama3.2:",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, err := modelstore.ParseName(tt.input)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+			g.Expect(result.ManifestPath()).To(Equal(tt.manifestPath))
+			g.Expect(result.String()).To(Equal(tt.short))
+		})
+	}
+}
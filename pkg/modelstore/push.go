@@ -0,0 +1,164 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelstore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	// RemotePath is the path of the model store on machines, as configured by the Ollama install script.
+	RemotePath = "/usr/share/ollama/.ollama/models"
+
+	remoteOwner = "ollama:ollama"
+)
+
+// ProgressFunc is called with the progress of the current operation.
+type ProgressFunc func(status string, completed, total int64)
+
+// Push copies the given model from the local store at localRoot to the machine reachable through client.
+// Blobs already present on the machine are skipped, and the manifest is copied last
+// so the model only shows up once all its blobs are available.
+func Push(client *gossh.Client, localRoot string, name Name, fn ProgressFunc) error {
+	manifest, content, err := ReadManifest(localRoot, name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := remoteBlobs(client)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range manifest.Blobs() {
+		status := "pushing " + shortDigest(layer.Digest)
+
+		if _, ok := existing[layer.Digest]; ok {
+			fn("skipping "+shortDigest(layer.Digest)+", already present", layer.Size, layer.Size)
+
+			continue
+		}
+
+		err = pushBlob(client, localRoot, layer, func(completed int64) {
+			fn(status, completed, layer.Size)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fn("writing manifest", 0, 0)
+
+	return writeRemoteFile(client, path.Join(RemotePath, name.ManifestPath()), bytes.NewReader(content))
+}
+
+// remoteBlobs returns the digests of the blobs available on the machine.
+func remoteBlobs(client *gossh.Client) (map[string]struct{}, error) {
+	blobsDir := path.Join(RemotePath, "blobs")
+
+	output, err := ssh.Run(client, "sudo sh -c "+ssh.Quote(fmt.Sprintf("ls -1 %s 2>/dev/null || true", ssh.Quote(blobsDir))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote blobs: %w", err)
+	}
+
+	result := map[string]struct{}{}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		result[strings.Replace(line, "-", ":", 1)] = struct{}{}
+	}
+
+	return result, nil
+}
+
+// pushBlob copies a blob of the local store to the machine.
+func pushBlob(client *gossh.Client, localRoot string, layer Layer, fn func(completed int64)) error {
+	file, err := os.Open(filepath.Join(localRoot, filepath.FromSlash(BlobPath(layer.Digest))))
+	if err != nil {
+		return fmt.Errorf("failed to open blob: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := &progressReader{r: file, fn: fn}
+
+	err = writeRemoteFile(client, path.Join(RemotePath, BlobPath(layer.Digest)), reader)
+	if err != nil {
+		return fmt.Errorf("failed to push blob %s: %w", layer.Digest, err)
+	}
+
+	return nil
+}
+
+// writeRemoteFile atomically writes the content of r to remotePath, owned by the ollama user.
+// Only the file and the directories created for it are given to the ollama user, not the whole store.
+func writeRemoteFile(client *gossh.Client, remotePath string, r io.Reader) error {
+	tmpPath := remotePath + ".partial"
+	script := fmt.Sprintf(`d=%[1]s; while [ ! -d "$d" ]; do set -- "$d" "$@"; d=$(dirname "$d"); done; `+
+		`mkdir -p %[1]s && cat > %[2]s && chown %[4]s %[2]s && mv %[2]s %[3]s && { [ "$#" -eq 0 ] || chown %[4]s "$@"; }`,
+		ssh.Quote(path.Dir(remotePath)),
+		ssh.Quote(tmpPath),
+		ssh.Quote(remotePath),
+		remoteOwner,
+	)
+
+	_, err := ssh.RunWithStdin(client, "sudo sh -c "+ssh.Quote(script), r)
+
+	return err
+}
+
+// shortDigest returns the digest without its algorithm, truncated as the ollama CLI does.
+func shortDigest(digest string) string {
+	const length = 12
+
+	digest = digest[strings.Index(digest, ":")+1:]
+	if len(digest) > length {
+		return digest[:length]
+	}
+
+	return digest
+}
+
+// progressReader reports the number of bytes read.
+type progressReader struct {
+	r         io.Reader
+	completed int64
+	fn        func(completed int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.completed += int64(n)
+	p.fn(p.completed)
+
+	return n, err
+}
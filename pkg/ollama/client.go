@@ -0,0 +1,263 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client is a client for the Ollama HTTP API.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// NewClient creates a new Ollama API client targeting the given base URL.
+// If httpClient is nil, http.DefaultClient is used.
+func NewClient(baseURL *url.URL, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: httpClient,
+	}
+}
+
+// BaseURL returns the base URL of the Ollama server.
+func (c *Client) BaseURL() *url.URL {
+	return c.baseURL
+}
+
+// Version returns the version of the Ollama server.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	result := &VersionResponse{}
+
+	err := c.do(ctx, http.MethodGet, "/api/version", nil, result)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Version, nil
+}
+
+// List lists the models available on the Ollama server.
+func (c *Client) List(ctx context.Context) ([]Model, error) {
+	result := &ListResponse{}
+
+	err := c.do(ctx, http.MethodGet, "/api/tags", nil, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Models, nil
+}
+
+// ListRunning lists the models currently loaded in memory on the Ollama server.
+func (c *Client) ListRunning(ctx context.Context) ([]RunningModel, error) {
+	result := &ListRunningResponse{}
+
+	err := c.do(ctx, http.MethodGet, "/api/ps", nil, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Models, nil
+}
+
+// Pull pulls the given model, calling fn for each progress update sent by the server.
+func (c *Client) Pull(ctx context.Context, model string, fn func(ProgressResponse)) error {
+	return c.stream(ctx, http.MethodPost, "/api/pull", &PullRequest{Model: model}, func(data []byte) error {
+		progress := ProgressResponse{}
+
+		err := json.Unmarshal(data, &progress)
+		if err != nil {
+			return fmt.Errorf("failed to decode progress: %w", err)
+		}
+
+		if fn != nil {
+			fn(progress)
+		}
+
+		return nil
+	})
+}
+
+// Delete deletes the given model from the Ollama server.
+func (c *Client) Delete(ctx context.Context, model string) error {
+	return c.do(ctx, http.MethodDelete, "/api/delete", &DeleteRequest{Model: model}, nil)
+}
+
+// Show returns information about the given model.
+func (c *Client) Show(ctx context.Context, model string) (*ShowResponse, error) {
+	result := &ShowResponse{}
+
+	err := c.do(ctx, http.MethodPost, "/api/show", &ShowRequest{Model: model}, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Load loads the given model into memory, so the first request doesn't have to wait for it.
+func (c *Client) Load(ctx context.Context, model string) error {
+	stream := false
+
+	return c.do(ctx, http.MethodPost, "/api/generate", &GenerateRequest{Model: model, Stream: &stream}, nil)
+}
+
+// stream sends a request to the Ollama API and calls fn for each JSON object of the streamed response.
+func (c *Client) stream(ctx context.Context, method, path string, body any, fn func(data []byte) error) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var data json.RawMessage
+
+		err = decoder.Decode(&data)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+
+		errResp := &ErrorResponse{}
+		if json.Unmarshal(data, errResp) == nil && errResp.Error != "" {
+			return &APIError{StatusCode: resp.StatusCode, Message: errResp.Error}
+		}
+
+		err = fn(data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// do sends a request to the Ollama API and decodes the JSON response into result.
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if result == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// send sends a request to the Ollama API and returns the response when its status code is successful.
+// The caller is responsible for closing the response body.
+func (c *Client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		reqBody = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.JoinPath(path).String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		return nil, newAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// APIError is returned when the Ollama API answers with an error status code.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ollama api returned status %d", e.StatusCode)
+	}
+
+	return fmt.Sprintf("ollama api returned status %d: %s", e.StatusCode, e.Message)
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return apiErr
+	}
+
+	errResp := &ErrorResponse{}
+	if json.Unmarshal(content, errResp) == nil && errResp.Error != "" {
+		apiErr.Message = errResp.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(content))
+	}
+
+	return apiErr
+}
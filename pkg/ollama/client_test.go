@@ -0,0 +1,134 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	. "github.com/onsi/gomega"
+)
+
+func newStaticServer(t *testing.T, pattern string, status int, body string) *ollama.Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		_, _ = fmt.Fprint(w, body)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	baseURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ollama.NewClient(baseURL, server.Client())
+}
+
+func TestPull(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		body     string
+		want     []ollama.ProgressResponse
+		errorMsg string
+	}{
+		"successful pull": {
+			status: http.StatusOK,
+			body: `{"status":"pulling manifest"}
+{"status":"pulling 6a0746a1ec1a","digest":"sha256:6a0746a1ec1a","total":100,"completed":50}
+{"status":"success"}
+`,
+			want: []ollama.ProgressResponse{
+				{Status: "pulling manifest"},
+				{Status: "pulling 6a0746a1ec1a", Digest: "sha256:6a0746a1ec1a", Total: 100, Completed: 50},
+				{Status: "success"},
+			},
+		},
+		"error in stream": {
+			status: http.StatusOK,
+			body: `{"status":"pulling manifest"}
+{"error":"pull model manifest: file does not exist"}
+`,
+			want:     []ollama.ProgressResponse{{Status: "pulling manifest"}},
+			errorMsg: "pull model manifest: file does not exist",
+		},
+		"error status": {
+			status:   http.StatusInternalServerError,
+			body:     `{"error":"something went wrong"}`,
+			want:     []ollama.ProgressResponse{},
+			errorMsg: "something went wrong",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			client := newStaticServer(t, "POST /api/pull", tt.status, tt.body)
+
+			got := []ollama.ProgressResponse{}
+			err := client.Pull(t.Context(), "llama3.2", func(resp ollama.ProgressResponse) {
+				got = append(got, resp)
+			})
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestRunningModelProcessor(t *testing.T) {
+	tests := map[string]struct {
+		model  ollama.RunningModel
+		result string
+	}{
+		"fully on gpu": {
+			model:  ollama.RunningModel{Size: 100, SizeVRAM: 100},
+			result: "100% GPU",
+		},
+		"fully on cpu": {
+			model:  ollama.RunningModel{Size: 100, SizeVRAM: 0},
+			result: "100% CPU",
+		},
+		"split": {
+			model:  ollama.RunningModel{Size: 100, SizeVRAM: 75},
+			result: "25%/75% CPU/GPU",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(tt.model.Processor()).To(Equal(tt.result))
+		})
+	}
+}
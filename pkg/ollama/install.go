@@ -0,0 +1,50 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// InstallScriptURL is the URL of the official Ollama install script.
+const InstallScriptURL = "https://ollama.com/install.sh"
+
+var versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.]+)?$`)
+
+// NormalizeVersion validates the given Ollama version and removes its optional "v" prefix.
+// An empty version means the latest version.
+func NormalizeVersion(version string) (string, error) {
+	version = strings.TrimPrefix(version, "v")
+	if version != "" && !versionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid ollama version %q, expected a version such as 0.5.7", version)
+	}
+
+	return version, nil
+}
+
+// InstallCommand returns the shell command installing the given Ollama version using the official install script.
+// The version must have been normalized using NormalizeVersion; when empty, the latest version is installed.
+func InstallCommand(version string) string {
+	if version == "" {
+		return fmt.Sprintf("curl -fsSL %s | sh", InstallScriptURL)
+	}
+
+	return fmt.Sprintf("curl -fsSL %s | OLLAMA_VERSION=%s sh", InstallScriptURL, version)
+}
@@ -0,0 +1,99 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama_test
+
+import (
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	. "github.com/onsi/gomega"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		result   string
+		errorMsg string
+	}{
+		"latest": {
+			input:  "",
+			result: "",
+		},
+		"version": {
+			input:  "0.5.7",
+			result: "0.5.7",
+		},
+		"prefixed version": {
+			input:  "v0.5.7",
+			result: "0.5.7",
+		},
+		"release candidate": {
+			input:  "0.6.0-rc0",
+			result: "0.6.0-rc0",
+		},
+		"shell injection": {
+			input:    "0.5.7; rm -rf /",
+			errorMsg: "invalid ollama version",
+		},
+		"partial version": {
+			input:    "0.5",
+			errorMsg: "invalid ollama version",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, err := ollama.NormalizeVersion(tt.input)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestInstallCommand(t *testing.T) {
+	tests := map[string]struct {
+		version string
+		result  string
+	}{
+		"latest": {
+			version: "",
+			result:  "curl -fsSL https://ollama.com/install.sh | sh",
+		},
+		"pinned": {
+			version: "0.5.7",
+			result:  "curl -fsSL https://ollama.com/install.sh | OLLAMA_VERSION=0.5.7 sh",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(ollama.InstallCommand(tt.version)).To(Equal(tt.result))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const defaultTag = "latest"
+
+// ReadinessOptions configures what CheckReady waits for.
+type ReadinessOptions struct {
+	// Models is the list of models that must be available on the server.
+	Models []string
+	// Loaded requires the models to also be loaded in memory.
+	Loaded bool
+}
+
+// NotReadyError is returned by CheckReady when the server answers but is not ready yet.
+type NotReadyError struct {
+	Reason string
+}
+
+func (e *NotReadyError) Error() string {
+	return e.Reason
+}
+
+// CheckReady checks that the Ollama server answers on its API and that the requested models are ready.
+// It returns the server version when it's ready.
+func (c *Client) CheckReady(ctx context.Context, opts ReadinessOptions) (string, error) {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(opts.Models) == 0 {
+		return version, nil
+	}
+
+	models, err := c.List(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	available := make([]string, 0, len(models))
+	for _, m := range models {
+		available = append(available, m.Name)
+	}
+
+	if missing := missingModels(opts.Models, available); len(missing) > 0 {
+		return "", &NotReadyError{Reason: fmt.Sprintf("models not pulled yet: %s", strings.Join(missing, ", "))}
+	}
+
+	if !opts.Loaded {
+		return version, nil
+	}
+
+	running, err := c.ListRunning(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	loaded := make([]string, 0, len(running))
+	for _, m := range running {
+		loaded = append(loaded, m.Name)
+	}
+
+	if missing := missingModels(opts.Models, loaded); len(missing) > 0 {
+		return "", &NotReadyError{Reason: fmt.Sprintf("models not loaded yet: %s", strings.Join(missing, ", "))}
+	}
+
+	return version, nil
+}
+
+// NormalizeModelName returns the model name with its tag, defaulting to "latest".
+func NormalizeModelName(name string) string {
+	if strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		return name
+	}
+
+	return name + ":" + defaultTag
+}
+
+// missingModels returns the wanted models that are not in the available list.
+func missingModels(wanted, available []string) []string {
+	index := make(map[string]struct{}, len(available))
+	for _, name := range available {
+		index[NormalizeModelName(name)] = struct{}{}
+	}
+
+	missing := []string{}
+	for _, name := range wanted {
+		if _, ok := index[NormalizeModelName(name)]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
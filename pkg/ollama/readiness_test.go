@@ -0,0 +1,157 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
+	. "github.com/onsi/gomega"
+)
+
+func newTestServer(t *testing.T, models []ollama.Model, running []ollama.RunningModel) *ollama.Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/version", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(ollama.VersionResponse{Version: "0.5.7"})
+	})
+	mux.HandleFunc("GET /api/tags", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(ollama.ListResponse{Models: models})
+	})
+	mux.HandleFunc("GET /api/ps", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(ollama.ListRunningResponse{Models: running})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	baseURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ollama.NewClient(baseURL, server.Client())
+}
+
+func TestCheckReady(t *testing.T) {
+	tests := map[string]struct {
+		models   []ollama.Model
+		running  []ollama.RunningModel
+		opts     ollama.ReadinessOptions
+		notReady bool
+	}{
+		"no models requested": {
+			opts: ollama.ReadinessOptions{},
+		},
+		"model pulled": {
+			models: []ollama.Model{{Name: "llama3.2:latest"}},
+			opts:   ollama.ReadinessOptions{Models: []string{"llama3.2"}},
+		},
+		"model not pulled": {
+			models:   []ollama.Model{{Name: "mistral:latest"}},
+			opts:     ollama.ReadinessOptions{Models: []string{"llama3.2"}},
+			notReady: true,
+		},
+		"model pulled with another tag": {
+			models:   []ollama.Model{{Name: "llama3.2:1b"}},
+			opts:     ollama.ReadinessOptions{Models: []string{"llama3.2"}},
+			notReady: true,
+		},
+		"model pulled but not loaded": {
+			models:   []ollama.Model{{Name: "llama3.2:latest"}},
+			opts:     ollama.ReadinessOptions{Models: []string{"llama3.2"}, Loaded: true},
+			notReady: true,
+		},
+		"model pulled and loaded": {
+			models:  []ollama.Model{{Name: "llama3.2:latest"}},
+			running: []ollama.RunningModel{{Name: "llama3.2:latest"}},
+			opts:    ollama.ReadinessOptions{Models: []string{"llama3.2:latest"}, Loaded: true},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			client := newTestServer(t, tt.models, tt.running)
+
+			version, err := client.CheckReady(t.Context(), tt.opts)
+			if tt.notReady {
+				var notReadyErr *ollama.NotReadyError
+				g.Expect(err).To(BeAssignableToTypeOf(notReadyErr))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(version).To(Equal("0.5.7"))
+		})
+	}
+}
+
+func TestCheckReadyUnreachable(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	baseURL, err := url.Parse(server.URL)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	client := ollama.NewClient(baseURL, nil)
+	_, err = client.CheckReady(t.Context(), ollama.ReadinessOptions{})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestNormalizeModelName(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		result string
+	}{
+		"without tag": {
+			input:  "llama3.2",
+			result: "llama3.2:latest",
+		},
+		"with tag": {
+			input:  "llama3.2:1b",
+			result: "llama3.2:1b",
+		},
+		"with namespace": {
+			input:  "library/llama3.2",
+			result: "library/llama3.2:latest",
+		},
+		"with registry port": {
+			input:  "localhost:5000/llama3.2",
+			result: "localhost:5000/llama3.2:latest",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+			g.Expect(ollama.NormalizeModelName(tt.input)).To(Equal(tt.result))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ollama
+
+import (
+	"fmt"
+	"time"
+)
+
+// VersionResponse is the response of the version endpoint.
+type VersionResponse struct {
+	Version string `json:"version"`
+}
+
+// ErrorResponse is the body returned by the API when a request fails.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ModelDetails holds details about a model.
+type ModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`     //nolint:tagliatelle
+	QuantizationLevel string   `json:"quantization_level"` //nolint:tagliatelle
+}
+
+// Model is a model available on the Ollama server.
+type Model struct {
+	Name       string       `json:"name"`
+	Model      string       `json:"model"`
+	ModifiedAt time.Time    `json:"modified_at"` //nolint:tagliatelle
+	Size       int64        `json:"size"`
+	Digest     string       `json:"digest"`
+	Details    ModelDetails `json:"details"`
+}
+
+// ListResponse is the response of the tags endpoint.
+type ListResponse struct {
+	Models []Model `json:"models"`
+}
+
+// RunningModel is a model currently loaded in memory.
+type RunningModel struct {
+	Name      string       `json:"name"`
+	Model     string       `json:"model"`
+	Size      int64        `json:"size"`
+	SizeVRAM  int64        `json:"size_vram"` //nolint:tagliatelle
+	Digest    string       `json:"digest"`
+	ExpiresAt time.Time    `json:"expires_at"` //nolint:tagliatelle
+	Details   ModelDetails `json:"details"`
+}
+
+// ListRunningResponse is the response of the ps endpoint.
+type ListRunningResponse struct {
+	Models []RunningModel `json:"models"`
+}
+
+// PullRequest is the request body of the pull endpoint.
+type PullRequest struct {
+	Model    string `json:"model"`
+	Insecure bool   `json:"insecure,omitempty"`
+}
+
+// ProgressResponse is a progress update streamed by the pull and push endpoints.
+type ProgressResponse struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// GenerateRequest is the request body of the generate endpoint.
+type GenerateRequest struct {
+	Model     string `json:"model"`
+	Prompt    string `json:"prompt,omitempty"`
+	Stream    *bool  `json:"stream,omitempty"`
+	KeepAlive string `json:"keep_alive,omitempty"` //nolint:tagliatelle
+}
+
+// DeleteRequest is the request body of the delete endpoint.
+type DeleteRequest struct {
+	Model string `json:"model"`
+}
+
+// ShowRequest is the request body of the show endpoint.
+type ShowRequest struct {
+	Model string `json:"model"`
+}
+
+// ShowResponse is the response of the show endpoint.
+type ShowResponse struct {
+	License      string         `json:"license,omitempty"`
+	Modelfile    string         `json:"modelfile,omitempty"`
+	Parameters   string         `json:"parameters,omitempty"`
+	Template     string         `json:"template,omitempty"`
+	System       string         `json:"system,omitempty"`
+	Details      ModelDetails   `json:"details"`
+	ModelInfo    map[string]any `json:"model_info,omitempty"` //nolint:tagliatelle
+	Capabilities []string       `json:"capabilities,omitempty"`
+	ModifiedAt   time.Time      `json:"modified_at"` //nolint:tagliatelle
+}
+
+// Processor returns where the model is loaded, in the same format as the ollama CLI.
+func (m RunningModel) Processor() string {
+	switch {
+	case m.SizeVRAM <= 0 || m.Size <= 0:
+		return "100% CPU"
+	case m.SizeVRAM >= m.Size:
+		return "100% GPU"
+	default:
+		gpuPercent := m.SizeVRAM * 100 / m.Size //nolint:mnd
+
+		return fmt.Sprintf("%d%%/%d%% CPU/GPU", 100-gpuPercent, gpuPercent) //nolint:mnd
+	}
+}
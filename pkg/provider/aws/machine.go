@@ -25,7 +25,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/alexandrevilain/ollama-machine/pkg/ollama"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider"
 	"github.com/alexandrevilain/ollama-machine/pkg/ssh"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -36,6 +35,11 @@ import (
 
 var waitInstanceTerminated = 10 * time.Minute
 
+// securityGroupPrefix is the name prefix of the security groups created for machines.
+const securityGroupPrefix = "ollama-machine-"
+
+var _ provider.PortManager = (*MachineManager)(nil)
+
 type MachineManager struct {
 	client *ec2.Client
 }
@@ -48,12 +52,12 @@ func (m *MachineManager) MachineKind() provider.MachineKind {
 	return provider.MachineKindVM
 }
 
-func (m *MachineManager) createSecurityGroup(ctx context.Context, _ *provider.CreateMachineRequest) (string, error) {
-	securityGroupName := fmt.Sprintf("ollama-machine-%s", uuid.New().String()) // Create a unique security group name per machine.
+func (m *MachineManager) createSecurityGroup(ctx context.Context, req *provider.CreateMachineRequest) (string, error) {
+	securityGroupName := securityGroupPrefix + uuid.New().String() // Create a unique security group name per machine.
 
 	createSgInput := &ec2.CreateSecurityGroupInput{
 		GroupName:   aws.String(securityGroupName),
-		Description: aws.String("Security group for SSH and Ollama access"),
+		Description: aws.String("Security group for SSH access and the ports exposed by the machine connectivity"),
 	}
 
 	sgResult, err := m.client.CreateSecurityGroup(ctx, createSgInput)
@@ -73,19 +77,10 @@ func (m *MachineManager) createSecurityGroup(ctx context.Context, _ *provider.Cr
 				},
 			},
 		},
-		// This permission is too permissive and should be created only if the user asks for a public instance.
-		// But we don't have this information in the request for now.
-		{
-			IpProtocol: aws.String("tcp"),
-			FromPort:   aws.Int32(ollama.DefaultPort),
-			ToPort:     aws.Int32(ollama.DefaultPort),
-			IpRanges: []types.IpRange{
-				{
-					CidrIp:      aws.String("0.0.0.0/0"),
-					Description: aws.String("Allow Ollama access"),
-				},
-			},
-		},
+	}
+
+	for _, port := range req.ExposedPorts {
+		ingressRules = append(ingressRules, exposedPortRule(port))
 	}
 
 	authorizeInput := &ec2.AuthorizeSecurityGroupIngressInput{
@@ -101,6 +96,111 @@ func (m *MachineManager) createSecurityGroup(ctx context.Context, _ *provider.Cr
 	return *sgResult.GroupId, nil
 }
 
+// exposedPortRule returns the ingress rule opening the given port to the outside world.
+func exposedPortRule(port provider.Port) types.IpPermission {
+	return types.IpPermission{
+		IpProtocol: aws.String(port.Protocol),
+		FromPort:   aws.Int32(int32(port.Number)), //nolint:gosec
+		ToPort:     aws.Int32(int32(port.Number)), //nolint:gosec
+		IpRanges: []types.IpRange{
+			{
+				CidrIp:      aws.String("0.0.0.0/0"),
+				Description: aws.String(fmt.Sprintf("Allow access to port %d/%s", port.Number, port.Protocol)),
+			},
+		},
+	}
+}
+
+// SetExposedPorts updates the security group of the instance, so only the given ports are opened in addition to SSH.
+func (m *MachineManager) SetExposedPorts(ctx context.Context, id string, ports []provider.Port) error {
+	instance, err := m.client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{id},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe instance: %w", err)
+	}
+
+	if len(instance.Reservations) == 0 || len(instance.Reservations[0].Instances) == 0 {
+		return errors.New("instance not found")
+	}
+
+	for _, sg := range instance.Reservations[0].Instances[0].SecurityGroups {
+		if !strings.HasPrefix(aws.ToString(sg.GroupName), securityGroupPrefix) {
+			continue
+		}
+
+		groups, err := m.client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{
+			GroupIds: []string{aws.ToString(sg.GroupId)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to describe security group: %w", err)
+		}
+
+		if len(groups.SecurityGroups) == 0 {
+			continue
+		}
+
+		revoke, authorize := diffExposedPorts(groups.SecurityGroups[0].IpPermissions, ports)
+
+		if len(revoke) > 0 {
+			_, err = m.client.RevokeSecurityGroupIngress(ctx, &ec2.RevokeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: revoke,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to revoke security group ingress rules: %w", err)
+			}
+		}
+
+		if len(authorize) > 0 {
+			_, err = m.client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+				GroupId:       sg.GroupId,
+				IpPermissions: authorize,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to set security group ingress rules: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// diffExposedPorts returns the ingress rules to revoke and to authorize so only the given ports are opened,
+// in addition to SSH which is always opened.
+func diffExposedPorts(existing []types.IpPermission, ports []provider.Port) ([]types.IpPermission, []types.IpPermission) {
+	wanted := map[provider.Port]bool{
+		{Protocol: "tcp", Number: ssh.DefaultPort}: true,
+	}
+	for _, port := range ports {
+		wanted[port] = true
+	}
+
+	revoke := []types.IpPermission{}
+	opened := map[provider.Port]bool{}
+
+	for _, permission := range existing {
+		port := provider.Port{Protocol: aws.ToString(permission.IpProtocol), Number: int(aws.ToInt32(permission.FromPort))}
+		if wanted[port] && aws.ToInt32(permission.FromPort) == aws.ToInt32(permission.ToPort) {
+			opened[port] = true
+
+			continue
+		}
+
+		revoke = append(revoke, permission)
+	}
+
+	authorize := []types.IpPermission{}
+	for _, port := range ports {
+		if !opened[port] {
+			opened[port] = true
+			authorize = append(authorize, exposedPortRule(port))
+		}
+	}
+
+	return revoke, authorize
+}
+
 func (m *MachineManager) Create(ctx context.Context, req *provider.CreateMachineRequest) (*provider.Machine, error) { //nolint:funlen
 	securityGroupID, err := m.createSecurityGroup(ctx, req)
 	if err != nil {
@@ -167,6 +267,13 @@ func (m *MachineManager) Create(ctx context.Context, req *provider.CreateMachine
 		},
 	}
 
+	for key, value := range req.Tags {
+		input.TagSpecifications[0].Tags = append(input.TagSpecifications[0].Tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		})
+	}
+
 	if req.Zone != "" {
 		input.Placement = &types.Placement{
 			AvailabilityZone: aws.String(req.Zone),
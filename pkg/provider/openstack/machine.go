@@ -68,6 +68,7 @@ func (p *MachineManager) Create(ctx context.Context, machineRequest *provider.Cr
 		FlavorRef: flavorID,
 		ImageRef:  imageID,
 		UserData:  machineRequest.UserData,
+		Metadata:  machineRequest.Tags,
 	}, nil).Extract()
 	if err != nil {
 		return nil, err
@@ -55,6 +55,7 @@ func (m *MachineManager) Create(ctx context.Context, req *provider.CreateMachine
 		return nil, err
 	}
 
+	// Tags are ignored: the OVHcloud instance creation API doesn't support metadata.
 	instance, err := m.client.CreateInstance(ctx, ovhsdk.InstanceCreateOptions{
 		Name:           req.Name,
 		Region:         m.client.Region,
@@ -53,6 +53,13 @@ type MachineManager interface {
 	MachineKind() MachineKind
 }
 
+// PortManager is implemented by machine managers able to change the ports opened on existing machines.
+type PortManager interface {
+	// SetExposedPorts opens the given ports of the machine to the outside world, in addition to SSH,
+	// and closes the other ones.
+	SetExposedPorts(ctx context.Context, id string, ports []Port) error
+}
+
 // Provider represents the interface for a cloud provider.
 type Provider interface {
 	// Credentials returns the credentials for the provider.
@@ -89,6 +96,16 @@ type CreateMachineRequest struct {
 	Tags map[string]string
 	// UserData is the user data to provide to the machine.
 	UserData []byte
+	// ExposedPorts are the ports to open to the outside world, in addition to SSH.
+	ExposedPorts []Port
+}
+
+// Port is a network port.
+type Port struct {
+	// Protocol is the protocol of the port, tcp or udp.
+	Protocol string `json:"protocol"`
+	// Number is the port number.
+	Number int `json:"number"`
 }
 
 // MachineState represents the state of a machine.
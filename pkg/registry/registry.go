@@ -20,11 +20,14 @@ package registry
 import (
 	"os"
 
+	"github.com/alexandrevilain/ollama-machine/pkg/cloudflare"
+	"github.com/alexandrevilain/ollama-machine/pkg/modelcache"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider/aws"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider/noop"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider/openstack"
 	"github.com/alexandrevilain/ollama-machine/pkg/provider/ovhcloud"
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
 )
 
 var Providers = map[string]provider.Provider{ //nolint:gochecknoglobals
@@ -33,6 +36,25 @@ var Providers = map[string]provider.Provider{ //nolint:gochecknoglobals
 	"aws":       aws.NewProvider(),
 }
 
+// ServiceCredentials are the credentials of services which are not cloud providers,
+// stored in the credentials store along with cloud provider credentials.
+var ServiceCredentials = map[string]provider.Credentials{ //nolint:gochecknoglobals
+	modelcache.CredentialsKind: &modelcache.Credentials{},
+	cloudflare.CredentialsKind: &cloudflare.Credentials{},
+	tailscale.CredentialsKind:  &tailscale.Credentials{},
+}
+
+// GetCredentials returns the credentials of the given cloud provider or service.
+func GetCredentials(name string) (provider.Credentials, bool) {
+	if p, ok := Providers[name]; ok {
+		return p.Credentials(), true
+	}
+
+	credentials, ok := ServiceCredentials[name]
+
+	return credentials, ok
+}
+
 func init() {
 	if os.Getenv("OLLAMA_MACHINE_DEV") != "" {
 		Providers["noop"] = noop.NewProvider()
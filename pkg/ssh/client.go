@@ -31,33 +31,38 @@ const (
 
 // NewClient creates a new SSH client and session.
 func NewClient(host, port, user string, k *KeyPairFiles) (*ssh.Client, *ssh.Session, error) {
-	privateKeyFile, err := os.ReadFile(k.PrivateKeyPath)
+	client, err := Dial(host, port, user, k)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed reading private key file: %w", err)
+		return nil, nil, err
 	}
 
-	privateKey, err := ssh.ParsePrivateKey(privateKeyFile)
+	session, err := client.NewSession()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed parsing private key: %w", err)
-	}
+		_ = client.Close()
 
-	sshConfig := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{ssh.PublicKeys(privateKey)},
+		return nil, nil, err
 	}
-	sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey() //nolint:gosec // this should be fixed soon.
 
-	client, err := ssh.Dial("tcp", net.JoinHostPort(host, port), sshConfig)
+	return client, session, nil
+}
+
+// Dial creates a new SSH client connected to the given host.
+func Dial(host, port, user string, k *KeyPairFiles) (*ssh.Client, error) {
+	privateKeyFile, err := os.ReadFile(k.PrivateKeyPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("failed reading private key file: %w", err)
 	}
 
-	session, err := client.NewSession()
+	privateKey, err := ssh.ParsePrivateKey(privateKeyFile)
 	if err != nil {
-		_ = client.Close()
+		return nil, fmt.Errorf("failed parsing private key: %w", err)
+	}
 
-		return nil, nil, err
+	sshConfig := &ssh.ClientConfig{
+		User: user,
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(privateKey)},
 	}
+	sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey() //nolint:gosec // this should be fixed soon.
 
-	return client, session, nil
+	return ssh.Dial("tcp", net.JoinHostPort(host, port), sshConfig)
 }
@@ -0,0 +1,66 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Run runs the given command on the remote host and returns its combined output.
+func Run(client *ssh.Client, cmd string) ([]byte, error) {
+	return RunWithStdin(client, cmd, nil)
+}
+
+// RunWithStdin runs the given command on the remote host, streaming stdin to it,
+// and returns its combined output.
+func RunWithStdin(client *ssh.Client, cmd string, stdin io.Reader) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ssh session: %w", err)
+	}
+
+	defer func() {
+		_ = session.Close()
+	}()
+
+	output := &bytes.Buffer{}
+	session.Stdin = stdin
+	session.Stdout = output
+	session.Stderr = output
+
+	err = session.Run(cmd)
+	if err != nil {
+		return output.Bytes(), fmt.Errorf("command %q failed: %w: %s", cmd, err, strings.TrimSpace(output.String()))
+	}
+
+	return output.Bytes(), nil
+}
+
+// Quote returns a shell-escaped version of the given string.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,88 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tailscale
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// CredentialsKind is the kind under which Tailscale credentials are stored in the credentials store.
+const CredentialsKind = "tailscale"
+
+// Credentials are the credentials of the Tailscale API, or of the API of a custom control server such as Headscale.
+// The Tailscale API can be reached using either an API key or an OAuth client.
+type Credentials struct {
+	APIKey            string `json:"apiKey,omitempty"`
+	OAuthClientID     string `json:"oauthClientId,omitempty"`
+	OAuthClientSecret string `json:"oauthClientSecret,omitempty"`
+
+	apiKeyFromStdin            bool `json:"-"`
+	oauthClientSecretFromStdin bool `json:"-"`
+}
+
+func (c *Credentials) Complete() error {
+	if c.apiKeyFromStdin && c.oauthClientSecretFromStdin {
+		return errors.New("only one of api-key-from-stdin and oauth-client-secret-from-stdin can be set")
+	}
+
+	if c.apiKeyFromStdin || c.oauthClientSecretFromStdin {
+		secretFromStdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		secret := strings.TrimSuffix(string(secretFromStdin), "\n")
+		secret = strings.TrimSuffix(secret, "\r")
+
+		if c.apiKeyFromStdin {
+			c.APIKey = secret
+		} else {
+			c.OAuthClientSecret = secret
+		}
+	}
+
+	return nil
+}
+
+func (c *Credentials) Validate() error {
+	if c.APIKey != "" && c.OAuthClientID != "" {
+		return errors.New("only one of api-key and oauth-client-id can be set")
+	}
+
+	if c.OAuthClientID != "" && c.OAuthClientSecret == "" {
+		return errors.New("oauth-client-secret is required with oauth-client-id")
+	}
+
+	if c.APIKey == "" && c.OAuthClientID == "" {
+		return errors.New("api-key or oauth-client-id is required")
+	}
+
+	return nil
+}
+
+func (c *Credentials) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.APIKey, "api-key", "", "Tailscale (or Headscale) API key")
+	fs.BoolVar(&c.apiKeyFromStdin, "api-key-from-stdin", false, "Read Tailscale (or Headscale) API key from stdin")
+	fs.StringVar(&c.OAuthClientID, "oauth-client-id", "", "Tailscale OAuth client ID")
+	fs.StringVar(&c.OAuthClientSecret, "oauth-client-secret", "", "Tailscale OAuth client secret")
+	fs.BoolVar(&c.oauthClientSecretFromStdin, "oauth-client-secret-from-stdin", false, "Read Tailscale OAuth client secret from stdin")
+}
@@ -0,0 +1,265 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tailscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"tailscale.com/tsnet"
+)
+
+const (
+	// EmbeddedAuthKeyEnv is the environment variable holding the auth key of the embedded node.
+	// Setting it makes the CLI join the tailnet by itself, instead of relying on the local host being on it.
+	EmbeddedAuthKeyEnv = "OLLAMA_MACHINE_TAILSCALE_AUTH_KEY"
+
+	// EmbeddedHostname is the hostname prefix of the embedded nodes in the tailnet, followed by the process ID.
+	EmbeddedHostname = "ollama-machine"
+
+	defaultControlHost = "controlplane.tailscale.com"
+	embeddedUpTimeout  = time.Minute
+)
+
+//nolint:gochecknoglobals
+var (
+	embeddedNodesMu sync.Mutex
+	embeddedNodes   = map[string]*EmbeddedNode{}
+)
+
+// EmbeddedNode is an ephemeral node joining the tailnet from inside the process, using a userspace network stack.
+// It is started on the first dial, and started again by the next dial when starting it failed.
+type EmbeddedNode struct {
+	stateDir    string
+	loginServer string
+	authKey     string
+
+	mu     sync.Mutex
+	server *tsnet.Server
+	// starting is closed once the start in progress, if any, completes.
+	starting chan struct{}
+	startErr error
+	closed   bool
+}
+
+// EmbeddedAuthKey returns the auth key of the embedded node, and whether it is set.
+func EmbeddedAuthKey() (string, bool) {
+	authKey := os.Getenv(EmbeddedAuthKeyEnv)
+
+	return authKey, authKey != ""
+}
+
+// EmbeddedStateDir returns the directory storing the state of the embedded nodes for the given control server,
+// so nodes of different tailnets don't share their state. Each node stores its state in its own subdirectory.
+func EmbeddedStateDir(baseDir, loginServer string) string {
+	host := defaultControlHost
+
+	if loginServer != "" {
+		u, err := url.Parse(loginServer)
+		if err == nil && u.Host != "" {
+			host = u.Host
+		}
+	}
+
+	return filepath.Join(baseDir, host)
+}
+
+// SharedEmbeddedNode returns the embedded node of the process registering to the given control server,
+// creating it on the first call, so commands reaching several times the tailnet join it once.
+// Nodes are closed by CloseEmbeddedNodes, once the command ends.
+func SharedEmbeddedNode(baseDir, loginServer, authKey string) *EmbeddedNode {
+	embeddedNodesMu.Lock()
+	defer embeddedNodesMu.Unlock()
+
+	stateDir := EmbeddedStateDir(baseDir, loginServer)
+
+	node, ok := embeddedNodes[stateDir]
+	if !ok {
+		node = NewEmbeddedNode(baseDir, loginServer, authKey)
+		embeddedNodes[stateDir] = node
+	}
+
+	return node
+}
+
+// CloseEmbeddedNodes closes the embedded nodes of the process.
+func CloseEmbeddedNodes() error {
+	embeddedNodesMu.Lock()
+	defer embeddedNodesMu.Unlock()
+
+	var errs []error
+	for stateDir, node := range embeddedNodes {
+		errs = append(errs, node.Close())
+		delete(embeddedNodes, stateDir)
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewEmbeddedNode returns an embedded node registering to the given control server, the Tailscale one when empty.
+// The node is named after the process, and its state is stored in a directory of its own, removed when it is closed,
+// so nodes of concurrent processes don't share their identity.
+func NewEmbeddedNode(baseDir, loginServer, authKey string) *EmbeddedNode {
+	return &EmbeddedNode{
+		stateDir:    EmbeddedStateDir(baseDir, loginServer),
+		loginServer: loginServer,
+		authKey:     authKey,
+	}
+}
+
+// Dial connects to the given address of the tailnet, joining it first if needed.
+func (n *EmbeddedNode) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	server, err := n.up(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return server.Dial(ctx, network, address)
+}
+
+// Close leaves the tailnet and removes the state of the node. The node can't be started anymore.
+func (n *EmbeddedNode) Close() error {
+	n.mu.Lock()
+	n.closed = true
+	starting := n.starting
+	n.mu.Unlock()
+
+	if starting != nil {
+		<-starting
+	}
+
+	n.mu.Lock()
+	server := n.server
+	n.server = nil
+	n.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	return errors.Join(server.Close(), os.RemoveAll(server.Dir))
+}
+
+// up returns the running server of the node, starting it if needed.
+// The start outlives the dial requesting it, so a canceled dial doesn't fail the next ones.
+func (n *EmbeddedNode) up(ctx context.Context) (*tsnet.Server, error) {
+	n.mu.Lock()
+
+	if n.closed {
+		n.mu.Unlock()
+
+		return nil, fmt.Errorf("embedded Tailscale node: %w", net.ErrClosed)
+	}
+
+	if n.server != nil {
+		server := n.server
+		n.mu.Unlock()
+
+		return server, nil
+	}
+
+	if n.starting == nil {
+		n.starting = make(chan struct{})
+
+		go n.start(n.starting)
+	}
+
+	starting := n.starting
+	n.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-starting:
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.server == nil {
+		return nil, n.startErr
+	}
+
+	return n.server, nil
+}
+
+// start joins the tailnet, records the running server or the error, and closes the given channel.
+func (n *EmbeddedNode) start(starting chan struct{}) {
+	server, err := n.startServer()
+
+	n.mu.Lock()
+	n.server = server
+	n.startErr = err
+	n.starting = nil
+	n.mu.Unlock()
+
+	close(starting)
+}
+
+// startServer joins the tailnet with a new server and waits for it to be running.
+// The server is closed, and its state removed, when it fails to start.
+func (n *EmbeddedNode) startServer() (*tsnet.Server, error) {
+	err := os.MkdirAll(n.stateDir, 0o700) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded Tailscale node state directory: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(n.stateDir, "node-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded Tailscale node state directory: %w", err)
+	}
+
+	server := &tsnet.Server{
+		Dir:        dir,
+		Hostname:   EmbeddedHostname + "-" + strconv.Itoa(os.Getpid()),
+		AuthKey:    n.authKey,
+		ControlURL: n.loginServer,
+		Ephemeral:  true,
+		UserLogf:   func(string, ...any) {},
+		Logf:       func(string, ...any) {},
+	}
+
+	// Servers failing to start can't be closed.
+	err = server.Start()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+
+		return nil, fmt.Errorf("failed to start the embedded Tailscale node: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), embeddedUpTimeout)
+	defer cancel()
+
+	_, err = server.Up(ctx)
+	if err != nil {
+		_ = server.Close()
+		_ = os.RemoveAll(dir)
+
+		return nil, fmt.Errorf("failed to join the tailnet with the embedded Tailscale node: %w", err)
+	}
+
+	return server, nil
+}
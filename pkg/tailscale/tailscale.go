@@ -0,0 +1,270 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package tailscale manages nodes of a tailnet, through the Tailscale API or the API of a Headscale control server.
+package tailscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIURL is the URL of the Tailscale API.
+const APIURL = "https://api.tailscale.com/api/v2"
+
+// Client is a client of the Tailscale API, or of the API of a Headscale control server.
+type Client struct {
+	// BaseURL is the URL of the API.
+	BaseURL    string
+	HTTPClient *http.Client
+
+	headscale   bool
+	credentials *Credentials
+	accessToken string
+}
+
+// ErrTagsRequired is returned when minting an auth key with an OAuth client without tags.
+var ErrTagsRequired = errors.New("tags are required to create auth keys with an OAuth client")
+
+// AuthKeyOptions are the options of an auth key.
+type AuthKeyOptions struct {
+	// Description describes the key in the admin console.
+	Description string
+	// Tags are the tags of the nodes registered using the key.
+	Tags []string
+	// Reusable allows the key to register several nodes.
+	Reusable bool
+	// Ephemeral registers nodes as ephemeral nodes, removed from the tailnet once offline.
+	Ephemeral bool
+	// Preauthorized registers nodes without requiring an approval.
+	Preauthorized bool
+	// Expiry is the lifetime of the key.
+	Expiry time.Duration
+}
+
+// NewClient returns a new client for the given control server, the Tailscale one when loginServer is empty.
+// Custom control servers are expected to expose the Headscale API.
+func NewClient(loginServer string, credentials *Credentials) *Client {
+	client := &Client{
+		BaseURL:     APIURL,
+		HTTPClient:  http.DefaultClient,
+		credentials: credentials,
+	}
+
+	if loginServer != "" {
+		client.BaseURL = strings.TrimSuffix(loginServer, "/") + "/api/v1"
+		client.headscale = true
+	}
+
+	return client
+}
+
+// DeleteNode removes the given node from the tailnet.
+// Nodes which don't exist anymore, such as ephemeral nodes already removed by the control server, are ignored.
+func (c *Client) DeleteNode(ctx context.Context, nodeID string) error {
+	endpoint := c.BaseURL + "/device/" + url.PathEscape(nodeID)
+	if c.headscale {
+		endpoint = c.BaseURL + "/node/" + url.PathEscape(nodeID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	err = c.authorize(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete node: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) //nolint:mnd
+
+	return fmt.Errorf("failed to delete node: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+}
+
+// CreateAuthKey creates an auth key registering nodes in the tailnet, and returns it.
+// It is only supported by the Tailscale control server.
+func (c *Client) CreateAuthKey(ctx context.Context, opts AuthKeyOptions) (string, error) {
+	if c.headscale {
+		return "", errors.New("creating auth keys is only supported with the Tailscale control server")
+	}
+
+	if c.credentials.OAuthClientID != "" && len(opts.Tags) == 0 {
+		return "", ErrTagsRequired
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"description":   opts.Description,
+		"expirySeconds": int(opts.Expiry.Seconds()),
+		"capabilities": map[string]any{
+			"devices": map[string]any{
+				"create": map[string]any{
+					"reusable":      opts.Reusable,
+					"ephemeral":     opts.Ephemeral,
+					"preauthorized": opts.Preauthorized,
+					"tags":          opts.Tags,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal auth key: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/tailnet/-/keys", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.authorize(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	result := struct {
+		Key string `json:"key"`
+	}{}
+
+	err = c.doJSON(req, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to create auth key: %w", err)
+	}
+
+	return result.Key, nil
+}
+
+// authorize sets the credentials of the request, exchanging the OAuth client credentials for an access token if needed.
+func (c *Client) authorize(ctx context.Context, req *http.Request) error {
+	if c.credentials.OAuthClientID == "" {
+		req.Header.Set("Authorization", "Bearer "+c.credentials.APIKey)
+
+		return nil
+	}
+
+	if c.accessToken == "" {
+		form := url.Values{
+			"client_id":     []string{c.credentials.OAuthClientID},
+			"client_secret": []string{c.credentials.OAuthClientSecret},
+		}
+
+		tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/oauth/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		result := struct {
+			AccessToken string `json:"access_token"` //nolint:tagliatelle
+		}{}
+
+		err = c.doJSON(tokenReq, &result)
+		if err != nil {
+			return fmt.Errorf("failed to get OAuth access token: %w", err)
+		}
+
+		c.accessToken = result.AccessToken
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	return nil
+}
+
+// doJSON sends the request and decodes the JSON response into result.
+func (c *Client) doJSON(req *http.Request, result any) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) //nolint:mnd
+
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// Node is the identity of a machine in the tailnet.
+type Node struct {
+	ID string
+	IP string
+}
+
+// ParseStatus returns the node of the machine from the output of `tailscale status --json`.
+func ParseStatus(output []byte) (*Node, error) {
+	status := struct {
+		BackendState string
+		Self         *struct {
+			ID           string
+			TailscaleIPs []string
+		}
+	}{}
+
+	err := json.Unmarshal(output, &status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Tailscale status: %w", err)
+	}
+
+	if status.Self == nil || status.BackendState != "Running" {
+		return nil, fmt.Errorf("tailscale isn't running yet, its state is %q", status.BackendState)
+	}
+
+	for _, ip := range status.Self.TailscaleIPs {
+		addr, err := netip.ParseAddr(ip)
+		if err == nil && addr.Is4() {
+			return &Node{ID: status.Self.ID, IP: ip}, nil
+		}
+	}
+
+	return nil, errors.New("node has no Tailscale IPv4 address")
+}
@@ -0,0 +1,299 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tailscale_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/tailscale"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := map[string]struct {
+		output   string
+		result   *tailscale.Node
+		errorMsg string
+	}{
+		"running node": {
+			output: `{"BackendState": "Running", "Self": {"ID": "nXXXXXCNTRL", "TailscaleIPs": ["fd7a:115c:a1e0::1", "100.64.0.1"]}}`,
+			result: &tailscale.Node{ID: "nXXXXXCNTRL", IP: "100.64.0.1"},
+		},
+		"node needing login": {
+			output:   `{"BackendState": "NeedsLogin", "Self": {"ID": "", "TailscaleIPs": null}}`,
+			errorMsg: `its state is "NeedsLogin"`,
+		},
+		"node without ipv4": {
+			output:   `{"BackendState": "Running", "Self": {"ID": "1", "TailscaleIPs": ["fd7a:115c:a1e0::1"]}}`,
+			errorMsg: "no Tailscale IPv4 address",
+		},
+		"invalid output": {
+			output:   `failed to connect to local tailscaled`,
+			errorMsg: "failed to parse Tailscale status",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			result, err := tailscale.ParseStatus([]byte(tt.output))
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	tests := map[string]struct {
+		loginServer bool
+		statusCode  int
+		path        string
+		errorMsg    string
+	}{
+		"tailscale": {
+			statusCode: http.StatusOK,
+			path:       "/device/nXXXXXCNTRL",
+		},
+		"headscale": {
+			loginServer: true,
+			statusCode:  http.StatusOK,
+			path:        "/api/v1/node/nXXXXXCNTRL",
+		},
+		"already removed node": {
+			statusCode: http.StatusNotFound,
+			path:       "/device/nXXXXXCNTRL",
+		},
+		"unauthorized": {
+			statusCode: http.StatusUnauthorized,
+			path:       "/device/nXXXXXCNTRL",
+			errorMsg:   "unexpected status 401 Unauthorized",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			var method, path, authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, path, authorization = r.Method, r.URL.Path, r.Header.Get("Authorization")
+				w.WriteHeader(tt.statusCode)
+			}))
+			t.Cleanup(server.Close)
+
+			credentials := &tailscale.Credentials{APIKey: "secret"}
+
+			var client *tailscale.Client
+			if tt.loginServer {
+				client = tailscale.NewClient(server.URL+"/", credentials)
+			} else {
+				client = tailscale.NewClient("", credentials)
+				client.BaseURL = server.URL
+			}
+
+			err := client.DeleteNode(t.Context(), "nXXXXXCNTRL")
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+
+			g.Expect(method).To(Equal(http.MethodDelete))
+			g.Expect(path).To(Equal(tt.path))
+			g.Expect(authorization).To(Equal("Bearer secret"))
+		})
+	}
+}
+
+func TestCreateAuthKey(t *testing.T) {
+	tests := map[string]struct {
+		credentials   *tailscale.Credentials
+		loginServer   bool
+		tags          []string
+		authorization string
+		errorMsg      string
+	}{
+		"api key": {
+			credentials:   &tailscale.Credentials{APIKey: "secret"},
+			authorization: "Bearer secret",
+		},
+		"oauth client": {
+			credentials:   &tailscale.Credentials{OAuthClientID: "client", OAuthClientSecret: "secret"},
+			tags:          []string{"tag:ollama"},
+			authorization: "Bearer access-token",
+		},
+		"oauth client without tags": {
+			credentials: &tailscale.Credentials{OAuthClientID: "client", OAuthClientSecret: "secret"},
+			errorMsg:    "tags are required",
+		},
+		"headscale": {
+			credentials: &tailscale.Credentials{APIKey: "secret"},
+			loginServer: true,
+			errorMsg:    "only supported with the Tailscale control server",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			var authorization string
+			var body map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/oauth/token":
+					g.Expect(r.ParseForm()).To(Succeed())
+					g.Expect(r.PostForm.Get("client_id")).To(Equal("client"))
+					g.Expect(r.PostForm.Get("client_secret")).To(Equal("secret"))
+					_, _ = w.Write([]byte(`{"access_token": "access-token", "token_type": "Bearer"}`))
+				case "/tailnet/-/keys":
+					authorization = r.Header.Get("Authorization")
+					g.Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					_, _ = w.Write([]byte(`{"id": "k123", "key": "tskey-auth-k123"}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			t.Cleanup(server.Close)
+
+			var client *tailscale.Client
+			if tt.loginServer {
+				client = tailscale.NewClient(server.URL, tt.credentials)
+			} else {
+				client = tailscale.NewClient("", tt.credentials)
+				client.BaseURL = server.URL
+			}
+
+			key, err := client.CreateAuthKey(t.Context(), tailscale.AuthKeyOptions{
+				Description:   "ollama-machine test",
+				Tags:          tt.tags,
+				Ephemeral:     true,
+				Preauthorized: true,
+				Expiry:        30 * time.Minute,
+			})
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(key).To(Equal("tskey-auth-k123"))
+			g.Expect(authorization).To(Equal(tt.authorization))
+			g.Expect(body).To(HaveKeyWithValue("expirySeconds", BeNumerically("==", 1800)))
+			g.Expect(body).To(HaveKeyWithValue("description", "ollama-machine test"))
+
+			create := body["capabilities"].(map[string]any)["devices"].(map[string]any)["create"].(map[string]any)
+			g.Expect(create).To(HaveKeyWithValue("reusable", false))
+			g.Expect(create).To(HaveKeyWithValue("ephemeral", true))
+			g.Expect(create).To(HaveKeyWithValue("preauthorized", true))
+		})
+	}
+}
+
+func TestCredentialsValidate(t *testing.T) {
+	tests := map[string]struct {
+		credentials *tailscale.Credentials
+		errorMsg    string
+	}{
+		"api key": {
+			credentials: &tailscale.Credentials{APIKey: "secret"},
+		},
+		"oauth client": {
+			credentials: &tailscale.Credentials{OAuthClientID: "client", OAuthClientSecret: "secret"},
+		},
+		"oauth client without secret": {
+			credentials: &tailscale.Credentials{OAuthClientID: "client"},
+			errorMsg:    "secret",
+		},
+		"api key and oauth client": {
+			credentials: &tailscale.Credentials{APIKey: "secret", OAuthClientID: "client", OAuthClientSecret: "secret"},
+			errorMsg:    "only one of",
+		},
+		"empty": {
+			credentials: &tailscale.Credentials{},
+			errorMsg:    "required",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			err := tt.credentials.Validate()
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestEmbeddedStateDir(t *testing.T) {
+	tests := map[string]struct {
+		loginServer string
+		result      string
+	}{
+		"tailscale": {
+			result: "/config/tailscale/controlplane.tailscale.com",
+		},
+		"headscale": {
+			loginServer: "https://headscale.example.com:8443",
+			result:      "/config/tailscale/headscale.example.com:8443",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			g.Expect(tailscale.EmbeddedStateDir("/config/tailscale", tt.loginServer)).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestSharedEmbeddedNode(t *testing.T) {
+	g := NewWithT(t)
+
+	baseDir := t.TempDir()
+
+	node := tailscale.SharedEmbeddedNode(baseDir, "", "tskey-abcdef")
+	g.Expect(tailscale.SharedEmbeddedNode(baseDir, "", "tskey-abcdef")).To(BeIdenticalTo(node))
+	g.Expect(tailscale.SharedEmbeddedNode(baseDir, "https://headscale.example.com", "abcdef")).NotTo(BeIdenticalTo(node))
+
+	g.Expect(tailscale.CloseEmbeddedNodes()).To(Succeed())
+	g.Expect(tailscale.SharedEmbeddedNode(baseDir, "", "tskey-abcdef")).NotTo(BeIdenticalTo(node))
+	g.Expect(tailscale.CloseEmbeddedNodes()).To(Succeed())
+}
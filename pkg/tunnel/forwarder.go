@@ -0,0 +1,445 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// DefaultMinBackoff is the default delay before the first reconnection attempt.
+	DefaultMinBackoff = time.Second
+	// DefaultMaxBackoff is the default maximum delay between reconnection attempts.
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultShutdownTimeout is the default time given to open connections to complete on shutdown.
+	DefaultShutdownTimeout = 5 * time.Second
+)
+
+// Dialer dials addresses of the machine network.
+type Dialer interface {
+	// DialContext dials the given address.
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	// Done returns a channel closed once the dialer can't dial anymore, and must be replaced.
+	// A nil channel means the dialer reconnects by itself.
+	Done() <-chan struct{}
+	// Close releases the dialer.
+	Close() error
+}
+
+// ConnectFunc returns a new dialer reaching the machine network.
+type ConnectFunc func(ctx context.Context) (Dialer, error)
+
+// Stats holds the connection counters of a forwarder.
+type Stats struct {
+	// Active is the number of connections being forwarded.
+	Active int64
+	// Total is the number of accepted connections.
+	Total int64
+	// Failed is the number of connections which couldn't reach the remote address.
+	Failed int64
+	// Reconnects is the number of times the dialer was replaced after being lost.
+	Reconnects int64
+}
+
+// Forwarder forwards connections accepted on a local listener to a remote address of the machine network.
+// The dialer is replaced, with an exponential backoff, when it is lost.
+// A connection failing only affects itself.
+type Forwarder struct {
+	// RemoteAddr is the address connections are forwarded to.
+	RemoteAddr string
+	// Connect returns a new dialer reaching the machine network.
+	Connect ConnectFunc
+	// MinBackoff is the delay before the first reconnection attempt, DefaultMinBackoff when zero.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between reconnection attempts, DefaultMaxBackoff when zero.
+	MaxBackoff time.Duration
+	// ShutdownTimeout is the time given to open connections to complete on shutdown, DefaultShutdownTimeout when zero.
+	ShutdownTimeout time.Duration
+
+	mu     sync.Mutex
+	dialer Dialer
+	// reconnecting is closed once the reconnection in progress, if any, completes.
+	reconnecting chan struct{}
+	conns        map[net.Conn]struct{}
+	cancelConns  context.CancelFunc
+	wg           sync.WaitGroup
+
+	active     atomic.Int64
+	total      atomic.Int64
+	failed     atomic.Int64
+	reconnects atomic.Int64
+}
+
+// Stats returns the connection counters of the forwarder.
+func (f *Forwarder) Stats() Stats {
+	return Stats{
+		Active:     f.active.Load(),
+		Total:      f.total.Load(),
+		Failed:     f.failed.Load(),
+		Reconnects: f.reconnects.Load(),
+	}
+}
+
+// Open connects to the machine network, without retrying on failure.
+func (f *Forwarder) Open(ctx context.Context) error {
+	dialer, err := f.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the machine: %w", err)
+	}
+
+	f.mu.Lock()
+	f.dialer = dialer
+	f.mu.Unlock()
+
+	return nil
+}
+
+// Serve forwards connections accepted on the listener until the context is done, connecting to the machine network first if Open wasn't called.
+// It then closes the listener, and waits for open connections to complete for the shutdown timeout before closing them.
+// It returns an error when the first connection to the machine network fails, or when accepting a connection fails.
+func (f *Forwarder) Serve(ctx context.Context, listener net.Listener) error {
+	f.mu.Lock()
+	opened := f.dialer != nil
+	f.mu.Unlock()
+
+	if !opened {
+		if err := f.Open(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Open connections outlive the context, until the shutdown timeout expires.
+	connCtx, cancelConns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelConns()
+
+	f.mu.Lock()
+	f.conns = map[net.Conn]struct{}{}
+	f.cancelConns = cancelConns
+	f.mu.Unlock()
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Error("failed to close connection to the machine", "err", err)
+		}
+	}()
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+	})
+	defer stop()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			f.shutdown()
+
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		f.wg.Add(1)
+
+		go func() {
+			defer f.wg.Done()
+
+			f.handle(connCtx, conn)
+		}()
+	}
+
+	f.shutdown()
+
+	return nil
+}
+
+// handle forwards the given connection to the remote address.
+func (f *Forwarder) handle(ctx context.Context, localConn net.Conn) {
+	f.total.Add(1)
+	f.active.Add(1)
+
+	defer f.active.Add(-1)
+
+	if !f.track(localConn) {
+		_ = localConn.Close()
+
+		return
+	}
+	defer f.untrack(localConn)
+
+	remoteConn, err := f.dial(ctx)
+	if err != nil {
+		f.failed.Add(1)
+		log.Error("failed to dial remote address", "addr", f.RemoteAddr, "err", err)
+
+		return
+	}
+
+	if !f.track(remoteConn) {
+		_ = remoteConn.Close()
+
+		return
+	}
+	defer f.untrack(remoteConn)
+
+	var wg sync.WaitGroup
+
+	wg.Add(2) //nolint:mnd
+
+	go func() {
+		defer wg.Done()
+
+		pipe(remoteConn, localConn, "local to remote")
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		pipe(localConn, remoteConn, "remote to local")
+	}()
+
+	wg.Wait()
+}
+
+// dial dials the remote address, retrying once with a new dialer when the current one is lost.
+func (f *Forwarder) dial(ctx context.Context) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		dialer, err := f.currentDialer(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := dialer.DialContext(ctx, "tcp", f.RemoteAddr)
+		if err == nil {
+			return conn, nil
+		}
+
+		if attempt > 0 || !isDone(dialer) {
+			return nil, err
+		}
+	}
+}
+
+// currentDialer returns the current dialer, replacing it when it is lost.
+// A single connection replaces it, others wait for the reconnection to complete.
+func (f *Forwarder) currentDialer(ctx context.Context) (Dialer, error) {
+	for {
+		f.mu.Lock()
+
+		if f.dialer != nil && !isDone(f.dialer) {
+			dialer := f.dialer
+			f.mu.Unlock()
+
+			return dialer, nil
+		}
+
+		if f.reconnecting != nil {
+			reconnecting := f.reconnecting
+			f.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("failed to reconnect to the machine: %w", ctx.Err())
+			case <-reconnecting:
+			}
+
+			continue
+		}
+
+		lost := f.dialer
+		f.dialer = nil
+
+		reconnecting := make(chan struct{})
+		f.reconnecting = reconnecting
+		f.mu.Unlock()
+
+		dialer, err := f.reconnect(ctx, lost)
+
+		f.mu.Lock()
+		f.dialer = dialer
+		f.reconnecting = nil
+		f.mu.Unlock()
+
+		close(reconnecting)
+
+		return dialer, err
+	}
+}
+
+// reconnect closes the lost dialer and returns a new one, retrying with an exponential backoff until the context is done.
+func (f *Forwarder) reconnect(ctx context.Context, lost Dialer) (Dialer, error) {
+	if lost != nil {
+		log.Warn("Connection to the machine lost, reconnecting")
+
+		_ = lost.Close()
+	}
+
+	backoff := f.minBackoff()
+
+	for {
+		dialer, err := f.Connect(ctx)
+		if err == nil {
+			f.reconnects.Add(1)
+
+			log.Info("Reconnected to the machine")
+
+			return dialer, nil
+		}
+
+		log.Warn("failed to reconnect to the machine", "err", err, "retryIn", backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to reconnect to the machine: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, f.maxBackoff()) //nolint:mnd
+	}
+}
+
+// shutdown waits for open connections to complete for the shutdown timeout, then closes them.
+func (f *Forwarder) shutdown() {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	timeout := f.ShutdownTimeout
+	if timeout == 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+
+	f.cancelConns()
+
+	f.mu.Lock()
+	for conn := range f.conns {
+		_ = conn.Close()
+	}
+	f.conns = nil
+	f.mu.Unlock()
+
+	<-done
+}
+
+// track records an open connection, so it can be closed on shutdown.
+// It returns false once connections have been closed by the shutdown.
+func (f *Forwarder) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conns == nil {
+		return false
+	}
+
+	f.conns[conn] = struct{}{}
+
+	return true
+}
+
+// untrack closes a connection and forgets it.
+func (f *Forwarder) untrack(conn net.Conn) {
+	_ = conn.Close()
+
+	f.mu.Lock()
+	delete(f.conns, conn)
+	f.mu.Unlock()
+}
+
+// Close closes the connection to the machine network, Serve closes it before returning.
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.dialer == nil {
+		return nil
+	}
+
+	err := f.dialer.Close()
+	f.dialer = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to close connection to the machine: %w", err)
+	}
+
+	return nil
+}
+
+func (f *Forwarder) minBackoff() time.Duration {
+	if f.MinBackoff == 0 {
+		return DefaultMinBackoff
+	}
+
+	return f.MinBackoff
+}
+
+func (f *Forwarder) maxBackoff() time.Duration {
+	if f.MaxBackoff == 0 {
+		return DefaultMaxBackoff
+	}
+
+	return f.MaxBackoff
+}
+
+// closeWriter is implemented by connections supporting half-close.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies src to dst, then closes the write side of dst, or dst when it doesn't support half-close.
+func pipe(dst, src net.Conn, direction string) {
+	_, err := io.Copy(dst, src)
+	if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, io.EOF) {
+		log.Debug("data forward failed", "direction", direction, "err", err)
+	}
+
+	if cw, ok := dst.(closeWriter); ok {
+		if cw.CloseWrite() == nil {
+			return
+		}
+	}
+
+	_ = dst.Close()
+}
+
+// isDone returns true if the dialer is lost.
+func isDone(dialer Dialer) bool {
+	select {
+	case <-dialer.Done():
+		return true
+	default:
+		return false
+	}
+}
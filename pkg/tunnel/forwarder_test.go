@@ -0,0 +1,445 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tunnel_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/tunnel"
+	. "github.com/onsi/gomega"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sshServer is an in-process SSH server forwarding direct-tcpip channels, as sshd does.
+type sshServer struct {
+	listener net.Listener
+	config   *gossh.ServerConfig
+
+	mu    sync.Mutex
+	conns []*gossh.ServerConn
+}
+
+func newSSHServer(t *testing.T) *sshServer {
+	t.Helper()
+
+	g := NewWithT(t)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	signer, err := gossh.NewSignerFromKey(privateKey)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	config := &gossh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	s := &sshServer{listener: listener, config: config}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.dropConnections()
+	})
+
+	go s.serve()
+
+	return s
+}
+
+func (s *sshServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *sshServer) handle(conn net.Conn) {
+	serverConn, channels, requests, err := gossh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.conns = append(s.conns, serverConn)
+	s.mu.Unlock()
+
+	go gossh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			_ = newChannel.Reject(gossh.UnknownChannelType, "unsupported channel type")
+
+			continue
+		}
+
+		go forwardChannel(newChannel)
+	}
+}
+
+// dropConnections closes all SSH connections, as when the network of the machine is lost.
+func (s *sshServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+
+	s.conns = nil
+}
+
+func forwardChannel(newChannel gossh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+
+	if err := gossh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, "invalid payload")
+
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		_ = newChannel.Reject(gossh.ConnectionFailed, err.Error())
+
+		return
+	}
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = conn.Close()
+
+		return
+	}
+
+	go gossh.DiscardRequests(requests)
+
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		_ = channel.Close()
+	}()
+
+	_, _ = io.Copy(conn, channel)
+	_ = conn.Close()
+}
+
+// newEchoServer returns the address of a server echoing lines.
+func newEchoServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	NewWithT(t).Expect(err).NotTo(HaveOccurred())
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// closedAddr returns an address nothing listens on, as when Ollama is down.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	g := NewWithT(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(listener.Close()).To(Succeed())
+
+	return listener.Addr().String()
+}
+
+// connectSSH returns a function connecting to the SSH server.
+func connectSSH(server *sshServer) tunnel.ConnectFunc {
+	return func(_ context.Context) (tunnel.Dialer, error) {
+		client, err := gossh.Dial("tcp", server.listener.Addr().String(), &gossh.ClientConfig{
+			User:            "ollama-machine",
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), //nolint:gosec
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return tunnel.NewSSHDialer(client, 100*time.Millisecond), nil
+	}
+}
+
+// startForwarder serves a forwarder to the given remote address through the SSH server,
+// and returns its listening address.
+func startForwarder(t *testing.T, server *sshServer, remoteAddr string) (*tunnel.Forwarder, string, context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	forwarder := &tunnel.Forwarder{
+		RemoteAddr:      remoteAddr,
+		Connect:         connectSSH(server),
+		MinBackoff:      10 * time.Millisecond,
+		MaxBackoff:      100 * time.Millisecond,
+		ShutdownTimeout: time.Second,
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	NewWithT(t).Expect(err).NotTo(HaveOccurred())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- forwarder.Serve(ctx, listener)
+	}()
+
+	return forwarder, listener.Addr().String(), cancel, served
+}
+
+// echo sends a line through the tunnel and returns the echoed line.
+func echo(addr, line string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, line+"\n"); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return reply[:len(reply)-1], nil
+}
+
+func TestForwarder(t *testing.T) {
+	tests := map[string]struct {
+		remoteDown      bool
+		dropConnections bool
+		connections     int
+		failed          int64
+		reconnects      int64
+	}{
+		"forwards connections": {
+			connections: 3,
+		},
+		"reconnects once the SSH connection is lost": {
+			dropConnections: true,
+			connections:     1,
+			reconnects:      1,
+		},
+		"reconnects once for concurrent connections": {
+			dropConnections: true,
+			connections:     5,
+			reconnects:      1,
+		},
+		"failed connections only affect themselves": {
+			remoteDown:  true,
+			connections: 3,
+			failed:      3,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			remoteAddr := newEchoServer(t)
+			if tt.remoteDown {
+				remoteAddr = closedAddr(t)
+			}
+
+			server := newSSHServer(t)
+			forwarder, addr, cancel, served := startForwarder(t, server, remoteAddr)
+
+			total := int64(tt.connections)
+
+			if tt.dropConnections {
+				// A connection is forwarded first, so the SSH connection is established before being lost.
+				g.Expect(echo(addr, "before")).To(Equal("before"))
+				server.dropConnections()
+
+				total++
+			}
+
+			var wg sync.WaitGroup
+			for i := range tt.connections {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					line := "hello " + strconv.Itoa(i)
+					reply, err := echo(addr, line)
+					if tt.remoteDown {
+						g.Expect(err).To(HaveOccurred())
+					} else {
+						g.Expect(err).NotTo(HaveOccurred())
+						g.Expect(reply).To(Equal(line))
+					}
+				}()
+			}
+			wg.Wait()
+
+			g.Eventually(func() int64 { return forwarder.Stats().Failed }).Should(Equal(tt.failed))
+
+			cancel()
+			g.Eventually(served).Should(Receive(BeNil()))
+
+			_, err := net.Dial("tcp", addr)
+			g.Expect(err).To(HaveOccurred())
+
+			g.Expect(forwarder.Stats()).To(Equal(tunnel.Stats{
+				Total:      total,
+				Failed:     tt.failed,
+				Reconnects: tt.reconnects,
+			}))
+		})
+	}
+}
+
+func TestForwarderShutdown(t *testing.T) {
+	tests := map[string]struct {
+		reply bool
+	}{
+		"open connection completes": {
+			reply: true,
+		},
+		"open connection is closed once the shutdown timeout expires": {
+			reply: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			server := newSSHServer(t)
+			forwarder, addr, cancel, served := startForwarder(t, server, newEchoServer(t))
+
+			conn, err := net.Dial("tcp", addr)
+			g.Expect(err).NotTo(HaveOccurred())
+			t.Cleanup(func() {
+				_ = conn.Close()
+			})
+			g.Eventually(func() int64 { return forwarder.Stats().Active }).Should(BeEquivalentTo(1))
+
+			cancel()
+
+			reader := bufio.NewReader(conn)
+			if tt.reply {
+				_, err = io.WriteString(conn, "bye\n")
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(reader.ReadString('\n')).To(Equal("bye\n"))
+				g.Expect(conn.Close()).To(Succeed())
+			}
+
+			g.Eventually(served).WithTimeout(5 * time.Second).Should(Receive(BeNil()))
+
+			if !tt.reply {
+				_, err = reader.ReadString('\n')
+				g.Expect(err).To(MatchError(io.EOF))
+			}
+
+			g.Expect(forwarder.Stats().Active).To(BeZero())
+		})
+	}
+}
+
+func TestForwarderOpen(t *testing.T) {
+	tests := map[string]struct {
+		connect  func(server *sshServer) tunnel.ConnectFunc
+		errorMsg string
+	}{
+		"connected": {
+			connect: connectSSH,
+		},
+		"unreachable machine": {
+			connect: func(_ *sshServer) tunnel.ConnectFunc {
+				return func(_ context.Context) (tunnel.Dialer, error) {
+					return nil, errors.New("unreachable")
+				}
+			},
+			errorMsg: "failed to connect to the machine: unreachable",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			forwarder := &tunnel.Forwarder{
+				RemoteAddr: "127.0.0.1:11434",
+				Connect:    tt.connect(newSSHServer(t)),
+			}
+
+			err := forwarder.Open(t.Context())
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(tt.errorMsg))
+
+				// Serve connects first, and fails the same way.
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(forwarder.Serve(t.Context(), listener)).To(MatchError(tt.errorMsg))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(forwarder.Close()).To(Succeed())
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/charmbracelet/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultKeepaliveInterval is the default interval between SSH keepalives.
+const DefaultKeepaliveInterval = 15 * time.Second
+
+// keepaliveRequest is the global request sent as keepalive, as OpenSSH does.
+const keepaliveRequest = "keepalive@openssh.com"
+
+// SSHDialer dials addresses of the machine network through an SSH connection.
+// It sends keepalives to detect when the connection is lost, and closes it then.
+type SSHDialer struct {
+	client *gossh.Client
+	done   chan struct{}
+}
+
+// NewSSHDialer returns a dialer using the given SSH client, sending a keepalive at the given interval.
+func NewSSHDialer(client *gossh.Client, keepaliveInterval time.Duration) *SSHDialer {
+	d := &SSHDialer{
+		client: client,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		_ = client.Wait()
+		close(d.done)
+	}()
+
+	if keepaliveInterval > 0 {
+		go d.keepalive(keepaliveInterval)
+	}
+
+	return d
+}
+
+// DialContext dials the given address through the SSH connection.
+// The SSH connection is closed, and Done closed, when the dial fails for another reason than the remote host refusing it.
+func (d *SSHDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.client.DialContext(ctx, network, addr)
+	if err != nil {
+		var openErr *gossh.OpenChannelError
+		if !errors.As(err, &openErr) && ctx.Err() == nil {
+			_ = d.client.Close()
+			<-d.done
+		}
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Done returns a channel closed once the SSH connection is lost.
+func (d *SSHDialer) Done() <-chan struct{} {
+	return d.done
+}
+
+// Close closes the SSH connection.
+func (d *SSHDialer) Close() error {
+	err := d.client.Close()
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// keepalive sends keepalives until the connection is lost, closing it when a keepalive isn't answered in time.
+func (d *SSHDialer) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := d.client.SendRequest(keepaliveRequest, true, nil)
+			replied <- err
+		}()
+
+		select {
+		case <-d.done:
+			return
+		case err := <-replied:
+			if err == nil {
+				continue
+			}
+
+			log.Warn("SSH keepalive failed", "err", err)
+		case <-time.After(interval):
+			log.Warn("SSH keepalive timed out", "timeout", interval)
+		}
+
+		_ = d.client.Close()
+
+		return
+	}
+}
@@ -0,0 +1,246 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package tunnel manages tunnels exposing the Ollama API of machines on local ports.
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	stateExtension = ".json"
+	logExtension   = ".log"
+	stopInterval   = 100 * time.Millisecond
+)
+
+// ErrNotRunning is returned when no tunnel to the machine is running.
+var ErrNotRunning = errors.New("no tunnel running")
+
+// State describes a running tunnel.
+type State struct {
+	// Machine is the name of the machine the tunnel leads to.
+	Machine string `json:"machine"`
+	// PID is the ID of the process running the tunnel.
+	PID int `json:"pid"`
+	// LocalPort is the local port the tunnel listens on.
+	LocalPort int `json:"localPort"`
+	// StartedAt is the date the tunnel started.
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Store stores the states of running tunnels as files in a directory, one per machine.
+// States of tunnels whose process is gone are removed when read.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store keeping states in the given directory.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Save saves the state of a tunnel.
+func (s *Store) Save(state *State) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tunnel state: %w", err)
+	}
+
+	// The state is renamed in place, so readers never see a partial file.
+	tmp := s.statePath(state.Machine) + ".tmp"
+
+	err = os.WriteFile(tmp, content, 0o600) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("failed to write tunnel state: %w", err)
+	}
+
+	err = os.Rename(tmp, s.statePath(state.Machine))
+	if err != nil {
+		return fmt.Errorf("failed to write tunnel state: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the state of the tunnel to the given machine, or ErrNotRunning.
+func (s *Store) Get(machineName string) (*State, error) {
+	content, err := os.ReadFile(s.statePath(machineName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotRunning
+		}
+
+		return nil, fmt.Errorf("failed to read tunnel state: %w", err)
+	}
+
+	state := &State{}
+
+	err = json.Unmarshal(content, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tunnel state: %w", err)
+	}
+
+	if !processRunning(state.PID) {
+		_ = s.Remove(machineName, state.PID)
+
+		return nil, ErrNotRunning
+	}
+
+	return state, nil
+}
+
+// List returns the states of running tunnels, sorted by machine name.
+func (s *Store) List() ([]*State, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return []*State{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	result := []*State{}
+	for _, entry := range entries {
+		machineName, ok := strings.CutSuffix(entry.Name(), stateExtension)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		state, err := s.Get(machineName)
+		if errors.Is(err, ErrNotRunning) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, state)
+	}
+
+	slices.SortFunc(result, func(a, b *State) int {
+		return strings.Compare(a.Machine, b.Machine)
+	})
+
+	return result, nil
+}
+
+// Remove removes the state of the tunnel to the given machine, if it is run by the given process.
+// Checking the process keeps a tunnel exiting from removing the state of the tunnel replacing it.
+func (s *Store) Remove(machineName string, pid int) error {
+	content, err := os.ReadFile(s.statePath(machineName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read tunnel state: %w", err)
+	}
+
+	state := &State{}
+	if json.Unmarshal(content, state) == nil && state.PID != pid {
+		return nil
+	}
+
+	err = os.Remove(s.statePath(machineName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove tunnel state: %w", err)
+	}
+
+	return nil
+}
+
+// Stop stops the tunnel to the given machine, and waits for it to exit.
+func (s *Store) Stop(ctx context.Context, machineName string) error {
+	state, err := s.Get(machineName)
+	if err != nil {
+		return err
+	}
+
+	process, err := os.FindProcess(state.PID)
+	if err != nil {
+		return fmt.Errorf("failed to find tunnel process: %w", err)
+	}
+
+	err = terminate(process)
+	if err != nil {
+		return fmt.Errorf("failed to stop tunnel: %w", err)
+	}
+
+	// The tunnel removes its state when exiting.
+	for processRunning(state.PID) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(stopInterval):
+		}
+	}
+
+	return s.Remove(machineName, state.PID)
+}
+
+// LogPath returns the path of the log file of the detached tunnel to the given machine.
+func (s *Store) LogPath(machineName string) string {
+	return filepath.Join(s.dir, machineName+logExtension)
+}
+
+// StartDetached starts the current executable with the given arguments in the background, detached from the terminal.
+// Its output is written to the log file of the tunnel to the given machine.
+// The caller must wait for the returned command, or let it run once the caller exits.
+func (s *Store) StartDetached(machineName string, args []string) (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executable: %w", err)
+	}
+
+	logFile, err := os.OpenFile(s.LogPath(machineName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tunnel log file: %w", err)
+	}
+
+	defer func() {
+		_ = logFile.Close()
+	}()
+
+	cmd := exec.Command(executable, args...) //nolint:gosec
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedSysProcAttr()
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start tunnel: %w", err)
+	}
+
+	return cmd, nil
+}
+
+func (s *Store) statePath(machineName string) string {
+	return filepath.Join(s.dir, machineName+stateExtension)
+}
@@ -0,0 +1,175 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tunnel_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/tunnel"
+	. "github.com/onsi/gomega"
+)
+
+// startedAt is the start time of the tunnels of the test stores.
+var startedAt = time.Now().UTC().Truncate(time.Second) //nolint:gochecknoglobals
+
+// exitedPID returns the ID of a process which has exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	NewWithT(t).Expect(cmd.Run()).To(Succeed())
+
+	return cmd.ProcessState.Pid()
+}
+
+// newStore returns a store holding the states of tunnels to gpu-0 and gpu-1, run by the current process,
+// and to stale, run by a process which has exited.
+func newStore(t *testing.T) *tunnel.Store {
+	t.Helper()
+	g := NewWithT(t)
+
+	store := tunnel.NewStore(t.TempDir())
+	g.Expect(store.Save(&tunnel.State{Machine: "gpu-1", PID: os.Getpid(), LocalPort: 11434, StartedAt: startedAt})).To(Succeed())
+	g.Expect(store.Save(&tunnel.State{Machine: "gpu-0", PID: os.Getpid(), LocalPort: 11435, StartedAt: startedAt})).To(Succeed())
+	g.Expect(store.Save(&tunnel.State{Machine: "stale", PID: exitedPID(t), LocalPort: 11436, StartedAt: startedAt})).To(Succeed())
+
+	return store
+}
+
+func TestStoreGet(t *testing.T) {
+	tests := map[string]struct {
+		machine string
+		state   *tunnel.State
+		err     error
+	}{
+		"running tunnel": {
+			machine: "gpu-1",
+			state:   &tunnel.State{Machine: "gpu-1", PID: os.Getpid(), LocalPort: 11434, StartedAt: startedAt},
+		},
+		"exited tunnel": {
+			machine: "stale",
+			err:     tunnel.ErrNotRunning,
+		},
+		"missing tunnel": {
+			machine: "missing",
+			err:     tunnel.ErrNotRunning,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			state, err := newStore(t).Get(tt.machine)
+			if tt.err != nil {
+				g.Expect(err).To(MatchError(tt.err))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(state).To(Equal(tt.state))
+		})
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	g := NewWithT(t)
+
+	store := newStore(t)
+
+	// States of exited tunnels are removed, others are sorted by machine.
+	states, err := store.List()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(states).To(HaveLen(2))
+	g.Expect(states[0].Machine).To(Equal("gpu-0"))
+	g.Expect(states[1].Machine).To(Equal("gpu-1"))
+
+	_, err = store.Get("stale")
+	g.Expect(err).To(MatchError(tunnel.ErrNotRunning))
+}
+
+func TestStoreRemove(t *testing.T) {
+	tests := map[string]struct {
+		machine string
+		pid     int
+		removed bool
+	}{
+		"tunnel of the process": {
+			machine: "gpu-1",
+			pid:     os.Getpid(),
+			removed: true,
+		},
+		"tunnel of another process": {
+			machine: "gpu-1",
+			pid:     os.Getpid() + 1,
+			removed: false,
+		},
+		"missing tunnel": {
+			machine: "missing",
+			pid:     os.Getpid(),
+			removed: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			store := newStore(t)
+			g.Expect(store.Remove(tt.machine, tt.pid)).To(Succeed())
+
+			_, err := store.Get(tt.machine)
+			if tt.removed {
+				g.Expect(err).To(MatchError(tunnel.ErrNotRunning))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestStoreStop(t *testing.T) {
+	tests := map[string]struct {
+		machine string
+		err     error
+	}{
+		"missing tunnel": {
+			machine: "missing",
+			err:     tunnel.ErrNotRunning,
+		},
+		"exited tunnel": {
+			machine: "stale",
+			err:     tunnel.ErrNotRunning,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			g.Expect(newStore(t).Stop(t.Context(), tt.machine)).To(MatchError(tt.err))
+		})
+	}
+}
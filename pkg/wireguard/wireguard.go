@@ -0,0 +1,187 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package wireguard generates WireGuard keys and configurations linking a machine to the local host.
+package wireguard
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// DefaultPort is the default UDP port WireGuard listens on.
+	DefaultPort = 51820
+	// ServerInterface is the name of the WireGuard interface on machines.
+	ServerInterface = "wg-ollama"
+	// NetworkBits is the prefix length of the network linking a machine to the local host, holding their two addresses.
+	NetworkBits = 30
+
+	keepaliveInterval = 25
+)
+
+// DefaultPool is the pool networks linking machines to the local host are allocated from.
+var DefaultPool = netip.MustParsePrefix("10.66.0.0/16")
+
+// ErrPoolExhausted is returned when all the networks of the pool are used.
+var ErrPoolExhausted = errors.New("no network available in the WireGuard pool")
+
+// Key is a WireGuard Curve25519 key.
+type Key [curve25519.ScalarSize]byte
+
+// GeneratePrivateKey generates a new private key.
+func GeneratePrivateKey() (Key, error) {
+	var key Key
+
+	_, err := rand.Read(key[:])
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to generate WireGuard key: %w", err)
+	}
+
+	// Clamp the key, as done by wg genkey.
+	key[0] &= 248
+	key[31] = (key[31] & 127) | 64 //nolint:mnd
+
+	return key, nil
+}
+
+// ParseKey parses a base64-encoded key.
+func ParseKey(s string) (Key, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid WireGuard key: %w", err)
+	}
+
+	var key Key
+	if len(decoded) != len(key) {
+		return Key{}, fmt.Errorf("invalid WireGuard key length %d", len(decoded))
+	}
+
+	copy(key[:], decoded)
+
+	return key, nil
+}
+
+// PublicKey returns the public key of the private key.
+func (k Key) PublicKey() Key {
+	var public Key
+
+	curve25519.ScalarBaseMult((*[32]byte)(&public), (*[32]byte)(&k))
+
+	return public
+}
+
+// IsZero returns true if the key isn't set.
+func (k Key) IsZero() bool {
+	return k == Key{}
+}
+
+// String returns the base64-encoded key, as used in WireGuard configurations.
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// AllocateNetwork returns the first network of the pool which doesn't overlap the used ones.
+func AllocateNetwork(pool netip.Prefix, used []netip.Prefix) (netip.Prefix, error) {
+	network := netip.PrefixFrom(pool.Masked().Addr(), NetworkBits)
+
+	for pool.Contains(network.Addr()) {
+		if !slices.ContainsFunc(used, network.Overlaps) {
+			return network, nil
+		}
+
+		next := network.Addr()
+		for range 1 << (32 - NetworkBits) {
+			next = next.Next()
+		}
+
+		network = netip.PrefixFrom(next, NetworkBits)
+	}
+
+	return netip.Prefix{}, ErrPoolExhausted
+}
+
+// ServerAddress returns the address of the machine in the given network.
+func ServerAddress(network netip.Prefix) netip.Addr {
+	return network.Masked().Addr().Next()
+}
+
+// ClientAddress returns the address of the local host in the given network.
+func ClientAddress(network netip.Prefix) netip.Addr {
+	return ServerAddress(network).Next()
+}
+
+// ClientInterface returns the name of the local WireGuard interface linked to the given machine.
+// Interface names are limited to 15 characters, so it is derived from a hash of the machine name.
+func ClientInterface(machineName string) string {
+	sum := sha256.Sum256([]byte(machineName))
+
+	return "om-" + hex.EncodeToString(sum[:4])
+}
+
+// ServerConfig returns the WireGuard configuration of the machine, listening on the given port for the client.
+func ServerConfig(network netip.Prefix, port int, privateKey, clientPublicKey Key) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString("[Interface]\n")
+	fmt.Fprintf(builder, "Address = %s\n", netip.PrefixFrom(ServerAddress(network), network.Bits()))
+	fmt.Fprintf(builder, "ListenPort = %d\n", port)
+	fmt.Fprintf(builder, "PrivateKey = %s\n", privateKey)
+	builder.WriteString("\n[Peer]\n")
+	fmt.Fprintf(builder, "PublicKey = %s\n", clientPublicKey)
+	fmt.Fprintf(builder, "AllowedIPs = %s\n", netip.PrefixFrom(ClientAddress(network), 32)) //nolint:mnd
+
+	return builder.String()
+}
+
+// ClientConfig returns the WireGuard configuration of the local host, reaching the machine at the given endpoint.
+func ClientConfig(network netip.Prefix, endpoint netip.AddrPort, privateKey, serverPublicKey Key) string {
+	builder := &strings.Builder{}
+
+	builder.WriteString("[Interface]\n")
+	fmt.Fprintf(builder, "Address = %s\n", netip.PrefixFrom(ClientAddress(network), network.Bits()))
+	fmt.Fprintf(builder, "PrivateKey = %s\n", privateKey)
+	builder.WriteString("\n[Peer]\n")
+	fmt.Fprintf(builder, "PublicKey = %s\n", serverPublicKey)
+	fmt.Fprintf(builder, "Endpoint = %s\n", endpoint)
+	fmt.Fprintf(builder, "AllowedIPs = %s\n", netip.PrefixFrom(ServerAddress(network), 32)) //nolint:mnd
+	fmt.Fprintf(builder, "PersistentKeepalive = %d\n", keepaliveInterval)
+
+	return builder.String()
+}
+
+// SetClientEndpoint returns the given WireGuard configuration of the local host, reaching the machine at the given endpoint.
+func SetClientEndpoint(config string, endpoint netip.AddrPort) string {
+	lines := strings.Split(config, "\n")
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == "Endpoint" {
+			lines[i] = fmt.Sprintf("Endpoint = %s", endpoint)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,146 @@
+// Licensed to Alexandre VILAIN under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Alexandre VILAIN licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package wireguard_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/alexandrevilain/ollama-machine/pkg/wireguard"
+	. "github.com/onsi/gomega"
+)
+
+func TestKeys(t *testing.T) {
+	g := NewWithT(t)
+
+	// Test vector from RFC 7748, section 6.1.
+	privateKey, err := wireguard.ParseKey("dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(privateKey.PublicKey().String()).To(Equal("hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo="))
+
+	generated, err := wireguard.GeneratePrivateKey()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(generated.IsZero()).To(BeFalse())
+	g.Expect(generated[0] & 7).To(BeZero())
+	g.Expect(generated[31] & 192).To(Equal(byte(64)))
+
+	parsed, err := wireguard.ParseKey(generated.String())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(parsed).To(Equal(generated))
+
+	_, err = wireguard.ParseKey("dG9vIHNob3J0")
+	g.Expect(err).To(MatchError(ContainSubstring("invalid WireGuard key length")))
+}
+
+func TestAllocateNetwork(t *testing.T) {
+	tests := map[string]struct {
+		pool     string
+		used     []string
+		result   string
+		errorMsg string
+	}{
+		"empty pool": {
+			pool:   "10.66.0.0/16",
+			result: "10.66.0.0/30",
+		},
+		"skip used networks": {
+			pool:   "10.66.0.0/16",
+			used:   []string{"10.66.0.0/30", "10.66.0.4/30", "10.66.0.12/30"},
+			result: "10.66.0.8/30",
+		},
+		"skip overlapping networks": {
+			pool:   "10.66.0.0/16",
+			used:   []string{"10.66.0.0/24"},
+			result: "10.66.1.0/30",
+		},
+		"exhausted pool": {
+			pool:     "10.66.0.0/29",
+			used:     []string{"10.66.0.0/30", "10.66.0.4/30"},
+			errorMsg: "no network available",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			g := NewWithT(t)
+
+			used := []netip.Prefix{}
+			for _, network := range tt.used {
+				used = append(used, netip.MustParsePrefix(network))
+			}
+
+			result, err := wireguard.AllocateNetwork(netip.MustParsePrefix(tt.pool), used)
+			if tt.errorMsg != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.errorMsg)))
+
+				return
+			}
+
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(result.String()).To(Equal(tt.result))
+		})
+	}
+}
+
+func TestConfigs(t *testing.T) {
+	g := NewWithT(t)
+
+	network := netip.MustParsePrefix("10.66.0.4/30")
+	serverKey, err := wireguard.ParseKey("dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=")
+	g.Expect(err).NotTo(HaveOccurred())
+	clientKey, err := wireguard.ParseKey("oEYwDmsvGeYZ0zaZvZoBdG1ULuiuxXIKSqlD7FYQxEk=")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(wireguard.ServerAddress(network).String()).To(Equal("10.66.0.5"))
+	g.Expect(wireguard.ClientAddress(network).String()).To(Equal("10.66.0.6"))
+
+	g.Expect(wireguard.ServerConfig(network, 51820, serverKey, clientKey.PublicKey())).To(Equal(`[Interface]
+Address = 10.66.0.5/30
+ListenPort = 51820
+PrivateKey = dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo=
+
+[Peer]
+PublicKey = ` + clientKey.PublicKey().String() + `
+AllowedIPs = 10.66.0.6/32
+`))
+
+	g.Expect(wireguard.ClientConfig(network, netip.MustParseAddrPort("1.2.3.4:51820"), clientKey, serverKey.PublicKey())).To(Equal(`[Interface]
+Address = 10.66.0.6/30
+PrivateKey = oEYwDmsvGeYZ0zaZvZoBdG1ULuiuxXIKSqlD7FYQxEk=
+
+[Peer]
+PublicKey = hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo=
+Endpoint = 1.2.3.4:51820
+AllowedIPs = 10.66.0.5/32
+PersistentKeepalive = 25
+`))
+
+	clientConfig := wireguard.ClientConfig(network, netip.MustParseAddrPort("1.2.3.4:51820"), clientKey, serverKey.PublicKey())
+	g.Expect(wireguard.SetClientEndpoint(clientConfig, netip.MustParseAddrPort("5.6.7.8:51820"))).To(Equal(
+		wireguard.ClientConfig(network, netip.MustParseAddrPort("5.6.7.8:51820"), clientKey, serverKey.PublicKey())))
+}
+
+func TestClientInterface(t *testing.T) {
+	g := NewWithT(t)
+
+	name := wireguard.ClientInterface("a-very-long-machine-name-for-an-interface")
+	g.Expect(name).To(HavePrefix("om-"))
+	g.Expect(len(name)).To(BeNumerically("<=", 15))
+	g.Expect(wireguard.ClientInterface("other-machine")).NotTo(Equal(name))
+}